@@ -11,6 +11,7 @@ import (
 	"github.com/victor-nach/git-monitor/config"
 	"github.com/victor-nach/git-monitor/internal/db"
 	"github.com/victor-nach/git-monitor/internal/db/store"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/domain/services/commit"
 	"github.com/victor-nach/git-monitor/pkg/github"
 
@@ -18,8 +19,12 @@ import (
 	"github.com/victor-nach/git-monitor/internal/domain/services/task"
 	"github.com/victor-nach/git-monitor/internal/http/handlers"
 	"github.com/victor-nach/git-monitor/internal/http/server"
+	"github.com/victor-nach/git-monitor/internal/leader"
+	"github.com/victor-nach/git-monitor/internal/notifier"
 	"github.com/victor-nach/git-monitor/internal/scheduler"
+	"github.com/victor-nach/git-monitor/internal/watchdog"
 	"github.com/victor-nach/git-monitor/internal/worker/fetcher"
+	"github.com/victor-nach/git-monitor/internal/worker/idempotency"
 	"github.com/victor-nach/git-monitor/internal/worker/saver"
 	"github.com/victor-nach/git-monitor/pkg/eventbus"
 	"github.com/victor-nach/git-monitor/pkg/githubclient"
@@ -48,32 +53,80 @@ func run(log *zap.Logger, cfg *config.Config, gormDB *gorm.DB) {
 	repoStore := db.NewRepoStore()
 	commitStore := db.NewCommitStore()
 	taskStore := db.NewTaskStore()
-
-	eventBus := eventbus.NewInMemoryEventBus(log, cfg.GetQueueBufferSize())
+	batchStore := db.NewBatchStore()
+	checkpointStore := db.NewCheckpointStore()
+	leaseStore := db.NewLeaseStore()
+	attemptStore := db.NewAttemptStore()
+	messageStore := db.NewMessageStore()
+	leaderStore := db.NewLeaderStore()
+	schedulerStore := db.NewSchedulerStore()
+
+	eventBus := initEventBus(log, cfg)
 	defer eventBus.Close()
 	gitClient := githubclient.New(cfg.GetGithubToken(), log)
 
 	githubSvc := github.New(log, gitClient, cfg.GetGithubBatchSize())
-	tasksSvc := task.New(taskStore, repoStore, eventBus)
-	repoSvc := repository.New(repoStore, tasksSvc, githubSvc)
+	retryPolicy := task.RetryPolicy{
+		MaxAttempts: cfg.GetMaxTaskAttempts(),
+		BaseDelay:   cfg.GetRetryBaseDelay(),
+		MaxDelay:    cfg.GetRetryMaxDelay(),
+	}
+	taskNotifier := notifier.New(cfg.GetTaskEventsBufferSize())
+	tasksSvc := task.New(taskStore, batchStore, checkpointStore, leaseStore, attemptStore, repoStore, eventBus, taskNotifier, cfg.GetLeaseTTL(), retryPolicy, cfg.GetQuietWindows())
+	repoSvc := repository.New(repoStore, tasksSvc, githubSvc, cfg.GetScheduleInterval())
 	commitSvc := commit.New(commitStore)
+	dedup := idempotency.New(log, messageStore, db)
 
-	ctx := context.Background()
-	schedulerSvc := scheduler.New(log, tasksSvc, cfg.GetScheduleInterval())
-	go schedulerSvc.Start(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	fetcherWorker := fetcher.New(log, githubSvc, tasksSvc, eventBus, cfg.GetWorkerSize())
+	// every instance serves http and consumes work, but only the leader runs the
+	// scheduler
+	adaptiveBounds := models.AdaptiveBounds{
+		Min: cfg.GetAdaptiveMinInterval(),
+		Max: cfg.GetAdaptiveMaxInterval(),
+	}
+	dispatchPolicy := scheduler.DispatchPolicy{
+		Jitter:        cfg.GetSchedulerJitter(),
+		MaxConcurrent: cfg.GetSchedulerMaxConcurrent(),
+		MaxPerOwner:   cfg.GetSchedulerMaxPerOwner(),
+		QuietWindows:  cfg.GetQuietWindows(),
+	}
+	schedulerSvc := scheduler.New(log, tasksSvc, repoStore, commitStore, taskStore, schedulerStore, leaderStore, cfg.GetScheduleInterval(), cfg.GetSchedulerPollInterval(), adaptiveBounds, dispatchPolicy)
+	elector := leader.New(log, leaderStore, scheduler.LeaderRole, cfg.GetInstanceID(), cfg.GetLeaderLeaseTTL())
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(ctx, schedulerSvc.Start)
+	}()
+
+	watchdogSvc := watchdog.New(log, tasksSvc, cfg.GetWatchdogInterval(), cfg.GetStaleTaskTimeout(), cfg.GetRequeueStaleTasks())
+	go watchdogSvc.Start(ctx)
+
+	fetcherWorker := fetcher.New(log, githubSvc, tasksSvc, eventBus, dedup, cfg.GetWorkerSize())
 	if err := fetcherWorker.Subscribe(ctx); err != nil {
 		log.Fatal("failed to subscribe fetcher worker", zap.Error(err))
 	}
 
-	saverWorker := saver.New(log, commitSvc, repoSvc, eventBus, cfg.GetWorkerSize())
+	saverWorker := saver.New(log, commitSvc, repoSvc, tasksSvc, eventBus, dedup, cfg.GetWorkerSize())
 	if err := saverWorker.Subscribe(ctx); err != nil {
 		log.Fatal("failed to subscribe saver worker", zap.Error(err))
 	}
 
-	handlers := handlers.New(log, repoSvc, commitSvc, tasksSvc)
+	// every instance resumes the tasks interrupted by a previous run once, when
+	// it starts, as the leader may change many times while they run
+	log.Info("resuming interrupted tasks")
+	if err := tasksSvc.ResumeTasks(ctx, cfg.GetStaleTaskTimeout()); err != nil {
+		log.Error("error resuming tasks", zap.Error(err))
+	}
+
+	handlers := handlers.New(log, repoSvc, commitSvc, tasksSvc, schedulerSvc)
 	server.Run(log, handlers, cfg.GetPort())
+
+	// step down and release the lease, so another instance takes over without
+	// waiting for it to expire
+	cancel()
+	<-electorDone
 }
 
 func InitLogger() *zap.Logger {
@@ -98,19 +151,58 @@ func loadConfiguration(log *zap.Logger) *config.Config {
 	return cfg
 }
 
+func initEventBus(log *zap.Logger, cfg *config.Config) eventbus.EventBus {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch cfg.GetEventBus() {
+	case config.EventBusRabbitMQ:
+		bus, err := eventbus.NewRabbitMQEventBus(ctx, cfg.GetRabbitMQURL(), log)
+		if err != nil {
+			log.Fatal("failed to connect to rabbitmq", zap.Error(err))
+		}
+		return bus
+
+	case config.EventBusNATS:
+		bus, err := eventbus.NewJetStreamEventBus(ctx, cfg.GetNATSURL(), log)
+		if err != nil {
+			log.Fatal("failed to connect to nats jetstream", zap.Error(err))
+		}
+		return bus
+
+	default:
+		return eventbus.NewInMemoryEventBus(log, cfg.GetQueueBufferSize())
+	}
+}
+
 func initDatabase(log *zap.Logger, cfg *config.Config) (*gorm.DB, *sql.DB) {
 	projectRoot, err := utils.GetBasePath()
 	if err != nil {
 		log.Fatal("failed to get project root", zap.Error(err))
 	}
-	dbf := filepath.Join(projectRoot, "data", cfg.GetDBFileName())
-	mf := filepath.Join(projectRoot, "migrations")
+	// every backend has its own set of migrations
+	mf := filepath.Join(projectRoot, "migrations", cfg.GetDBDriver())
 	mf = filepath.ToSlash(mf)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	gormDB, sqlDB, err := db.New(ctx, log, dbf, mf)
+	var (
+		gormDB *gorm.DB
+		sqlDB  *sql.DB
+	)
+	switch cfg.GetDBDriver() {
+	case config.DBDriverPostgres:
+		gormDB, sqlDB, err = db.NewPostgres(ctx, log, cfg.GetPostgresDSN(), mf, func(dc *db.DBConfig) {
+			dc.MaxOpenConns = cfg.GetPostgresMaxOpenConns()
+			dc.MaxIdleConns = cfg.GetPostgresMaxIdleConns()
+			dc.ConnMaxLifetime = cfg.GetPostgresConnMaxLifetime()
+		})
+
+	default:
+		dbf := filepath.Join(projectRoot, "data", cfg.GetDBFileName())
+		gormDB, sqlDB, err = db.New(ctx, log, dbf, mf)
+	}
 	if err != nil {
 		log.Fatal("failed to initialize database", zap.Error(err))
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log"
 	"os"
 	"path/filepath"
@@ -37,13 +38,20 @@ func main() {
 		log.Fatalf("failed to get project root: %v", err)
 	}
 
-	// Set up the database file path
-	dbf := filepath.Join(projectRoot, "data", cfg.GetDBFileName())
-	mf := filepath.Join(projectRoot, "migrations")
+	mf := filepath.Join(projectRoot, "migrations", cfg.GetDBDriver())
 	mf = filepath.ToSlash(mf)
 
 	ctx := context.Background()
-	_, sqlDB, err := db.New(ctx, logr, dbf, mf)
+	var sqlDB *sql.DB
+	switch cfg.GetDBDriver() {
+	case config.DBDriverPostgres:
+		_, sqlDB, err = db.NewPostgres(ctx, logr, cfg.GetPostgresDSN(), mf)
+
+	default:
+		// Set up the database file path
+		dbf := filepath.Join(projectRoot, "data", cfg.GetDBFileName())
+		_, sqlDB, err = db.New(ctx, logr, dbf, mf)
+	}
 	if err != nil {
 		logr.Fatal("failed to initialize database", zap.Error(err))
 	}
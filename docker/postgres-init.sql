@@ -0,0 +1,2 @@
+-- database the store tests run against, reset on every run
+CREATE DATABASE git_monitor_test;
@@ -18,6 +18,7 @@ import (
 
 type DBConfig struct {
 	DBFilePath      string
+	DSN             string
 	MigrationsPath  string
 	MaxOpenConns    int
 	MaxIdleConns    int
@@ -76,7 +77,7 @@ func New(ctx context.Context, log *zap.Logger, dbPath, migrationsPath string, op
 	}
 
 	migrationsURL := cfg.MigrationsPath
-	if err := migrator.Migrate(ctx, sqlDB, migrationsURL, log); err != nil {
+	if err := migrator.Migrate(ctx, sqlDB, migrator.DriverSQLite, migrationsURL, log); err != nil {
 		sqlDB.Close()
 		return nil, nil, fmt.Errorf("failed to apply migrations: %w", err)
 	}
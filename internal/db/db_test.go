@@ -51,10 +51,10 @@ func TestMain(m *testing.M) {
 		log.Fatalf("failed to get project root: %v", err)
 	}
 
-	mf := filepath.Join(projectRoot, "migrations")
+	mf := filepath.Join(projectRoot, "migrations", migrator.DriverSQLite)
 	mf = filepath.ToSlash(mf)
 
-	if err := migrator.Migrate(testCtx, sqlDB, mf, logr); err != nil {
+	if err := migrator.Migrate(testCtx, sqlDB, migrator.DriverSQLite, mf, logr); err != nil {
 		sqlDB.Close()
 		log.Fatalf("failed to apply migrations: %v", err)
 		return
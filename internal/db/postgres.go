@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/victor-nach/git-monitor/pkg/migrator"
+)
+
+// NewPostgres connects to the Postgres database of the DSN through a pool of
+// connections, and applies the Postgres migrations to it
+func NewPostgres(ctx context.Context, log *zap.Logger, dsn, migrationsPath string, opts ...func(*DBConfig)) (*gorm.DB, *sql.DB, error) {
+	cfg := DBConfig{
+		DSN:             dsn,
+		MigrationsPath:  migrationsPath,
+		MaxOpenConns:    20,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: time.Hour,
+		ConnMaxIdleTime: 10 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.DSN == "" {
+		return nil, nil, fmt.Errorf("postgres DSN is empty")
+	}
+
+	sqlDB, err := sql.Open("pgx", cfg.DSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open SQL database: %w", err)
+	}
+
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("failed to initialize GORM: %w", err)
+	}
+
+	if err := migrator.Migrate(ctx, sqlDB, migrator.DriverPostgres, cfg.MigrationsPath, log); err != nil {
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	log.Info("database initialized successfully", zap.String("driver", migrator.DriverPostgres))
+
+	return gormDB, sqlDB, nil
+}
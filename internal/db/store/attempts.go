@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+)
+
+type attemptStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewAttemptStore() *attemptStore {
+	return &attemptStore{
+		db: s.db,
+	}
+}
+
+func (s *attemptStore) Create(ctx context.Context, attempt models.TaskAttempt) error {
+	if err := conn(ctx, s.db).Create(&attempt).Error; err != nil {
+		return fmt.Errorf("failed to record task attempt: %w", err)
+	}
+	return nil
+}
+
+// Finish closes the running attempts of a task with the given status
+func (s *attemptStore) Finish(ctx context.Context, taskID string, status string, errMsg string, retryAt *time.Time) error {
+	err := conn(ctx, s.db).Model(&models.TaskAttempt{}).
+		Where("task_id = ? AND status = ?", taskID, models.AttemptStatusRunning).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"error_message": errMsg,
+			"finished_at":   time.Now(),
+			"retry_at":      retryAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to finish task attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *attemptStore) List(ctx context.Context, taskID string) ([]models.TaskAttempt, error) {
+	var attempts []models.TaskAttempt
+	err := conn(ctx, s.db).
+		Where("task_id = ?", taskID).
+		Order("attempt").
+		Find(&attempts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task attempts: %w", err)
+	}
+	return attempts, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type batchStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewBatchStore() *batchStore {
+	return &batchStore{
+		db: s.db,
+	}
+}
+
+// Upsert records a fetched batch. A batch fetched again, e.g. when its task is
+// retried, replaces the earlier record.
+func (s *batchStore) Upsert(ctx context.Context, batch models.BatchDetail) error {
+	err := conn(ctx, s.db).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "task_id"}, {Name: "batch_id"}},
+			UpdateAll: true,
+		}).
+		Create(&batch).Error
+	if err != nil {
+		return fmt.Errorf("failed to record batch: %w", err)
+	}
+	return nil
+}
+
+func (s *batchStore) UpdateStatus(ctx context.Context, taskID string, batchID int, status string, errMsg *string) error {
+	updates := map[string]interface{}{
+		"status": status,
+	}
+	if errMsg != nil {
+		updates["error_message"] = *errMsg
+	}
+	if status == models.BatchStatusSaved {
+		updates["saved_at"] = time.Now()
+		updates["error_message"] = ""
+	}
+	result := conn(ctx, s.db).Model(&models.BatchDetail{}).
+		Where("task_id = ? AND batch_id = ?", taskID, batchID).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update batch status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *batchStore) List(ctx context.Context, taskID string) ([]models.BatchDetail, error) {
+	var batches []models.BatchDetail
+	err := conn(ctx, s.db).
+		Where("task_id = ?", taskID).
+		Order("batch_id").
+		Find(&batches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batches: %w", err)
+	}
+	return batches, nil
+}
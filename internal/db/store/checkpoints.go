@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type checkpointStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewCheckpointStore() *checkpointStore {
+	return &checkpointStore{
+		db: s.db,
+	}
+}
+
+// Save records the checkpoint of a task, replacing the previous one
+func (s *checkpointStore) Save(ctx context.Context, checkpoint models.TaskCheckpoint) error {
+	err := conn(ctx, s.db).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "task_id"}},
+			UpdateAll: true,
+		}).
+		Create(&checkpoint).Error
+	if err != nil {
+		return fmt.Errorf("failed to save task checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Get returns the checkpoint of a task, or nil when none has been saved yet
+func (s *checkpointStore) Get(ctx context.Context, taskID string) (*models.TaskCheckpoint, error) {
+	var checkpoint models.TaskCheckpoint
+	err := conn(ctx, s.db).
+		Where("task_id = ?", taskID).
+		First(&checkpoint).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get task checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -20,15 +21,28 @@ func (s *store) NewCommitStore() *commitStore {
 	}
 }
 
+// commitColumns selects a commit along with its link to a repository
+const commitColumns = "commits.id, commits.sha, repository_commits.repository_id, " +
+	"repositories.name AS repo_name, repositories.owner AS repo_owner, commits.message, " +
+	"commits.author, commits.author_email, commits.date, repository_commits.url, " +
+	"repository_commits.created_at, commits.updated_at"
+
+// repoCommits scopes a query to the commits linked to a repository
+func repoCommits(tx *gorm.DB, repoInfo models.RepoInfo) *gorm.DB {
+	return tx.
+		Table("repository_commits").
+		Joins("JOIN commits ON commits.sha = repository_commits.sha").
+		Joins("JOIN repositories ON repositories.id = repository_commits.repository_id").
+		Where("repositories.name = ? AND repositories.owner = ?", repoInfo.Name, repoInfo.Owner)
+}
+
 func (s *commitStore) GetTopAuthors(ctx context.Context, RepoInfo models.RepoInfo, limit int) ([]models.AuthorStats, error) {
 	var authorStats []models.AuthorStats
 
-	err := s.db.WithContext(ctx).
-		Model(&models.Commit{}).
-		Select("author, COUNT(*) as commits").
-		Where("repo_name = ? AND repo_owner = ?", RepoInfo.Name, RepoInfo.Owner).
-		Group("author").
-		Order("commits DESC").
+	err := repoCommits(conn(ctx, s.db), RepoInfo).
+		Select("commits.author AS author, COUNT(*) AS commits").
+		Group("commits.author").
+		Order("COUNT(*) DESC").
 		Limit(limit).
 		Find(&authorStats).Error
 
@@ -39,35 +53,62 @@ func (s *commitStore) GetTopAuthors(ctx context.Context, RepoInfo models.RepoInf
 	return authorStats, nil
 }
 
-func (s *commitStore) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, string, error) {
-	var commits []models.Commit
-
-	query := s.db.WithContext(ctx).
-		Where("repo_name = ? AND repo_owner = ?", RepoInfo.Name, RepoInfo.Owner).
-		Order("date DESC")
-
-	if pagination.Cursor != "" {
-		query = query.Where("date < ?", pagination.Cursor)
+// List returns the page of the commits of a repository the pagination points at,
+// latest first, ordered by date and ID
+func (s *commitStore) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, models.Pagination, error) {
+	order := keyset[models.Commit]{
+		timeColumn: "commits.date",
+		idColumn:   "commits.id",
+		columns:    commitColumns,
+		desc:       true,
+		key:        func(commit models.Commit) (time.Time, string) { return commit.Date, commit.ID },
 	}
 
-	err := query.Limit(pagination.Limit).Find(&commits).Error
+	commits, page, err := order.page(func() *gorm.DB {
+		return repoCommits(conn(ctx, s.db), RepoInfo)
+	}, pagination)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to fetch commits: %w", err)
+		return nil, page, fmt.Errorf("failed to fetch commits: %w", err)
 	}
 
-	var nextCursor string
-	if len(commits) > 0 {
-		nextCursor = commits[len(commits)-1].Date.Format(time.RFC3339)
+	return commits, page, nil
+}
+
+// CountSince counts the commits of a repository stored since the given time
+func (s *commitStore) CountSince(ctx context.Context, repoID string, since time.Time) (int64, error) {
+	var count int64
+
+	err := conn(ctx, s.db).
+		Model(&models.RepositoryCommit{}).
+		Where("repository_id = ? AND created_at >= ?", repoID, since).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count commits: %w", err)
 	}
 
-	return commits, nextCursor, nil
+	return count, nil
 }
 
+// CreateBatch stores the commits and links them to their repository. Commits
+// already stored, e.g. for the upstream of a fork, are only linked.
 func (s *commitStore) CreateBatch(ctx context.Context, commits []models.Commit) error {
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&commits).Error; err != nil {
 			return fmt.Errorf("failed to insert commits: %w", err)
 		}
+
+		links := make([]models.RepositoryCommit, len(commits))
+		for i, commit := range commits {
+			links[i] = models.RepositoryCommit{
+				RepositoryID: commit.RepositoryID,
+				SHA:          commit.SHA,
+				URL:          commit.URL,
+				CreatedAt:    commit.CreatedAt,
+			}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+			return fmt.Errorf("failed to link commits: %w", err)
+		}
 		return nil
 	})
 
@@ -77,3 +118,87 @@ func (s *commitStore) CreateBatch(ctx context.Context, commits []models.Commit)
 
 	return nil
 }
+
+// Search returns the page of the commits whose message matches the search the
+// pagination points at, of the given repository or, without one, of every
+// repository, best matches first. A commit shared by several repositories is
+// returned for each of them.
+func (s *commitStore) Search(ctx context.Context, expr models.SearchExpr, repoInfo *models.RepoInfo, pagination models.PaginationReq) ([]models.CommitMatch, models.Pagination, error) {
+	page := models.Pagination{Limit: pagination.Limit}
+
+	// matches are ranked rather than ordered by a key, so they are paged by offset
+	offset := 0
+	if pagination.Cursor != "" {
+		var err error
+		if offset, err = decodeOffsetCursor(pagination.Cursor); err != nil {
+			return nil, page, dErrors.ErrInvalidInput.WithError(err)
+		}
+	}
+
+	// the full-text index of each backend is queried in its own dialect
+	tx := conn(ctx, s.db)
+	postgres := tx.Dialector.Name() == "postgres"
+	matching := func() *gorm.DB {
+		query := tx.
+			Table("repository_commits").
+			Joins("JOIN commits ON commits.sha = repository_commits.sha").
+			Joins("JOIN repositories ON repositories.id = repository_commits.repository_id")
+		if postgres {
+			query = query.
+				Joins("CROSS JOIN to_tsquery('english', ?) AS search_query", tsQuery(expr)).
+				Where("commits.message_tsv @@ search_query")
+		} else {
+			query = query.
+				Joins("JOIN commit_search_keys ON commit_search_keys.commit_id = commits.id").
+				Joins("JOIN commits_fts ON commits_fts.rowid = commit_search_keys.id").
+				Where("commits_fts MATCH ?", ftsQuery(expr))
+		}
+		if repoInfo != nil {
+			query = query.Where("repositories.name = ? AND repositories.owner = ?", repoInfo.Name, repoInfo.Owner)
+		}
+		return query
+	}
+
+	if pagination.IncludeTotal {
+		var total int64
+		if err := matching().Count(&total).Error; err != nil {
+			return nil, page, fmt.Errorf("failed to count commits: %w", err)
+		}
+		page.TotalCount = &total
+	}
+
+	query := matching()
+	if postgres {
+		options := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=1, MaxWords=%d, MinWords=%d, FragmentDelimiter=...",
+			highlightStart, highlightEnd, snippetWords, snippetWords/2)
+		query = query.Select(commitColumns+", ts_headline('english', commits.message, search_query, ?) AS snippet, "+
+			"ts_rank_cd(commits.message_tsv, search_query) AS score", options)
+	} else {
+		query = query.Select(commitColumns+", snippet(commits_fts, 0, ?, ?, '...', ?) AS snippet, -bm25(commits_fts) AS score",
+			highlightStart, highlightEnd, snippetWords)
+	}
+
+	// one match more than the page tells whether there is a next page
+	var matches []models.CommitMatch
+	err := query.
+		Order("score DESC").
+		Order("commits.date DESC").
+		Order("commits.sha").
+		Order("repository_commits.repository_id").
+		Offset(offset).
+		Limit(pagination.Limit + 1).
+		Scan(&matches).Error
+	if err != nil {
+		return nil, page, fmt.Errorf("failed to search commits: %w", err)
+	}
+
+	if len(matches) > pagination.Limit {
+		matches = matches[:pagination.Limit]
+		page.NextCursor = encodeOffsetCursor(offset + pagination.Limit)
+	}
+	if offset > 0 {
+		page.PreviousCursor = encodeOffsetCursor(max(offset-pagination.Limit, 0))
+	}
+
+	return matches, page, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type leaderStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewLeaderStore() *leaderStore {
+	return &leaderStore{
+		db: s.db,
+	}
+}
+
+// Acquire makes the owner the leader of the named role until expiresAt, provided
+// the lease is free, has expired or is already held by the owner, in which case
+// it is renewed. It reports whether the owner holds the lease.
+func (s *leaderStore) Acquire(ctx context.Context, name, ownerID string, expiresAt time.Time) (bool, error) {
+	lease := models.LeaderLease{
+		Name:      name,
+		OwnerID:   ownerID,
+		ExpiresAt: expiresAt,
+	}
+	result := conn(ctx, s.db).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"owner_id", "expires_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Or(
+					clause.Expr{SQL: "leader_leases.owner_id = ?", Vars: []interface{}{ownerID}},
+					clause.Expr{SQL: "leader_leases.expires_at < ?", Vars: []interface{}{time.Now()}},
+				),
+			}},
+		}).
+		Create(&lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to acquire leader lease: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Get returns the lease of the named role, with no owner when none holds it
+func (s *leaderStore) Get(ctx context.Context, name string) (models.LeaderLease, error) {
+	var lease models.LeaderLease
+	err := conn(ctx, s.db).
+		Where("name = ?", name).
+		Limit(1).
+		Find(&lease).Error
+	if err != nil {
+		return models.LeaderLease{}, fmt.Errorf("failed to get leader lease: %w", err)
+	}
+	return lease, nil
+}
+
+// Release gives up the leadership of the named role if the owner holds it
+func (s *leaderStore) Release(ctx context.Context, name, ownerID string) error {
+	err := conn(ctx, s.db).
+		Where("name = ? AND owner_id = ?", name, ownerID).
+		Delete(&models.LeaderLease{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	return nil
+}
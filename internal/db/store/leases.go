@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type leaseStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewLeaseStore() *leaseStore {
+	return &leaseStore{
+		db: s.db,
+	}
+}
+
+// Acquire gives the lease of a repository to a task until expiresAt, provided the
+// lease is free, has expired or is already held by the task, in which case it is
+// renewed. It reports whether the task holds the lease.
+func (s *leaseStore) Acquire(ctx context.Context, repoID, taskID string, expiresAt time.Time) (bool, error) {
+	lease := models.RepoLease{
+		RepositoryID: repoID,
+		TaskID:       taskID,
+		ExpiresAt:    expiresAt,
+	}
+	result := conn(ctx, s.db).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "repository_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"task_id", "expires_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Or(
+					clause.Expr{SQL: "repo_leases.task_id = ?", Vars: []interface{}{taskID}},
+					clause.Expr{SQL: "repo_leases.expires_at < ?", Vars: []interface{}{time.Now()}},
+				),
+			}},
+		}).
+		Create(&lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to acquire repository lease: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Release frees the lease of a repository if the task holds it
+func (s *leaseStore) Release(ctx context.Context, repoID, taskID string) error {
+	err := conn(ctx, s.db).
+		Where("repository_id = ? AND task_id = ?", repoID, taskID).
+		Delete(&models.RepoLease{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release repository lease: %w", err)
+	}
+	return nil
+}
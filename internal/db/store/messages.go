@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type messageStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewMessageStore() *messageStore {
+	return &messageStore{
+		db: s.db,
+	}
+}
+
+func (s *messageStore) IsProcessed(ctx context.Context, messageID, consumer string) (bool, error) {
+	var count int64
+
+	err := conn(ctx, s.db).
+		Model(&models.ProcessedMessage{}).
+		Where("message_id = ? AND consumer = ?", messageID, consumer).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to look up processed message: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// MarkProcessed records a message as processed by a consumer. It returns
+// ErrMessageAlreadyProcessed if the message was already recorded, which lets a
+// surrounding transaction roll back the duplicate's writes.
+func (s *messageStore) MarkProcessed(ctx context.Context, msg models.ProcessedMessage) error {
+	result := conn(ctx, s.db).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&msg)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record processed message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return dErrors.ErrMessageAlreadyProcessed
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+)
+
+// keyset pages a list ordered by a time column, with an ID column breaking ties,
+// by the sort key of the first or last item of the page it was at rather than
+// by offset, so that pages stay consistent while items are added
+type keyset[T any] struct {
+	timeColumn string
+	idColumn   string
+	// columns are selected instead of the columns of T
+	columns string
+	// desc lists the latest items first
+	desc bool
+	// key returns the sort key of an item
+	key func(T) (time.Time, string)
+}
+
+// keysetCursor points after, or before, the item with the given sort key
+type keysetCursor struct {
+	Before bool      `json:"b,omitempty"`
+	Time   time.Time `json:"t"`
+	ID     string    `json:"i"`
+}
+
+func encodeKeysetCursor(before bool, t time.Time, id string) string {
+	raw, _ := json.Marshal(keysetCursor{Before: before, Time: t, ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeKeysetCursor(cursor string) (keysetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return keysetCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	var c keysetCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return keysetCursor{}, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// page returns the page of the list of the query the pagination points at, and
+// the cursors of the pages next to it. A previous cursor lists the items before
+// the first item of its page, in the same order. query returns a new query of
+// the list, filtered but neither ordered nor paged.
+func (k keyset[T]) page(query func() *gorm.DB, pagination models.PaginationReq) ([]T, models.Pagination, error) {
+	page := models.Pagination{Limit: pagination.Limit}
+
+	var cursor *keysetCursor
+	if pagination.Cursor != "" {
+		c, err := decodeKeysetCursor(pagination.Cursor)
+		if err != nil {
+			return nil, page, dErrors.ErrInvalidInput.WithError(err)
+		}
+		cursor = &c
+	}
+
+	if pagination.IncludeTotal {
+		var total int64
+		if err := query().Count(&total).Error; err != nil {
+			return nil, page, fmt.Errorf("failed to count items: %w", err)
+		}
+		page.TotalCount = &total
+	}
+
+	// a previous page is read backwards from its cursor, and reversed
+	backward := cursor != nil && cursor.Before
+	cmp, dir := ">", "ASC"
+	if k.desc != backward {
+		cmp, dir = "<", "DESC"
+	}
+
+	rows := query()
+	if k.columns != "" {
+		rows = rows.Select(k.columns)
+	}
+	rows = rows.Order(k.timeColumn + " " + dir).Order(k.idColumn + " " + dir)
+	if cursor != nil {
+		rows = rows.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", k.timeColumn, cmp, k.timeColumn, k.idColumn, cmp),
+			cursor.Time, cursor.Time, cursor.ID,
+		)
+	}
+
+	// one item more than the page tells whether there is a page past it
+	var items []T
+	if err := rows.Limit(pagination.Limit + 1).Find(&items).Error; err != nil {
+		return nil, page, err
+	}
+	more := len(items) > pagination.Limit
+	if more {
+		items = items[:pagination.Limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+	if len(items) == 0 {
+		return items, page, nil
+	}
+
+	first, firstID := k.key(items[0])
+	last, lastID := k.key(items[len(items)-1])
+	hasPrevious, hasNext := cursor != nil, more
+	if backward {
+		hasPrevious, hasNext = more, true
+	}
+	if hasPrevious {
+		page.PreviousCursor = encodeKeysetCursor(true, first, firstID)
+	}
+	if hasNext {
+		page.NextCursor = encodeKeysetCursor(false, last, lastID)
+	}
+
+	return items, page, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -24,7 +25,7 @@ func (s *store) NewRepoStore() *repoStore {
 func (s *repoStore) Get(ctx context.Context, RepoInfo models.RepoInfo) (models.Repository, error) {
 	var repo models.Repository
 
-	err := s.db.WithContext(ctx).
+	err := conn(ctx, s.db).
 		Where("name = ? AND owner = ?", RepoInfo.Name, RepoInfo.Owner).
 		First(&repo).Error
 
@@ -41,7 +42,7 @@ func (s *repoStore) Get(ctx context.Context, RepoInfo models.RepoInfo) (models.R
 func (s *repoStore) List(ctx context.Context) ([]models.Repository, error) {
 	var repos []models.Repository
 
-	err := s.db.WithContext(ctx).Find(&repos).Error
+	err := conn(ctx, s.db).Find(&repos).Error
 	if err != nil {
 		return nil, err
 	}
@@ -49,8 +50,28 @@ func (s *repoStore) List(ctx context.Context) ([]models.Repository, error) {
 	return repos, nil
 }
 
+// ListPage returns the page of the repositories the pagination points at, latest
+// added first, ordered by creation time and ID
+func (s *repoStore) ListPage(ctx context.Context, pagination models.PaginationReq) ([]models.Repository, models.Pagination, error) {
+	order := keyset[models.Repository]{
+		timeColumn: "created_at",
+		idColumn:   "id",
+		desc:       true,
+		key:        func(repo models.Repository) (time.Time, string) { return repo.CreatedAt, repo.ID },
+	}
+
+	repos, page, err := order.page(func() *gorm.DB {
+		return conn(ctx, s.db).Model(&models.Repository{})
+	}, pagination)
+	if err != nil {
+		return nil, page, fmt.Errorf("failed to fetch repositories: %w", err)
+	}
+
+	return repos, page, nil
+}
+
 func (s *repoStore) Create(ctx context.Context, repo models.Repository) error {
-	if err := s.db.WithContext(ctx).Create(&repo).Error; err != nil {
+	if err := conn(ctx, s.db).Create(&repo).Error; err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return dErrors.ErrDuplicateRepository
 		}
@@ -63,7 +84,7 @@ func (s *repoStore) Create(ctx context.Context, repo models.Repository) error {
 func (s *repoStore) CheckExists(ctx context.Context, RepoInfo models.RepoInfo) (bool, error) {
 	var count int64
 
-	err := s.db.WithContext(ctx).
+	err := conn(ctx, s.db).
 		Model(&models.Repository{}).
 		Where("name = ? AND owner = ?", RepoInfo.Name, RepoInfo.Owner).
 		Count(&count).Error
@@ -76,9 +97,16 @@ func (s *repoStore) CheckExists(ctx context.Context, RepoInfo models.RepoInfo) (
 }
 
 func (s *repoStore) Reset(ctx context.Context, RepoInfo models.RepoInfo, startTime *time.Time) error {
-	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
 		if err := tx.
-			Where("repo_name = ? AND repo_owner = ?", RepoInfo.Name, RepoInfo.Owner).
+			Where("repository_id IN (?)", tx.Model(&models.Repository{}).Select("id").Where("name = ? AND owner = ?", RepoInfo.Name, RepoInfo.Owner)).
+			Delete(&models.RepositoryCommit{}).Error; err != nil {
+			return err
+		}
+
+		// commits no other repository links to are deleted with the links
+		if err := tx.
+			Where("NOT EXISTS (SELECT 1 FROM repository_commits WHERE repository_commits.sha = commits.sha)").
 			Delete(&models.Commit{}).Error; err != nil {
 			return err
 		}
@@ -116,7 +144,7 @@ func (s *repoStore) UpdateStatus(ctx context.Context, RepoInfo models.RepoInfo,
 		"updated_at": time.Now(),
 	}
 
-	err := s.db.WithContext(ctx).
+	err := conn(ctx, s.db).
 		Model(&models.Repository{}).
 		Where("name = ? AND owner = ?", RepoInfo.Name, RepoInfo.Owner).
 		Updates(updates).Error
@@ -130,8 +158,7 @@ func (s *repoStore) UpdateStatus(ctx context.Context, RepoInfo models.RepoInfo,
 
 func (s *repoStore) UpdateTrackingInfo(ctx context.Context, repoInfo models.RepoInfo, lastFetchedCommitTime time.Time) error {
 	var commitCount int64
-	if err := s.db.Model(&models.Commit{}).
-		Where("repo_name = ? AND repo_owner = ?", repoInfo.Name, repoInfo.Owner).
+	if err := repoCommits(conn(ctx, s.db), repoInfo).
 		Count(&commitCount).Error; err != nil {
 		return fmt.Errorf("failed to count commits: %w", err)
 	}
@@ -146,7 +173,7 @@ func (s *repoStore) UpdateTrackingInfo(ctx context.Context, repoInfo models.Repo
 		"updated_at":                 time.Now(),
 	}
 
-	result := s.db.Model(&models.Repository{}).
+	result := conn(ctx, s.db).Model(&models.Repository{}).
 		Where("name = ? AND owner = ?", repoInfo.Name, repoInfo.Owner).
 		Updates(updates)
 	if result.Error != nil {
@@ -158,3 +185,66 @@ func (s *repoStore) UpdateTrackingInfo(ctx context.Context, repoInfo models.Repo
 
 	return nil
 }
+
+// UpdateSchedule replaces the schedule of a repository, including its next run
+func (s *repoStore) UpdateSchedule(ctx context.Context, repoInfo models.RepoInfo, schedule models.RepoSchedule) error {
+	// updates from a map skip the serializer of the field
+	quietWindows := schedule.QuietWindows
+	if quietWindows == nil {
+		quietWindows = []models.QuietWindow{}
+	}
+	encodedWindows, err := json.Marshal(quietWindows)
+	if err != nil {
+		return fmt.Errorf("failed to encode quiet windows: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"schedule_cron":      schedule.Cron,
+		"schedule_interval":  schedule.Interval,
+		"schedule_enabled":   schedule.Enabled,
+		"schedule_adaptive":  schedule.Adaptive,
+		"next_run_at":        schedule.NextRunAt,
+		"effective_interval": schedule.EffectiveInterval,
+		"interval_reason":    schedule.IntervalReason,
+		"idle_runs":          schedule.IdleRuns,
+		"quiet_windows":      string(encodedWindows),
+		"updated_at":         time.Now(),
+	}
+
+	result := conn(ctx, s.db).Model(&models.Repository{}).
+		Where("name = ? AND owner = ?", repoInfo.Name, repoInfo.Owner).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update repository schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return dErrors.ErrRepositoryNotFound
+	}
+
+	return nil
+}
+
+// UpdateScheduleRun records a run of the scheduler on a repository: when it ran,
+// when it runs next and the interval it runs at. The run is computed from the
+// schedule read when the sweep started, so it is only recorded while that
+// schedule is unchanged: a schedule updated since keeps the next run and
+// interval it was saved with, rather than have them overwritten by the run.
+func (s *repoStore) UpdateScheduleRun(ctx context.Context, repoID string, schedule models.RepoSchedule) error {
+	updates := map[string]interface{}{
+		"next_run_at":        schedule.NextRunAt,
+		"last_run_at":        schedule.LastRunAt,
+		"effective_interval": schedule.EffectiveInterval,
+		"interval_reason":    schedule.IntervalReason,
+		"idle_runs":          schedule.IdleRuns,
+	}
+
+	err := conn(ctx, s.db).Model(&models.Repository{}).
+		Where("id = ?", repoID).
+		Where("schedule_cron = ? AND schedule_interval = ? AND schedule_enabled = ? AND schedule_adaptive = ?",
+			schedule.Cron, schedule.Interval, schedule.Enabled, schedule.Adaptive).
+		Updates(updates).Error
+	if err != nil {
+		return fmt.Errorf("failed to update repository schedule run: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"gorm.io/gorm"
+)
+
+// schedulerStateID is the ID of the single row of the scheduler state
+const schedulerStateID = 1
+
+type schedulerStore struct {
+	db *gorm.DB
+}
+
+func (s *store) NewSchedulerStore() *schedulerStore {
+	return &schedulerStore{
+		db: s.db,
+	}
+}
+
+// Get returns the state of the scheduler
+func (s *schedulerStore) Get(ctx context.Context) (models.SchedulerState, error) {
+	var state models.SchedulerState
+	err := conn(ctx, s.db).
+		Where("id = ?", schedulerStateID).
+		Limit(1).
+		Find(&state).Error
+	if err != nil {
+		return models.SchedulerState{}, fmt.Errorf("failed to get scheduler state: %w", err)
+	}
+	return state, nil
+}
+
+// SetPaused pauses or resumes the scheduler. The time it was paused at is kept
+// when it was already paused, and cleared when it is resumed.
+func (s *schedulerStore) SetPaused(ctx context.Context, paused bool) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"paused":     paused,
+		"paused_at":  nil,
+		"updated_at": now,
+	}
+	if paused {
+		updates["paused_at"] = gorm.Expr("CASE WHEN paused THEN paused_at ELSE ? END", now)
+	}
+
+	err := conn(ctx, s.db).Model(&models.SchedulerState{}).
+		Where("id = ?", schedulerStateID).
+		Updates(updates).Error
+	if err != nil {
+		return fmt.Errorf("failed to update scheduler pause: %w", err)
+	}
+	return nil
+}
+
+// RequestRun asks the scheduler for a sweep of every repository
+func (s *schedulerStore) RequestRun(ctx context.Context, at time.Time) error {
+	err := conn(ctx, s.db).Model(&models.SchedulerState{}).
+		Where("id = ?", schedulerStateID).
+		Updates(map[string]interface{}{
+			"run_requested_at": at,
+			"updated_at":       time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to request scheduler run: %w", err)
+	}
+	return nil
+}
+
+// RecordRun records the last sweep of the scheduler, leaving its pause and run
+// request as they are
+func (s *schedulerStore) RecordRun(ctx context.Context, state models.SchedulerState) error {
+	err := conn(ctx, s.db).Model(&models.SchedulerState{ID: schedulerStateID}).
+		Select("last_run_started_at", "last_run_finished_at", "next_run_at", "last_dispatched", "last_deferred", "last_skipped", "last_errors", "updated_at").
+		Updates(models.SchedulerState{
+			LastRunStartedAt:  state.LastRunStartedAt,
+			LastRunFinishedAt: state.LastRunFinishedAt,
+			NextRunAt:         state.NextRunAt,
+			LastDispatched:    state.LastDispatched,
+			LastDeferred:      state.LastDeferred,
+			LastSkipped:       state.LastSkipped,
+			LastErrors:        state.LastErrors,
+			UpdatedAt:         state.LastRunFinishedAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record scheduler run: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+const (
+	// highlightStart and highlightEnd surround the matching words of a snippet
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	// snippetWords is about how many words of a message a snippet shows
+	snippetWords = 16
+)
+
+// ftsQuery renders a search expression as an SQLite FTS5 query
+func ftsQuery(expr models.SearchExpr) string {
+	switch expr.Op {
+	case models.SearchOpAnd:
+		return "(" + ftsQuery(expr.Operands[0]) + " AND " + ftsQuery(expr.Operands[1]) + ")"
+	case models.SearchOpOr:
+		return "(" + ftsQuery(expr.Operands[0]) + " OR " + ftsQuery(expr.Operands[1]) + ")"
+	case models.SearchOpNot:
+		return "(" + ftsQuery(expr.Operands[0]) + " NOT " + ftsQuery(expr.Operands[1]) + ")"
+	}
+
+	// words only hold letters and digits, so they need no escaping
+	phrase := `"` + strings.Join(expr.Words, " ") + `"`
+	if expr.Prefix {
+		phrase += " *"
+	}
+	return phrase
+}
+
+// tsQuery renders a search expression as a Postgres tsquery, for to_tsquery
+func tsQuery(expr models.SearchExpr) string {
+	switch expr.Op {
+	case models.SearchOpAnd:
+		return "(" + tsQuery(expr.Operands[0]) + " & " + tsQuery(expr.Operands[1]) + ")"
+	case models.SearchOpOr:
+		return "(" + tsQuery(expr.Operands[0]) + " | " + tsQuery(expr.Operands[1]) + ")"
+	case models.SearchOpNot:
+		return "(" + tsQuery(expr.Operands[0]) + " & !" + tsQuery(expr.Operands[1]) + ")"
+	}
+
+	lexemes := make([]string, len(expr.Words))
+	for i, word := range expr.Words {
+		lexemes[i] = "'" + word + "'"
+	}
+	if expr.Prefix {
+		lexemes[len(lexemes)-1] += ":*"
+	}
+	return "(" + strings.Join(lexemes, " <-> ") + ")"
+}
+
+// encodeOffsetCursor returns an opaque cursor pointing at the given offset of
+// the results of a search
+func encodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeOffsetCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
@@ -1,13 +1,35 @@
 package store
 
-import "gorm.io/gorm"
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
 
 type store struct {
 	db *gorm.DB
 }
 
+type txKey struct{}
+
 func New(db *gorm.DB) *store {
 	return &store{
 		db: db,
 	}
 }
+
+// Transaction runs fn inside a database transaction. Any store method called with
+// the context passed to fn takes part in that same transaction.
+func (s *store) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return conn(ctx, s.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn returns the transaction carried by ctx, if any, or the given db otherwise
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"time"
 
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type taskStore struct {
@@ -22,12 +24,30 @@ func (s *store) NewTaskStore() *taskStore {
 
 func (s *taskStore) Get(ctx context.Context, taskID string) (models.Task, error) {
 	var task models.Task
-	err := s.db.WithContext(ctx).
+	err := conn(ctx, s.db).
 		Where("id = ?", taskID).
 		First(&task).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return models.Task{}, fmt.Errorf("task not found: %w", err)
+			return models.Task{}, dErrors.ErrTaskNotFound.WithError(err)
+		}
+		return models.Task{}, err
+	}
+	return task, nil
+}
+
+// GetForUpdate retrieves a task and locks its row until the transaction of ctx
+// ends, so that concurrent writers of the task wait for it. SQLite has no row
+// locks, and serialises writers instead.
+func (s *taskStore) GetForUpdate(ctx context.Context, taskID string) (models.Task, error) {
+	var task models.Task
+	err := conn(ctx, s.db).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", taskID).
+		First(&task).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Task{}, dErrors.ErrTaskNotFound.WithError(err)
 		}
 		return models.Task{}, err
 	}
@@ -35,37 +55,250 @@ func (s *taskStore) Get(ctx context.Context, taskID string) (models.Task, error)
 }
 
 func (s *taskStore) Create(ctx context.Context, task models.Task) error {
-	return s.db.WithContext(ctx).Create(&task).Error
+	return conn(ctx, s.db).Create(&task).Error
+}
+
+// List returns the page of the tasks matching the filter the pagination points
+// at, ordered by creation time and ID
+func (s *taskStore) List(ctx context.Context, filter models.TaskFilter, pagination models.PaginationReq) ([]models.Task, models.Pagination, error) {
+	order := keyset[models.Task]{
+		timeColumn: "created_at",
+		idColumn:   "id",
+		desc:       filter.SortOrder != models.SortOrderAsc,
+		key:        func(task models.Task) (time.Time, string) { return task.CreatedAt, task.ID },
+	}
+
+	tasks, page, err := order.page(func() *gorm.DB {
+		query := filterTasks(conn(ctx, s.db).Model(&models.Task{}), filter)
+		if len(filter.Statuses) > 0 {
+			query = query.Where("status IN ?", filter.Statuses)
+		}
+		return query
+	}, pagination)
+	if err != nil {
+		return nil, page, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	return tasks, page, nil
+}
+
+// CountByStatus counts the tasks matching the filter in every status, ignoring
+// the statuses of the filter
+func (s *taskStore) CountByStatus(ctx context.Context, filter models.TaskFilter) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := filterTasks(conn(ctx, s.db).Model(&models.Task{}), filter).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tasks: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// CountActiveByOwner counts the tasks fetching or about to fetch, i.e. pending,
+// in progress or cancelling, of the repositories of every owner
+func (s *taskStore) CountActiveByOwner(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		RepoOwner string
+		Count     int64
+	}
+	err := conn(ctx, s.db).Model(&models.Task{}).
+		Select("repo_owner, COUNT(*) AS count").
+		Where("status IN ?", []string{models.TaskStatusPending, models.TaskStatusInProgress, models.TaskStatusCancelling}).
+		Group("repo_owner").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active tasks: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RepoOwner] = row.Count
+	}
+	return counts, nil
 }
 
-func (s *taskStore) List(ctx context.Context) ([]models.Task, error) {
+func filterTasks(query *gorm.DB, filter models.TaskFilter) *gorm.DB {
+	if len(filter.TriggerTypes) > 0 {
+		query = query.Where("trigger_type IN ?", filter.TriggerTypes)
+	}
+	if filter.RepoOwner != "" {
+		query = query.Where("repo_owner = ?", filter.RepoOwner)
+	}
+	if filter.RepoName != "" {
+		query = query.Where("repo_name = ?", filter.RepoName)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	return query
+}
+
+// ListByStatus returns the tasks in any of the given statuses, oldest first
+func (s *taskStore) ListByStatus(ctx context.Context, statuses ...string) ([]models.Task, error) {
 	var tasks []models.Task
-	err := s.db.WithContext(ctx).Find(&tasks).Error
+	err := conn(ctx, s.db).
+		Where("status IN ?", statuses).
+		Order("created_at").
+		Find(&tasks).Error
 	if err != nil {
 		return nil, err
 	}
 	return tasks, nil
 }
 
-func (s *taskStore) UpdateStatus(ctx context.Context, taskID string, status string, errMsg *string) error {
+// SetRetries records the number of automatic retries of a task
+func (s *taskStore) SetRetries(ctx context.Context, taskID string, retries int) error {
+	err := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ?", taskID).
+		Update("retries", retries).Error
+	if err != nil {
+		return fmt.Errorf("failed to set task retries: %w", err)
+	}
+	return nil
+}
+
+// RaisePriority raises the priority of a task to the given one, leaving a task
+// with a higher priority unchanged
+func (s *taskStore) RaisePriority(ctx context.Context, taskID string, priority int) error {
+	err := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ? AND priority < ?", taskID, priority).
+		Update("priority", priority).Error
+	if err != nil {
+		return fmt.Errorf("failed to raise task priority: %w", err)
+	}
+	return nil
+}
+
+// Heartbeat records that the task is alive as of at, which is in the future when
+// its fetch is waiting to resume
+func (s *taskStore) Heartbeat(ctx context.Context, taskID string, at time.Time) error {
+	err := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ?", taskID).
+		Update("heartbeat_at", at).Error
+	if err != nil {
+		return fmt.Errorf("failed to record task heartbeat: %w", err)
+	}
+	return nil
+}
+
+// ListStale returns the unfinished tasks, other than queued ones, with no
+// heartbeat or status change since before
+func (s *taskStore) ListStale(ctx context.Context, before time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	err := conn(ctx, s.db).
+		Where("status IN ?", []string{models.TaskStatusPending, models.TaskStatusInProgress, models.TaskStatusCancelling}).
+		Where("COALESCE(heartbeat_at, created_at) < ?", before).
+		Order("created_at").
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// ClaimStale records a heartbeat at for a task with no heartbeat or status change
+// since before, and reports whether it did. Of the instances that find the same
+// stale task, only the first to claim it gets true.
+func (s *taskStore) ClaimStale(ctx context.Context, taskID string, before, at time.Time) (bool, error) {
+	result := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ? AND COALESCE(heartbeat_at, created_at) < ?", taskID, before).
+		Update("heartbeat_at", at)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim stale task: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListForRepo returns the tasks of a repository in any of the given statuses,
+// highest priority first, then oldest first
+func (s *taskStore) ListForRepo(ctx context.Context, repoID string, statuses ...string) ([]models.Task, error) {
+	var tasks []models.Task
+	err := conn(ctx, s.db).
+		Where("repository_id = ? AND status IN ?", repoID, statuses).
+		Order("priority DESC").
+		Order("created_at").
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// UpdateStatus moves a task to the given status, provided its current status is
+// one of from, and keeps the lifecycle timestamps and attempt count in step. It
+// returns ErrInvalidTaskTransition when the task is in any other status, so that
+// concurrent workers can't move a task out of a state it has already left.
+func (s *taskStore) UpdateStatus(ctx context.Context, taskID string, from []string, status string, errMsg *string) error {
+	now := time.Now()
 	updates := map[string]interface{}{
-		"status":     status,
-		"updated_at": time.Now(),
+		"status":       status,
+		"updated_at":   now,
+		"heartbeat_at": now,
 	}
 	if errMsg != nil {
 		updates["error_message"] = *errMsg
 	}
-	if status == models.TaskStatusCompleted {
-		updates["completed_at"] = time.Now()
+	switch status {
+	case models.TaskStatusQueued, models.TaskStatusPending:
+		// a failed task is queued or pending again when it is retried
+		updates["error_message"] = ""
+		updates["finished_at"] = nil
+		if status == models.TaskStatusPending {
+			// a queued task fetches the commits up to when it is let through,
+			// while a retried one keeps the window its checkpoint is for
+			updates["until"] = gorm.Expr("CASE WHEN status = ? AND attempt_count = 0 THEN ? ELSE until END", models.TaskStatusQueued, now)
+		}
+	case models.TaskStatusInProgress:
+		updates["started_at"] = gorm.Expr("COALESCE(started_at, ?)", now)
+		updates["attempt_count"] = gorm.Expr("attempt_count + 1")
+	case models.TaskStatusCompleted:
+		updates["completed_at"] = now
+		updates["finished_at"] = now
+	case models.TaskStatusFailed, models.TaskStatusCancelled:
+		updates["finished_at"] = now
 	}
-	result := s.db.Model(&models.Task{}).
-		Where("id = ?", taskID).
+	result := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ? AND status IN ?", taskID, from).
 		Updates(updates)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update task status: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		if _, err := s.Get(ctx, taskID); err != nil {
+			return err
+		}
+		return dErrors.ErrInvalidTaskTransition
+	}
+
+	return nil
+}
+
+// SetTotalBatches records the number of batches fetched for a task once its fetch has finished
+func (s *taskStore) SetTotalBatches(ctx context.Context, taskID string, total int) error {
+	result := conn(ctx, s.db).Model(&models.Task{}).
+		Where("id = ?", taskID).
+		Updates(map[string]interface{}{
+			"total_batches": total,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update task total batches: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return dErrors.ErrTaskNotFound
 	}
 
 	return nil
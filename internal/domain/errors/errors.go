@@ -58,6 +58,11 @@ var (
 	ErrInternalServer            = DomainError{"InternalServer", "internal server error", nil}
 	ErrInvalidResponse           = DomainError{"InvalidResponse", "invalid response from GitHub API", nil}
 	ErrTaskNotFound               = DomainError{"ErrTaskNotFound", "job not found", nil}
+	ErrInvalidTaskTransition     = DomainError{"InvalidTaskTransition", "The task can't move to the requested status from its current status.", nil}
+	ErrTaskCancelled             = DomainError{"TaskCancelled", "The task has been cancelled.", nil}
+	ErrLeaseLost                 = DomainError{"RepositoryLeaseLost", "Another task has taken over fetching this repository.", nil}
+	ErrMessageAlreadyProcessed   = DomainError{"MessageAlreadyProcessed", "message has already been processed by this consumer", nil}
+	ErrQuietWindow               = DomainError{"QuietWindow", "The repository is in a quiet window, during which fetches are held back. Trigger it with override=true to fetch it anyway.", nil}
 )
 
 type BatchError struct {
@@ -70,10 +75,33 @@ func (be BatchError) Error() string {
 	return fmt.Sprintf("batch error (since: %v, batchSize: %d): %v", be.Since, be.BatchSize, be.Err)
 }
 
+func (be BatchError) Unwrap() error {
+	return be.Err
+}
+
 func NewBatchError(since *time.Time, batchSize int, err error) BatchError {
 	return BatchError{
 		Since:     since,
 		BatchSize: batchSize,
 		Err:       err,
 	}
+}
+
+// RateLimitError is an ErrRateLimitExceeded that knows when the rate limit resets
+type RateLimitError struct {
+	ResetAt time.Time
+}
+
+func (re RateLimitError) Error() string {
+	return fmt.Sprintf("%v, resets at %s", ErrRateLimitExceeded, re.ResetAt.Format(time.RFC3339))
+}
+
+func (re RateLimitError) Unwrap() error {
+	return ErrRateLimitExceeded
+}
+
+func NewRateLimitError(resetAt time.Time) RateLimitError {
+	return RateLimitError{
+		ResetAt: resetAt,
+	}
 }
\ No newline at end of file
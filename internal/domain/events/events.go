@@ -11,17 +11,25 @@ var (
 	SaveCommitEventTopic  = "save_commit_event"
 )
 
+// Schema versions of the event payloads, bumped on breaking changes
+const (
+	FetchCommitEventVersion = 1
+	SaveCommitEventVersion  = 1
+)
+
 type (
 	FetchCommitEvent struct {
 		models.RepoInfo
 		TaskID string
 		RepoID string
 		Since  time.Time
+		Until  time.Time
 	}
 
 	SaveCommitEvent struct {
 		models.RepoInfo
 		TaskID  string
+		BatchID int
 		Commits []models.Commit
 	}
 )
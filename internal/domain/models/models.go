@@ -20,10 +20,83 @@ func NewUUIDWithPrefix(prefix string) string {
 }
 
 const (
+	TaskStatusQueued     = "queued"
 	TaskStatusPending    = "pending"
 	TaskStatusInProgress = "in_progress"
+	TaskStatusCancelling = "cancelling"
 	TaskStatusCompleted  = "completed"
 	TaskStatusFailed     = "failed"
+	TaskStatusCancelled  = "cancelled"
+)
+
+var TaskStatuses = []string{
+	TaskStatusQueued,
+	TaskStatusPending,
+	TaskStatusInProgress,
+	TaskStatusCancelling,
+	TaskStatusCompleted,
+	TaskStatusFailed,
+	TaskStatusCancelled,
+}
+
+// Trigger types tell what created a task
+const (
+	TriggerTypeScheduled = "scheduled"
+	TriggerTypeManual    = "manual"
+	TriggerTypeReset     = "reset"
+	TriggerTypeWebhook   = "webhook"
+)
+
+var TriggerTypes = []string{
+	TriggerTypeScheduled,
+	TriggerTypeManual,
+	TriggerTypeReset,
+	TriggerTypeWebhook,
+}
+
+// Task priorities order the fetches waiting to run, the highest first. A manual
+// fetch jumps ahead of webhook ones, which jump ahead of scheduled sweeps, and the
+// first fetch of a repository, which backfills its whole history, comes last.
+const (
+	TaskPriorityBackfill  = 0
+	TaskPriorityScheduled = 1
+	TaskPriorityWebhook   = 2
+	TaskPriorityManual    = 3
+)
+
+const (
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+// Task event types tell what changed in a task. A done event is sent when the
+// task finishes, instead of a status event.
+const (
+	TaskEventStatus = "status"
+	TaskEventBatch  = "batch"
+	TaskEventDone   = "done"
+)
+
+const (
+	AttemptStatusRunning     = "running"
+	AttemptStatusSucceeded   = "succeeded"
+	AttemptStatusFailed      = "failed"
+	AttemptStatusRescheduled = "rescheduled"
+	AttemptStatusCancelled   = "cancelled"
+)
+
+// Scheduler states tell whether the scheduler is sweeping the repositories. The
+// scheduler is stopped when no instance holds its leader lease.
+const (
+	SchedulerStateRunning = "running"
+	SchedulerStatePaused  = "paused"
+	SchedulerStateStopped = "stopped"
+)
+
+const (
+	BatchStatusFetched = "fetched"
+	BatchStatusSaved   = "saved"
+	BatchStatusFailed  = "failed"
 )
 
 type (
@@ -47,29 +120,201 @@ type (
 		RepoUpdatedAt           time.Time  `json:"repo_updated_at"`
 		CreatedAt               time.Time  `json:"created_at"`
 		UpdatedAt               *time.Time `json:"updated_at"`
+
+		Schedule RepoSchedule `json:"schedule" gorm:"embedded"`
+	}
+
+	// RepoSchedule decides when the scheduler fetches a repository: on its cron
+	// expression, every interval, or every default interval when it has neither
+	RepoSchedule struct {
+		Cron     string `json:"cron,omitempty" gorm:"column:schedule_cron"`
+		Interval string `json:"interval,omitempty" gorm:"column:schedule_interval"`
+		Enabled  bool   `json:"enabled" gorm:"column:schedule_enabled"`
+		// Adaptive widens the interval while the runs of the repository find no
+		// new commits, and narrows it again once they do
+		Adaptive bool `json:"adaptive" gorm:"column:schedule_adaptive"`
+		// NextRunAt is when the repository is next due, nil until the scheduler
+		// first sees it or while the schedule is disabled
+		NextRunAt *time.Time `json:"next_run_at" gorm:"column:next_run_at"`
+		// LastRunAt is when the scheduler last started a fetch of the repository
+		LastRunAt *time.Time `json:"last_run_at" gorm:"column:last_run_at"`
+		// EffectiveInterval is the interval the repository is fetched at, empty
+		// when it is fetched on a cron expression, and IntervalReason tells why
+		EffectiveInterval string `json:"effective_interval,omitempty" gorm:"column:effective_interval"`
+		IntervalReason    string `json:"interval_reason,omitempty" gorm:"column:interval_reason"`
+		// IdleRuns counts the consecutive runs that found no new commits
+		IdleRuns int `json:"idle_runs" gorm:"column:idle_runs"`
+		// QuietWindows are the windows of the repository, on top of the global
+		// ones, during which its scheduled fetches are skipped or throttled
+		QuietWindows []QuietWindow `json:"quiet_windows" gorm:"column:quiet_windows;serializer:json"`
+	}
+
+	// QuietWindow is a recurring window during which scheduled fetches are
+	// skipped, or throttled to a budget of tasks fetching at once
+	QuietWindow struct {
+		// Cron is when the window opens, in the standard five field format and
+		// the local time zone unless prefixed with CRON_TZ=<zone>
+		Cron string `json:"cron"`
+		// Duration is how long the window stays open, such as 8h
+		Duration string `json:"duration"`
+		Mode     string `json:"mode"`
+		Budget   int    `json:"budget,omitempty"`
 	}
 
+	// ScheduleUpdate holds the schedule fields to change, nil fields are kept.
+	// Setting the cron expression clears the interval and the other way round,
+	// and clearing both falls back to the default interval.
+	ScheduleUpdate struct {
+		Cron     *string `json:"cron"`
+		Interval *string `json:"interval"`
+		Enabled  *bool   `json:"enabled"`
+		Adaptive *bool   `json:"adaptive"`
+		// QuietWindows replaces the quiet windows of the repository, an empty
+		// list clears them
+		QuietWindows *[]QuietWindow `json:"quiet_windows"`
+	}
+
+	// Commit is a commit as seen from a repository it was fetched for. The commit
+	// itself is stored once, and the repository fields, read only, come from its
+	// link to the repository.
 	Commit struct {
 		ID           string     `json:"id"`
 		SHA          string     `json:"sha"`
-		RepositoryID string     `json:"repository_id"`
-		RepoName     string     `json:"repo_name"`
-		RepoOwner    string     `json:"repo_owner"`
+		RepositoryID string     `json:"repository_id" gorm:"->"`
+		RepoName     string     `json:"repo_name" gorm:"->"`
+		RepoOwner    string     `json:"repo_owner" gorm:"->"`
 		Message      string     `json:"message"`
 		Author       string     `json:"author"`
 		AuthorEmail  string     `json:"author_email"`
 		Date         time.Time  `json:"date"`
-		URL          string     `json:"url"`
+		URL          string     `json:"url" gorm:"->"`
 		CreatedAt    time.Time  `json:"created_at"`
 		UpdatedAt    *time.Time `json:"updated_at"`
 	}
 
+	// RepositoryCommit links a commit to a repository it was fetched for, so that
+	// a commit shared by several repositories, e.g. a fork and its upstream, is
+	// stored once and listed for each of them.
+	RepositoryCommit struct {
+		RepositoryID string    `json:"repository_id" gorm:"primaryKey"`
+		SHA          string    `json:"sha" gorm:"primaryKey"`
+		URL          string    `json:"url"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+
+	// SearchExpr is a parsed full-text search query. It is either a phrase of one
+	// or more words, matching them next to each other, or an operator combining
+	// other expressions.
+	SearchExpr struct {
+		// Op is SearchOpAnd, SearchOpOr or SearchOpNot, empty for a phrase. A
+		// SearchOpNot matches its first operand but not its second one.
+		Op       string       `json:"op,omitempty"`
+		Operands []SearchExpr `json:"operands,omitempty"`
+		// Words are the lowercase words of the phrase
+		Words []string `json:"words,omitempty"`
+		// Prefix matches the last word of the phrase as a prefix
+		Prefix bool `json:"prefix,omitempty"`
+	}
+
+	// CommitMatch is a commit matching a search, with the matching part of its
+	// message highlighted and its relevance, higher for better matches
+	CommitMatch struct {
+		Commit
+		Snippet string  `json:"snippet"`
+		Score   float64 `json:"score"`
+	}
+
+	// RepoLease gives a task the exclusive right to fetch a repository until it
+	// expires. The lease is renewed while the fetch makes progress, so it only
+	// expires when the worker holding it has died.
+	RepoLease struct {
+		RepositoryID string    `json:"repository_id" gorm:"primaryKey"`
+		TaskID       string    `json:"task_id"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+
+	// LeaderLease makes one instance of the app the leader of a role, such as
+	// running the scheduler, until it expires. The leader renews it while it is
+	// alive, so another instance only takes over once the leader has died.
+	LeaderLease struct {
+		Name      string    `json:"name" gorm:"primaryKey"`
+		OwnerID   string    `json:"owner_id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// SchedulerState is the single row shared by the instances of the app to
+	// control the scheduler, run by the leader, and record its last sweep
+	SchedulerState struct {
+		ID       int        `json:"-" gorm:"primaryKey"`
+		Paused   bool       `json:"paused"`
+		PausedAt *time.Time `json:"paused_at"`
+		// RunRequestedAt is when a sweep of every repository was last requested,
+		// pending until a sweep starts after it
+		RunRequestedAt    *time.Time `json:"run_requested_at"`
+		LastRunStartedAt  *time.Time `json:"last_run_started_at"`
+		LastRunFinishedAt *time.Time `json:"last_run_finished_at"`
+		NextRunAt         *time.Time `json:"next_run_at"`
+		// LastDispatched lists the repositories whose tasks the last sweep started,
+		// LastDeferred counts the due ones it held back over the dispatch caps or
+		// the budget of a quiet window, and LastSkipped the due ones it put off
+		// until a quiet window closes
+		LastDispatched []DispatchedRepo `json:"last_dispatched" gorm:"serializer:json"`
+		LastDeferred   int              `json:"last_deferred"`
+		LastSkipped    int              `json:"last_skipped"`
+		LastErrors     []string         `json:"last_errors" gorm:"serializer:json"`
+		UpdatedAt      *time.Time       `json:"updated_at"`
+	}
+
+	DispatchedRepo struct {
+		Owner  string `json:"owner"`
+		Name   string `json:"name"`
+		TaskID string `json:"task_id,omitempty"`
+	}
+
+	SchedulerStatus struct {
+		State string `json:"state"`
+		// Leader is the ID of the instance running the scheduler
+		Leader          string     `json:"leader,omitempty"`
+		LeaderExpiresAt *time.Time `json:"leader_expires_at,omitempty"`
+		// QuietWindow is the global quiet window open now, if any, and QuietUntil
+		// when it closes
+		QuietWindow *QuietWindow `json:"quiet_window,omitempty"`
+		QuietUntil  *time.Time   `json:"quiet_until,omitempty"`
+		SchedulerState
+	}
+
+	// TaskCheckpoint records how far the fetch of a task got, so that an
+	// interrupted task resumes after the last page whose commits were saved
+	TaskCheckpoint struct {
+		TaskID           string    `json:"task_id" gorm:"primaryKey"`
+		Page             int       `json:"page"`
+		Until            time.Time `json:"until"`
+		OldestCommitTime time.Time `json:"oldest_commit_time"`
+		UpdatedAt        time.Time `json:"updated_at"`
+	}
+
 	BatchDetail struct {
-		BatchID      int       `json:"batch_id"`
-		StartTime    time.Time `json:"start_time"`
-		EndTime      time.Time `json:"end_time"`
-		Status       string    `json:"status"`
-		ErrorMessage string    `json:"error_message"`
+		TaskID           string     `json:"task_id"`
+		BatchID          int        `json:"batch_id"`
+		CommitCount      int        `json:"commit_count"`
+		OldestCommitTime time.Time  `json:"oldest_commit_time"`
+		NewestCommitTime time.Time  `json:"newest_commit_time"`
+		Status           string     `json:"status"`
+		ErrorMessage     string     `json:"error_message"`
+		FetchedAt        time.Time  `json:"fetched_at"`
+		SavedAt          *time.Time `json:"saved_at"`
+	}
+
+	TaskProgress struct {
+		BatchesFetched        int        `json:"batches_fetched"`
+		BatchesSaved          int        `json:"batches_saved"`
+		BatchesFailed         int        `json:"batches_failed"`
+		TotalBatches          *int       `json:"total_batches"`
+		CommitsFetched        int        `json:"commits_fetched"`
+		CommitsSaved          int        `json:"commits_saved"`
+		OldestCommitTime      *time.Time `json:"oldest_commit_time"`
+		PercentComplete       float64    `json:"percent_complete"`
+		EstimatedCompletionAt *time.Time `json:"estimated_completion_at"`
 	}
 
 	Task struct {
@@ -78,15 +323,92 @@ type (
 		RepoName     string     `json:"repo_name"`
 		RepoOwner    string     `json:"repo_owner"`
 		Status       string     `json:"status"`
+		TriggerType  string     `json:"trigger_type"`
+		Priority     int        `json:"priority"`
+		Since        *time.Time `json:"since"`
+		Until        *time.Time `json:"until"`
+		TotalBatches *int       `json:"total_batches"`
+		AttemptCount int        `json:"attempt_count"`
+		Retries      int        `json:"retries"`
+		StartedAt    *time.Time `json:"started_at"`
+		HeartbeatAt  *time.Time `json:"heartbeat_at"`
+		FinishedAt   *time.Time `json:"finished_at"`
 		CompletedAt  *time.Time `json:"completed_at"`
 		ErrorMessage string     `json:"error_message"`
 		CreatedAt    time.Time  `json:"created_at"`
 		UpdatedAt    *time.Time `json:"updated_at"`
+
+		Progress *TaskProgress `json:"progress,omitempty" gorm:"-"`
+		Batches  []BatchDetail `json:"batches,omitempty" gorm:"-"`
+		Attempts []TaskAttempt `json:"attempts,omitempty" gorm:"-"`
+	}
+
+	// TaskAttempt records one run of the fetch of a task
+	TaskAttempt struct {
+		TaskID       string     `json:"task_id"`
+		Attempt      int        `json:"attempt"`
+		Status       string     `json:"status"`
+		ErrorMessage string     `json:"error_message"`
+		StartedAt    time.Time  `json:"started_at"`
+		FinishedAt   *time.Time `json:"finished_at"`
+		// RetryAt is when the next attempt is due, for an attempt that failed
+		// with a transient error or was rescheduled
+		RetryAt *time.Time `json:"retry_at"`
+	}
+
+	// TaskEvent is a change to a task, sent to the clients watching it
+	TaskEvent struct {
+		Type         string        `json:"type"`
+		TaskID       string        `json:"task_id"`
+		RepoOwner    string        `json:"repo_owner"`
+		RepoName     string        `json:"repo_name"`
+		Status       string        `json:"status"`
+		ErrorMessage string        `json:"error_message,omitempty"`
+		Batch        *BatchDetail  `json:"batch,omitempty"`
+		Progress     *TaskProgress `json:"progress,omitempty"`
+		At           time.Time     `json:"at"`
+	}
+
+	// TaskEventFilter selects the task events received. Empty fields match every task.
+	TaskEventFilter struct {
+		TaskID    string
+		RepoOwner string
+		RepoName  string
+	}
+
+	ProcessedMessage struct {
+		MessageID   string    `json:"message_id"`
+		Consumer    string    `json:"consumer"`
+		Topic       string    `json:"topic"`
+		ProcessedAt time.Time `json:"processed_at"`
+	}
+
+	// TaskFilter selects the tasks listed. Empty fields match every task.
+	TaskFilter struct {
+		Statuses      []string
+		TriggerTypes  []string
+		RepoOwner     string
+		RepoName      string
+		CreatedAfter  *time.Time
+		CreatedBefore *time.Time
+		// SortOrder orders tasks by creation time, newest first by default
+		SortOrder string
+	}
+
+	TaskList struct {
+		Tasks      []Task     `json:"tasks"`
+		Pagination Pagination `json:"-"`
+		// Summary counts the tasks in every status, for all filters but the status
+		Summary map[string]int64 `json:"summary"`
 	}
 
 	PaginationReq struct {
+		// Cursor is the next or previous cursor of another page, empty for the
+		// first page
 		Cursor string `json:"cursor"`
 		Limit  int    `json:"limit"`
+		// IncludeTotal counts the items of the whole list
+		IncludeTotal bool `json:"include_total"`
 	}
 
 	CommitsResponse struct {
@@ -96,10 +418,10 @@ type (
 	}
 
 	Pagination struct {
-		TotalCount     int64  `json:"total_count"`     // Total number of commits in the repository
-		NextCursor     string `json:"next_cursor"`     // Cursor for the next page
-		PreviousCursor string `json:"previous_cursor"` // Cursor for the previous page
-		Limit          int    `json:"limit"`           // Number of commits per page
+		TotalCount     *int64 `json:"total_count"`     // Total number of items in the list, when requested
+		NextCursor     string `json:"next_cursor"`     // Cursor for the next page, empty on the last page
+		PreviousCursor string `json:"previous_cursor"` // Cursor for the previous page, empty on the first page
+		Limit          int    `json:"limit"`           // Number of items per page
 	}
 
 	CommitResponse struct {
@@ -122,6 +444,8 @@ type (
 		RepoInfo RepoInfo   `json:"repo_info"`
 		Since    *time.Time `json:"since"`
 		Until    *time.Time `json:"until"`
+		// Page is the first page to fetch, from 1
+		Page int `json:"page"`
 	}
 
 	GetCommitsStreamResponse struct {
@@ -130,3 +454,40 @@ type (
 		DoneChan <-chan struct{}
 	}
 )
+
+// Finished reports whether the task has completed, failed or been cancelled
+func (t Task) Finished() bool {
+	switch t.Status {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewTaskEvent returns the event for the current state of a task, a done event
+// once the task has finished
+func NewTaskEvent(task Task) TaskEvent {
+	eventType := TaskEventStatus
+	if task.Finished() {
+		eventType = TaskEventDone
+	}
+
+	return TaskEvent{
+		Type:         eventType,
+		TaskID:       task.ID,
+		RepoOwner:    task.RepoOwner,
+		RepoName:     task.RepoName,
+		Status:       task.Status,
+		ErrorMessage: task.ErrorMessage,
+		Progress:     task.Progress,
+		At:           time.Now(),
+	}
+}
+
+// Matches reports whether the filter selects the event
+func (f TaskEventFilter) Matches(event TaskEvent) bool {
+	return (f.TaskID == "" || f.TaskID == event.TaskID) &&
+		(f.RepoOwner == "" || f.RepoOwner == event.RepoOwner) &&
+		(f.RepoName == "" || f.RepoName == event.RepoName)
+}
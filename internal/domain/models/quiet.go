@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// QuietModeSkip skips the scheduled fetches falling in a quiet window
+	QuietModeSkip = "skip"
+	// QuietModeThrottle holds the scheduled fetches in a quiet window to the
+	// budget of the window
+	QuietModeThrottle = "throttle"
+)
+
+// MaxQuietWindowDuration is the longest a quiet window stays open
+const MaxQuietWindowDuration = 7 * 24 * time.Hour
+
+// Validate checks that the window opens on a valid cron expression, stays open
+// for a valid duration, and has a budget when it throttles fetches
+func (w QuietWindow) Validate() error {
+	if _, err := cron.ParseStandard(w.Cron); err != nil {
+		return fmt.Errorf("invalid quiet window cron expression: %w", err)
+	}
+
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid quiet window duration: %w", err)
+	}
+	if duration < time.Minute || duration > MaxQuietWindowDuration {
+		return fmt.Errorf("quiet window duration must be between %s and %s", time.Minute, MaxQuietWindowDuration)
+	}
+
+	switch w.Mode {
+	case QuietModeSkip:
+		if w.Budget != 0 {
+			return errors.New("a quiet window skipping fetches has no budget")
+		}
+	case QuietModeThrottle:
+		if w.Budget <= 0 {
+			return errors.New("a quiet window throttling fetches needs a positive budget")
+		}
+	default:
+		return fmt.Errorf("quiet window mode must be %q or %q", QuietModeSkip, QuietModeThrottle)
+	}
+	return nil
+}
+
+// OpenAt reports whether the window is open at the given time, that is whether
+// its cron expression was due within its duration before it, and when it closes
+func (w QuietWindow) OpenAt(t time.Time) (bool, time.Time, error) {
+	schedule, err := cron.ParseStandard(w.Cron)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid quiet window cron expression: %w", err)
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid quiet window duration: %w", err)
+	}
+
+	opened := schedule.Next(t.Add(-duration))
+	if opened.After(t) {
+		return false, time.Time{}, nil
+	}
+	return true, opened.Add(duration), nil
+}
+
+// QuietAt returns the most restrictive of the windows open at the given time, a
+// window skipping fetches over any throttling them and the smallest budget among
+// those, and when it closes. Windows that aren't valid are left out.
+func QuietAt(t time.Time, windows []QuietWindow) (QuietWindow, time.Time, bool) {
+	var (
+		quiet    QuietWindow
+		closesAt time.Time
+		found    bool
+	)
+	for _, window := range windows {
+		open, closes, err := window.OpenAt(t)
+		if err != nil || !open {
+			continue
+		}
+
+		switch {
+		case !found:
+		case window.Mode == QuietModeSkip && quiet.Mode != QuietModeSkip:
+		case window.Mode == QuietModeThrottle && quiet.Mode == QuietModeThrottle && window.Budget < quiet.Budget:
+		default:
+			continue
+		}
+		quiet, closesAt, found = window, closes, true
+	}
+	return quiet, closesAt, found
+}
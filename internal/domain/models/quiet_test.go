@@ -0,0 +1,86 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietWindowValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  QuietWindow
+		wantErr bool
+	}{
+		{"skip", QuietWindow{Cron: "0 9 * * 1-5", Duration: "8h", Mode: QuietModeSkip}, false},
+		{"throttle", QuietWindow{Cron: "CRON_TZ=Europe/London 0 9 * * 1-5", Duration: "8h", Mode: QuietModeThrottle, Budget: 2}, false},
+		{"invalid cron", QuietWindow{Cron: "business hours", Duration: "8h", Mode: QuietModeSkip}, true},
+		{"invalid duration", QuietWindow{Cron: "0 9 * * 1-5", Duration: "all day", Mode: QuietModeSkip}, true},
+		{"duration too short", QuietWindow{Cron: "0 9 * * 1-5", Duration: "30s", Mode: QuietModeSkip}, true},
+		{"duration too long", QuietWindow{Cron: "0 9 * * 1-5", Duration: "200h", Mode: QuietModeSkip}, true},
+		{"invalid mode", QuietWindow{Cron: "0 9 * * 1-5", Duration: "8h", Mode: "pause"}, true},
+		{"throttle without budget", QuietWindow{Cron: "0 9 * * 1-5", Duration: "8h", Mode: QuietModeThrottle}, true},
+		{"skip with budget", QuietWindow{Cron: "0 9 * * 1-5", Duration: "8h", Mode: QuietModeSkip, Budget: 2}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.window.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQuietWindowOpenAt(t *testing.T) {
+	// business hours in New York, 9:00 to 17:00 on weekdays
+	window := QuietWindow{Cron: "CRON_TZ=America/New_York 0 9 * * 1-5", Duration: "8h", Mode: QuietModeSkip}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		want     bool
+		closesAt time.Time
+	}{
+		{"before", time.Date(2025, 3, 17, 12, 59, 0, 0, time.UTC), false, time.Time{}},
+		{"opening", time.Date(2025, 3, 17, 13, 0, 0, 0, time.UTC), true, time.Date(2025, 3, 17, 21, 0, 0, 0, time.UTC)},
+		{"during", time.Date(2025, 3, 17, 18, 30, 0, 0, time.UTC), true, time.Date(2025, 3, 17, 21, 0, 0, 0, time.UTC)},
+		{"closing", time.Date(2025, 3, 17, 21, 0, 0, 0, time.UTC), false, time.Time{}},
+		{"weekend", time.Date(2025, 3, 16, 18, 30, 0, 0, time.UTC), false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, closesAt, err := window.OpenAt(tt.at)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, open)
+			assert.True(t, tt.closesAt.Equal(closesAt), "want %s, got %s", tt.closesAt, closesAt)
+		})
+	}
+}
+
+func TestQuietAt(t *testing.T) {
+	at := time.Date(2025, 3, 17, 10, 0, 0, 0, time.UTC)
+
+	throttle := QuietWindow{Cron: "CRON_TZ=UTC 0 9 * * *", Duration: "8h", Mode: QuietModeThrottle, Budget: 4}
+	tighter := QuietWindow{Cron: "CRON_TZ=UTC 0 8 * * *", Duration: "4h", Mode: QuietModeThrottle, Budget: 1}
+	skip := QuietWindow{Cron: "CRON_TZ=UTC 30 9 * * *", Duration: "1h", Mode: QuietModeSkip}
+	closed := QuietWindow{Cron: "CRON_TZ=UTC 0 20 * * *", Duration: "2h", Mode: QuietModeSkip}
+
+	_, _, quiet := QuietAt(at, []QuietWindow{closed})
+	assert.False(t, quiet, "no window is open")
+
+	window, closesAt, quiet := QuietAt(at, []QuietWindow{throttle, tighter, closed})
+	assert.True(t, quiet)
+	assert.Equal(t, tighter, window, "the smallest budget wins")
+	assert.Equal(t, time.Date(2025, 3, 17, 12, 0, 0, 0, time.UTC), closesAt)
+
+	window, closesAt, quiet = QuietAt(at, []QuietWindow{throttle, skip, tighter})
+	assert.True(t, quiet)
+	assert.Equal(t, skip, window, "skipping wins over throttling")
+	assert.Equal(t, time.Date(2025, 3, 17, 10, 30, 0, 0, time.UTC), closesAt)
+}
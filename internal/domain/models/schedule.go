@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// MinScheduleInterval is the shortest interval a repository can be fetched at
+const MinScheduleInterval = time.Minute
+
+// AdaptiveIdleRuns is the number of consecutive runs finding no new commits after
+// which an adaptive schedule is widened, and widened again on every idle run after
+const AdaptiveIdleRuns = 2
+
+// AdaptiveBounds are the shortest and longest intervals adaptive schedules are
+// narrowed and widened to
+type AdaptiveBounds struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Validate checks that the schedule has at most one of a cron expression and an
+// interval, that the one it has is valid, and that its quiet windows are valid
+func (s RepoSchedule) Validate() error {
+	if s.Cron != "" && s.Interval != "" {
+		return errors.New("a schedule has either a cron expression or an interval")
+	}
+	if s.Cron != "" && s.Adaptive {
+		return errors.New("a schedule with a cron expression can't be adaptive")
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression: %w", err)
+		}
+	}
+	if s.Interval != "" {
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval: %w", err)
+		}
+		if interval < MinScheduleInterval {
+			return fmt.Errorf("interval must be at least %s", MinScheduleInterval)
+		}
+	}
+	for _, window := range s.QuietWindows {
+		if err := window.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns the schedule with the fields of the update changed. Setting a
+// cron expression turns adaptive scheduling off unless the update sets it, and
+// changing how the repository is scheduled starts adapting it afresh.
+func (s RepoSchedule) Apply(update ScheduleUpdate) RepoSchedule {
+	if update.Cron != nil {
+		s.Cron = *update.Cron
+		if s.Cron != "" && update.Interval == nil {
+			s.Interval = ""
+		}
+		if s.Cron != "" && update.Adaptive == nil {
+			s.Adaptive = false
+		}
+	}
+	if update.Interval != nil {
+		s.Interval = *update.Interval
+		if s.Interval != "" && update.Cron == nil {
+			s.Cron = ""
+		}
+	}
+	if update.Enabled != nil {
+		s.Enabled = *update.Enabled
+	}
+	if update.Adaptive != nil {
+		s.Adaptive = *update.Adaptive
+	}
+	if update.QuietWindows != nil {
+		s.QuietWindows = *update.QuietWindows
+	}
+	if update.Cron != nil || update.Interval != nil || update.Adaptive != nil {
+		s.EffectiveInterval, s.IntervalReason, s.IdleRuns = "", "", 0
+	}
+	return s
+}
+
+// Next returns the first time the schedule is due after the given time, using
+// the fallback interval when the schedule has neither a cron expression nor an
+// interval, and the effective interval once an adaptive schedule has one. Cron
+// expressions follow the standard five field format, along with descriptors
+// such as @daily, and run in the local time zone unless prefixed with
+// CRON_TZ=<zone>.
+func (s RepoSchedule) Next(after time.Time, fallback time.Duration) (time.Time, error) {
+	if s.Cron != "" {
+		schedule, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid cron expression: %w", err)
+		}
+		return schedule.Next(after), nil
+	}
+
+	if s.Adaptive && s.EffectiveInterval != "" {
+		interval, err := time.ParseDuration(s.EffectiveInterval)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid effective interval: %w", err)
+		}
+		return after.Add(interval), nil
+	}
+
+	interval, err := s.baseInterval(fallback)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return after.Add(interval), nil
+}
+
+// Adapt returns the schedule with the effective interval of its next run, given
+// the number of commits stored since its last run. An adaptive schedule starts at
+// its base interval, is halved by every run finding new commits and doubled by
+// every run after AdaptiveIdleRuns consecutive ones finding none, within the
+// bounds. Other schedules keep their base interval.
+func (s RepoSchedule) Adapt(newCommits int64, fallback time.Duration, bounds AdaptiveBounds) (RepoSchedule, error) {
+	if s.Cron != "" {
+		s.EffectiveInterval, s.IdleRuns = "", 0
+		s.IntervalReason = "fetched on its cron expression"
+		return s, nil
+	}
+
+	base, err := s.baseInterval(fallback)
+	if err != nil {
+		return s, err
+	}
+
+	if !s.Adaptive {
+		s.EffectiveInterval, s.IdleRuns = base.String(), 0
+		s.IntervalReason = "fixed interval, adaptive scheduling is off"
+		return s, nil
+	}
+
+	clamp := func(interval time.Duration) time.Duration {
+		return min(max(interval, bounds.Min), bounds.Max)
+	}
+
+	current, err := time.ParseDuration(s.EffectiveInterval)
+	if s.EffectiveInterval == "" || err != nil {
+		interval := clamp(base)
+		s.EffectiveInterval, s.IdleRuns = interval.String(), 0
+		s.IntervalReason = fmt.Sprintf("started at the base interval of %s", base)
+		if interval != base {
+			s.IntervalReason += fmt.Sprintf(", bounded to %s", interval)
+		}
+		return s, nil
+	}
+
+	switch {
+	case newCommits > 0:
+		interval := clamp(current / 2)
+		s.EffectiveInterval, s.IdleRuns = interval.String(), 0
+		s.IntervalReason = fmt.Sprintf("%d new commits since the last run, narrowed to %s", newCommits, interval)
+		if interval == current {
+			s.IntervalReason = fmt.Sprintf("%d new commits since the last run, kept at the minimum of %s", newCommits, interval)
+		}
+
+	case s.IdleRuns+1 >= AdaptiveIdleRuns:
+		s.IdleRuns++
+		interval := clamp(current * 2)
+		s.EffectiveInterval = interval.String()
+		s.IntervalReason = fmt.Sprintf("no new commits in %d consecutive runs, widened to %s", s.IdleRuns, interval)
+		if interval == current {
+			s.IntervalReason = fmt.Sprintf("no new commits in %d consecutive runs, kept at the maximum of %s", s.IdleRuns, interval)
+		}
+
+	default:
+		s.IdleRuns++
+		s.IntervalReason = fmt.Sprintf("no new commits in the last run, kept at %s", current)
+	}
+	return s, nil
+}
+
+// baseInterval returns the interval of the schedule, or the fallback when it has
+// none
+func (s RepoSchedule) baseInterval(fallback time.Duration) (time.Duration, error) {
+	if s.Interval == "" {
+		return fallback, nil
+	}
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %w", err)
+	}
+	return interval, nil
+}
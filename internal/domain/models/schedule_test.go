@@ -0,0 +1,132 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule RepoSchedule
+		wantErr  bool
+	}{
+		{"default", RepoSchedule{}, false},
+		{"cron", RepoSchedule{Cron: "0 */6 * * *"}, false},
+		{"descriptor", RepoSchedule{Cron: "@daily"}, false},
+		{"time zone", RepoSchedule{Cron: "CRON_TZ=Europe/London 0 9 * * 1-5"}, false},
+		{"interval", RepoSchedule{Interval: "45m"}, false},
+		{"both", RepoSchedule{Cron: "@daily", Interval: "45m"}, true},
+		{"invalid cron", RepoSchedule{Cron: "every day"}, true},
+		{"invalid interval", RepoSchedule{Interval: "often"}, true},
+		{"interval too short", RepoSchedule{Interval: "30s"}, true},
+		{"adaptive", RepoSchedule{Interval: "45m", Adaptive: true}, false},
+		{"adaptive cron", RepoSchedule{Cron: "@daily", Adaptive: true}, true},
+		{"quiet window", RepoSchedule{QuietWindows: []QuietWindow{{Cron: "0 9 * * 1-5", Duration: "8h", Mode: QuietModeSkip}}}, false},
+		{"invalid quiet window", RepoSchedule{QuietWindows: []QuietWindow{{Cron: "0 9 * * 1-5", Duration: "8h", Mode: QuietModeThrottle}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRepoScheduleApply(t *testing.T) {
+	cron, interval, empty, disabled := "@daily", "45m", "", false
+
+	schedule := RepoSchedule{Interval: "2h", Enabled: true}
+
+	schedule = schedule.Apply(ScheduleUpdate{Cron: &cron})
+	assert.Equal(t, RepoSchedule{Cron: cron, Enabled: true}, schedule, "a cron expression replaces the interval")
+
+	schedule = schedule.Apply(ScheduleUpdate{Interval: &interval, Enabled: &disabled})
+	assert.Equal(t, RepoSchedule{Interval: interval}, schedule, "an interval replaces the cron expression")
+
+	schedule = schedule.Apply(ScheduleUpdate{Interval: &empty})
+	assert.Equal(t, RepoSchedule{}, schedule, "clearing both falls back to the default")
+
+	schedule = RepoSchedule{Interval: interval, Adaptive: true, EffectiveInterval: "3h", IntervalReason: "widened", IdleRuns: 4}
+	assert.Equal(t, schedule, schedule.Apply(ScheduleUpdate{Enabled: &disabled}), "disabling the schedule keeps its adaptive state")
+	assert.Equal(t, RepoSchedule{Cron: cron}, schedule.Apply(ScheduleUpdate{Cron: &cron}), "a cron expression turns adaptive scheduling off")
+}
+
+func TestRepoScheduleNext(t *testing.T) {
+	after := time.Date(2025, 3, 17, 7, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule RepoSchedule
+		want     time.Time
+	}{
+		{"default", RepoSchedule{}, after.Add(time.Hour)},
+		{"interval", RepoSchedule{Interval: "45m"}, after.Add(45 * time.Minute)},
+		{"cron", RepoSchedule{Cron: "CRON_TZ=UTC 0 */6 * * *"}, time.Date(2025, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"adaptive", RepoSchedule{Interval: "45m", Adaptive: true, EffectiveInterval: "3h0m0s"}, after.Add(3 * time.Hour)},
+		{"adaptive not started", RepoSchedule{Interval: "45m", Adaptive: true}, after.Add(45 * time.Minute)},
+		{"not adaptive", RepoSchedule{Interval: "45m", EffectiveInterval: "3h0m0s"}, after.Add(45 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := tt.schedule.Next(after, time.Hour)
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(next), "want %s, got %s", tt.want, next)
+		})
+	}
+}
+
+func TestRepoScheduleAdapt(t *testing.T) {
+	bounds := AdaptiveBounds{Min: 15 * time.Minute, Max: 4 * time.Hour}
+
+	schedule := RepoSchedule{Adaptive: true, Enabled: true}
+
+	// each run is given the number of commits stored since the one before
+	runs := []struct {
+		newCommits int64
+		interval   string
+		idleRuns   int
+	}{
+		{0, "1h0m0s", 0}, // starts at the base interval
+		{12, "30m0s", 0}, // narrowed by activity
+		{3, "15m0s", 0},  // down to the minimum
+		{5, "15m0s", 0},  // and no further
+		{0, "15m0s", 1},  // a single idle run keeps the interval
+		{0, "30m0s", 2},  // widened once idle across consecutive runs
+		{0, "1h0m0s", 3}, // and on every idle run after
+		{0, "2h0m0s", 4},
+		{0, "4h0m0s", 5}, // up to the maximum
+		{0, "4h0m0s", 6}, // and no further
+		{1, "2h0m0s", 0}, // narrowed again once activity resumes
+	}
+	for i, run := range runs {
+		var err error
+		schedule, err = schedule.Adapt(run.newCommits, time.Hour, bounds)
+		assert.NoError(t, err)
+		assert.Equal(t, run.interval, schedule.EffectiveInterval, "run %d", i)
+		assert.Equal(t, run.idleRuns, schedule.IdleRuns, "run %d", i)
+		assert.NotEmpty(t, schedule.IntervalReason, "run %d", i)
+	}
+
+	fixed, err := RepoSchedule{Interval: "45m", EffectiveInterval: "4h0m0s", IdleRuns: 3}.Adapt(0, time.Hour, bounds)
+	assert.NoError(t, err)
+	assert.Equal(t, "45m0s", fixed.EffectiveInterval, "a schedule that isn't adaptive keeps its interval")
+	assert.Zero(t, fixed.IdleRuns)
+
+	onCron, err := RepoSchedule{Cron: "@daily"}.Adapt(0, time.Hour, bounds)
+	assert.NoError(t, err)
+	assert.Empty(t, onCron.EffectiveInterval, "a cron schedule has no interval")
+	assert.NotEmpty(t, onCron.IntervalReason)
+
+	bounded, err := RepoSchedule{Interval: "5m", Adaptive: true}.Adapt(0, time.Hour, bounds)
+	assert.NoError(t, err)
+	assert.Equal(t, "15m0s", bounded.EffectiveInterval, "the base interval is bounded")
+}
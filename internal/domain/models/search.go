@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	SearchOpAnd = "and"
+	SearchOpOr  = "or"
+	SearchOpNot = "not"
+)
+
+// MaxSearchQueryLength is the longest search query accepted, in bytes
+const MaxSearchQueryLength = 512
+
+// ParseSearchQuery parses a full-text search query. Words are matched in any
+// order, "quoted words" as a phrase, and a word or phrase ending with * as a
+// prefix. Words and phrases are combined with AND, which is implied between
+// them, OR and NOT, which matches the left side but not the right one, and
+// grouped with parentheses. Operators are case sensitive, and OR binds looser
+// than AND and NOT. Punctuation splits words, e.g. JIRA-123 is the phrase
+// "jira 123".
+func ParseSearchQuery(query string) (SearchExpr, error) {
+	if len(query) > MaxSearchQueryLength {
+		return SearchExpr{}, fmt.Errorf("search query must be at most %d bytes", MaxSearchQueryLength)
+	}
+
+	tokens, err := lexSearchQuery(query)
+	if err != nil {
+		return SearchExpr{}, err
+	}
+	if len(tokens) == 0 {
+		return SearchExpr{}, errors.New("search query is empty")
+	}
+
+	p := &searchParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return SearchExpr{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return SearchExpr{}, fmt.Errorf("unexpected %s in search query", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+type searchToken struct {
+	// kind is one of the operators, "(", ")" or "phrase"
+	kind   string
+	words  []string
+	prefix bool
+}
+
+func (t searchToken) String() string {
+	switch t.kind {
+	case "phrase":
+		return fmt.Sprintf("%q", strings.Join(t.words, " "))
+	case SearchOpAnd, SearchOpOr, SearchOpNot:
+		return strings.ToUpper(t.kind)
+	}
+	return fmt.Sprintf("%q", t.kind)
+}
+
+func lexSearchQuery(query string) ([]searchToken, error) {
+	var tokens []searchToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, searchToken{kind: string(r)})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.New("unterminated phrase in search query")
+			}
+			token, err := phraseToken(string(runes[i+1:end]), runes, end+1)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end + 1
+			if token.prefix {
+				i++
+			}
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			i = end
+
+			switch word {
+			case "AND", "OR", "NOT":
+				tokens = append(tokens, searchToken{kind: strings.ToLower(word)})
+				continue
+			}
+
+			prefix := strings.HasSuffix(word, "*")
+			token, err := phraseToken(strings.TrimSuffix(word, "*"), nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			token.prefix = prefix
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// phraseToken splits text into words, and reads the * following a quoted phrase
+// at runes[next]
+func phraseToken(text string, runes []rune, next int) (searchToken, error) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return searchToken{}, fmt.Errorf("%q has no words to search for", text)
+	}
+	return searchToken{
+		kind:   "phrase",
+		words:  words,
+		prefix: next < len(runes) && runes[next] == '*',
+	}, nil
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return ""
+}
+
+func (p *searchParser) parseOr() (SearchExpr, error) {
+	expr, err := p.parseAnd()
+	if err != nil {
+		return SearchExpr{}, err
+	}
+	for p.peek() == SearchOpOr {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return SearchExpr{}, err
+		}
+		expr = SearchExpr{Op: SearchOpOr, Operands: []SearchExpr{expr, right}}
+	}
+	return expr, nil
+}
+
+func (p *searchParser) parseAnd() (SearchExpr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return SearchExpr{}, err
+	}
+	for {
+		op := SearchOpAnd
+		switch p.peek() {
+		case SearchOpAnd, SearchOpNot:
+			op = p.peek()
+			p.pos++
+		case "phrase", "(":
+		default:
+			return expr, nil
+		}
+
+		right, err := p.parsePrimary()
+		if err != nil {
+			return SearchExpr{}, err
+		}
+		expr = SearchExpr{Op: op, Operands: []SearchExpr{expr, right}}
+	}
+}
+
+func (p *searchParser) parsePrimary() (SearchExpr, error) {
+	if p.pos == len(p.tokens) {
+		return SearchExpr{}, errors.New("unexpected end of search query")
+	}
+
+	token := p.tokens[p.pos]
+	switch token.kind {
+	case "phrase":
+		p.pos++
+		return SearchExpr{Words: token.words, Prefix: token.prefix}, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return SearchExpr{}, err
+		}
+		if p.peek() != ")" {
+			return SearchExpr{}, errors.New("missing ) in search query")
+		}
+		p.pos++
+		return expr, nil
+	}
+	return SearchExpr{}, fmt.Errorf("unexpected %s in search query", token)
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	word := func(w string) SearchExpr { return SearchExpr{Words: []string{w}} }
+	op := func(op string, left, right SearchExpr) SearchExpr {
+		return SearchExpr{Op: op, Operands: []SearchExpr{left, right}}
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    SearchExpr
+		wantErr bool
+	}{
+		{"word", "Login", word("login"), false},
+		{"implicit and", "fix login", op(SearchOpAnd, word("fix"), word("login")), false},
+		{"phrase", `"fix the login"`, SearchExpr{Words: []string{"fix", "the", "login"}}, false},
+		{"punctuation splits words", "JIRA-123", SearchExpr{Words: []string{"jira", "123"}}, false},
+		{"prefix", "auth*", SearchExpr{Words: []string{"auth"}, Prefix: true}, false},
+		{"phrase prefix", `"login pa"*`, SearchExpr{Words: []string{"login", "pa"}, Prefix: true}, false},
+		{"or binds looser than and", "a b OR c", op(SearchOpOr, op(SearchOpAnd, word("a"), word("b")), word("c")), false},
+		{"not", "fix NOT test", op(SearchOpNot, word("fix"), word("test")), false},
+		{"parentheses", "(a OR b) AND c", op(SearchOpAnd, op(SearchOpOr, word("a"), word("b")), word("c")), false},
+		{"lowercase operators are words", "fix or test", op(SearchOpAnd, op(SearchOpAnd, word("fix"), word("or")), word("test")), false},
+		{"empty", "  ", SearchExpr{}, true},
+		{"no words", "--- *", SearchExpr{}, true},
+		{"unterminated phrase", `"fix login`, SearchExpr{}, true},
+		{"missing parenthesis", "(a OR b", SearchExpr{}, true},
+		{"stray parenthesis", "a)", SearchExpr{}, true},
+		{"leading operator", "NOT fix", SearchExpr{}, true},
+		{"trailing operator", "fix OR", SearchExpr{}, true},
+		{"too long", strings.Repeat("a", MaxSearchQueryLength+1), SearchExpr{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
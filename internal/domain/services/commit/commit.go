@@ -14,8 +14,9 @@ type (
 
 	commitStore interface {
 		GetTopAuthors(ctx context.Context, RepoInfo models.RepoInfo, limit int) ([]models.AuthorStats, error)
-		List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, string, error)
+		List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, models.Pagination, error)
 		CreateBatch(ctx context.Context, commits []models.Commit) error
+		Search(ctx context.Context, expr models.SearchExpr, repoInfo *models.RepoInfo, pagination models.PaginationReq) ([]models.CommitMatch, models.Pagination, error)
 	}
 )
 
@@ -34,13 +35,24 @@ func (s *service) GetTopAuthors(ctx context.Context, RepoInfo models.RepoInfo, l
 	return stats, nil
 }
 
-func (s *service) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, string, error) {
-	commits, cursor, err := s.commitStore.List(ctx, RepoInfo, pagination)
+func (s *service) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, models.Pagination, error) {
+	commits, page, err := s.commitStore.List(ctx, RepoInfo, pagination)
 	if err != nil {
-		return []models.Commit{}, "", fmt.Errorf("error retriving author stats %w", err)
+		return []models.Commit{}, models.Pagination{}, fmt.Errorf("error retriving author stats %w", err)
 	}
 
-	return commits, cursor, nil
+	return commits, page, nil
+}
+
+// Search returns a page of the commits whose message matches the search, of the
+// given repository or, without one, of every repository, best matches first
+func (s *service) Search(ctx context.Context, expr models.SearchExpr, repoInfo *models.RepoInfo, pagination models.PaginationReq) ([]models.CommitMatch, models.Pagination, error) {
+	matches, page, err := s.commitStore.Search(ctx, expr, repoInfo, pagination)
+	if err != nil {
+		return []models.CommitMatch{}, models.Pagination{}, fmt.Errorf("error searching commits: %w", err)
+	}
+
+	return matches, page, nil
 }
 
 func (s *service) CreateBatch(ctx context.Context, commits []models.Commit) error {
@@ -11,22 +11,25 @@ import (
 
 type (
 	service struct {
-		repoStore     repoStore
-		taskSvc       taskSvc
-		githubService githubService
+		repoStore       repoStore
+		taskSvc         taskSvc
+		githubService   githubService
+		defaultInterval time.Duration
 	}
 
 	repoStore interface {
 		Create(ctx context.Context, repo models.Repository) error
+		Get(ctx context.Context, RepoInfo models.RepoInfo) (models.Repository, error)
 		CheckExists(ctx context.Context, RepoInfo models.RepoInfo) (bool, error)
-		List(ctx context.Context) ([]models.Repository, error)
+		ListPage(ctx context.Context, pagination models.PaginationReq) ([]models.Repository, models.Pagination, error)
 		Reset(ctx context.Context, RepoInfo models.RepoInfo, startTime *time.Time) error
 		UpdateStatus(ctx context.Context, RepoInfo models.RepoInfo, isActive *bool) error
 		UpdateTrackingInfo(ctx context.Context, repoInfo models.RepoInfo, lastFetchedCommitTime time.Time) error
+		UpdateSchedule(ctx context.Context, repoInfo models.RepoInfo, schedule models.RepoSchedule) error
 	}
 
 	taskSvc interface {
-		TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time) (string, error)
+		TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time, triggerType string) (string, error)
 	}
 
 	githubService interface {
@@ -34,11 +37,14 @@ type (
 	}
 )
 
-func New(repoStore repoStore, taskSvc taskSvc, githubService githubService) *service {
+// New returns the repository service. Repositories without a schedule of their
+// own are fetched every defaultInterval.
+func New(repoStore repoStore, taskSvc taskSvc, githubService githubService, defaultInterval time.Duration) *service {
 	return &service{
-		repoStore:     repoStore,
-		taskSvc:       taskSvc,
-		githubService: githubService,
+		repoStore:       repoStore,
+		taskSvc:         taskSvc,
+		githubService:   githubService,
+		defaultInterval: defaultInterval,
 	}
 }
 
@@ -63,11 +69,14 @@ func (s *service) Create(ctx context.Context, RepoInfo models.RepoInfo, since *t
 		commitStartTrackingTime = *since
 	}
 	newRepo.CommitTrackingStartTime = commitStartTrackingTime
+	// the repository is fetched straight away, the scheduler takes over after
+	nextRunAt := time.Now().Add(s.defaultInterval)
+	newRepo.Schedule = models.RepoSchedule{Enabled: true, NextRunAt: &nextRunAt}
 	if err := s.repoStore.Create(ctx, newRepo); err != nil {
 		return models.Repository{}, "", fmt.Errorf("error creating repository %w", err)
 	}
 
-	taskID, err := s.taskSvc.TriggerTask(ctx, RepoInfo, &commitStartTrackingTime)
+	taskID, err := s.taskSvc.TriggerTask(ctx, RepoInfo, &commitStartTrackingTime, models.TriggerTypeManual)
 	if  err != nil {
 		return models.Repository{}, "", fmt.Errorf("error sending task event %w", err)
 	}
@@ -75,13 +84,14 @@ func (s *service) Create(ctx context.Context, RepoInfo models.RepoInfo, since *t
 	return newRepo, taskID, nil
 }
 
-func (s *service) List(ctx context.Context) ([]models.Repository, error) {
-	repos, err := s.repoStore.List(ctx)
+// List returns a page of the tracked repositories, latest added first
+func (s *service) List(ctx context.Context, pagination models.PaginationReq) ([]models.Repository, models.Pagination, error) {
+	repos, page, err := s.repoStore.ListPage(ctx, pagination)
 	if err != nil {
-		return []models.Repository{}, fmt.Errorf("error listing repositories %w", err)
+		return []models.Repository{}, models.Pagination{}, fmt.Errorf("error listing repositories %w", err)
 	}
 
-	return repos, nil
+	return repos, page, nil
 }
 
 func (s *service) Reset(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time) (string, error) {
@@ -93,7 +103,7 @@ func (s *service) Reset(ctx context.Context, RepoInfo models.RepoInfo, since *ti
 		return "", fmt.Errorf("error resetting repository %w", err)
 	}
 
-	taskID, err := s.taskSvc.TriggerTask(ctx, RepoInfo, since)
+	taskID, err := s.taskSvc.TriggerTask(ctx, RepoInfo, since, models.TriggerTypeReset)
 	if  err != nil {
 		return "", fmt.Errorf("error sending task event %w", err)
 	}
@@ -131,3 +141,36 @@ func (s *service) UpdateTrackingInfo(ctx context.Context, repoInfo models.RepoIn
 	}
 	return nil
 }
+
+// UpdateSchedule changes the schedule of a tracked repository and moves its next
+// run to when the new schedule is next due
+func (s *service) UpdateSchedule(ctx context.Context, repoInfo models.RepoInfo, update models.ScheduleUpdate) (models.RepoSchedule, error) {
+	if err := s.CheckExists(ctx, repoInfo); err != nil {
+		return models.RepoSchedule{}, fmt.Errorf("error validating repo name %w", err)
+	}
+
+	repo, err := s.repoStore.Get(ctx, repoInfo)
+	if err != nil {
+		return models.RepoSchedule{}, fmt.Errorf("error retrieving repository %w", err)
+	}
+
+	schedule := repo.Schedule.Apply(update)
+	if err := schedule.Validate(); err != nil {
+		return models.RepoSchedule{}, errors.ErrInvalidInput.WithError(err)
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		nextRunAt, err := schedule.Next(time.Now(), s.defaultInterval)
+		if err != nil {
+			return models.RepoSchedule{}, errors.ErrInvalidInput.WithError(err)
+		}
+		schedule.NextRunAt = &nextRunAt
+	}
+
+	if err := s.repoStore.UpdateSchedule(ctx, repoInfo, schedule); err != nil {
+		return models.RepoSchedule{}, fmt.Errorf("error updating repository schedule %w", err)
+	}
+
+	return schedule, nil
+}
@@ -0,0 +1,109 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// coalesceOrQueue handles a task for a repository whose lease is held by another
+// task. It returns the ID of an unfinished task whose window already covers the
+// new one, raising its priority to that of the new task, and otherwise saves the
+// task as queued until the lease is released. A task that has started only
+// covers the window it was created with, so it doesn't take the commits pushed
+// since.
+func (s *service) coalesceOrQueue(ctx context.Context, task models.Task) (string, error) {
+	unfinished, err := s.taskStore.ListForRepo(ctx, task.RepositoryID,
+		models.TaskStatusQueued, models.TaskStatusPending, models.TaskStatusInProgress)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving unfinished tasks %w", err)
+	}
+
+	for _, other := range unfinished {
+		if covers(other, task) {
+			if err := s.taskStore.RaisePriority(ctx, other.ID, task.Priority); err != nil {
+				return "", err
+			}
+			return other.ID, nil
+		}
+	}
+
+	task.Status = models.TaskStatusQueued
+	if err := s.taskStore.Create(ctx, task); err != nil {
+		return "", fmt.Errorf("failed to create task: %w", err)
+	}
+
+	// the lease may have been released before the task was queued, by a task
+	// that found no queued task to let through
+	if err := s.startNextQueued(ctx, task.RepositoryID); err != nil {
+		return "", err
+	}
+	return task.ID, nil
+}
+
+// covers tells whether the window of a task includes the whole window of
+// another. A task queued for the first time gets a fresh Until once it is let
+// through, and an open Until covers the commits pushed before the fetch of the
+// task starts, while an open Since covers the whole history.
+func covers(task, other models.Task) bool {
+	sinceCovered := task.Since == nil || (other.Since != nil && !task.Since.After(*other.Since))
+
+	var untilCovered bool
+	switch {
+	case task.Status == models.TaskStatusQueued && task.AttemptCount == 0:
+		untilCovered = true
+	case task.Until == nil:
+		untilCovered = task.Status == models.TaskStatusQueued || task.Status == models.TaskStatusPending
+	case other.Until != nil:
+		untilCovered = !task.Until.Before(*other.Until)
+	}
+	return sinceCovered && untilCovered
+}
+
+// releaseLease frees the repository lease of a finished task and lets the next
+// queued task of the repository through
+func (s *service) releaseLease(ctx context.Context, taskID string) error {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.leaseStore.Release(ctx, task.RepositoryID, task.ID); err != nil {
+		return err
+	}
+	return s.startNextQueued(ctx, task.RepositoryID)
+}
+
+// startNextQueued gives the repository lease to the queued task of the repository
+// with the highest priority, the oldest first, and publishes its fetch
+func (s *service) startNextQueued(ctx context.Context, repoID string) error {
+	queued, err := s.taskStore.ListForRepo(ctx, repoID, models.TaskStatusQueued)
+	if err != nil {
+		return fmt.Errorf("error retrieving queued tasks %w", err)
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+	next := queued[0]
+
+	acquired, err := s.leaseStore.Acquire(ctx, repoID, next.ID, time.Now().Add(s.leaseTTL))
+	if err != nil || !acquired {
+		// another task got the lease first, the queued task waits for it
+		return err
+	}
+
+	if err := s.updateStatus(ctx, next.ID, models.TaskStatusPending, nil); err != nil {
+		return err
+	}
+	if next, err = s.taskStore.Get(ctx, next.ID); err != nil {
+		return err
+	}
+
+	if err := s.publishFetch(ctx, next, time.Time{}); err != nil {
+		// failing the task releases the lease to the next one in the queue
+		return s.MarkFailed(ctx, next.ID, fmt.Sprintf("failed to publish fetch commit event: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+func TestCovers(t *testing.T) {
+	at := func(hour int) *time.Time {
+		tm := time.Date(2026, 1, 1, hour, 0, 0, 0, time.UTC)
+		return &tm
+	}
+	task := models.Task{Since: at(1), Until: at(2)}
+
+	assert.True(t, covers(models.Task{Since: at(0), Until: at(3)}, task))
+	assert.True(t, covers(models.Task{Since: nil, Until: at(2)}, task))
+	// a running task doesn't take the commits pushed since it was created
+	assert.False(t, covers(models.Task{Since: at(0), Until: at(1)}, task))
+	assert.False(t, covers(models.Task{Since: at(1), Until: nil, Status: models.TaskStatusInProgress}, task))
+	assert.True(t, covers(models.Task{Since: at(1), Until: nil, Status: models.TaskStatusQueued}, task))
+	assert.False(t, covers(models.Task{Since: at(2), Until: at(3)}, task))
+	// a task queued for the first time fetches up to when it is let through
+	assert.True(t, covers(models.Task{Since: at(0), Until: at(1), Status: models.TaskStatusQueued}, task))
+	assert.False(t, covers(models.Task{Since: at(0), Until: at(1), Status: models.TaskStatusQueued, AttemptCount: 1}, task))
+	assert.False(t, covers(task, models.Task{Since: at(1)}))
+}
+
+func TestHandleTask_CoalescesCoveringTask(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Hour)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"running": {ID: "running", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, Since: &since, Until: &until},
+	}}
+	leases := &fakeLeaseStore{held: map[string]string{"repo-1": "running"}}
+	svc := New(tasks, &fakeBatchStore{}, nil, leases, &fakeAttemptStore{}, nil, &fakePublisher{}, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	id, err := svc.handleTask(context.Background(), models.Repository{ID: "repo-1"}, &since, models.TriggerTypeWebhook, models.TaskPriorityWebhook)
+	require.NoError(t, err)
+	assert.Equal(t, "running", id)
+	assert.Equal(t, models.TaskPriorityWebhook, tasks.tasks["running"].Priority)
+	assert.Len(t, tasks.tasks, 1)
+}
+
+func TestHandleTask_QueuesBehindTaskNotCoveringWindow(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(-time.Minute)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"running": {ID: "running", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, Since: &since, Until: &until},
+	}}
+	leases := &fakeLeaseStore{held: map[string]string{"repo-1": "running"}}
+	publisher := &fakePublisher{}
+	svc := New(tasks, &fakeBatchStore{}, nil, leases, &fakeAttemptStore{}, nil, publisher, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	id, err := svc.handleTask(context.Background(), models.Repository{ID: "repo-1"}, &since, models.TriggerTypeManual, models.TaskPriorityManual)
+	require.NoError(t, err)
+	assert.NotEqual(t, "running", id)
+	assert.Equal(t, models.TaskStatusQueued, tasks.tasks[id].Status)
+	assert.Empty(t, publisher.published)
+}
+
+func TestHandleTask_StartsQueuedTaskWhenLeaseReleasedMeanwhile(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(-time.Minute)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"running": {ID: "running", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, Since: &since, Until: &until},
+	}}
+	leases := &fakeLeaseStore{held: map[string]string{"repo-1": "running"}}
+	// the running task finishes, finding no queued task to start, between the
+	// new task failing to get the lease and being queued
+	leases.denied = func() {
+		delete(leases.held, "repo-1")
+		leases.denied = nil
+	}
+	publisher := &fakePublisher{}
+	svc := New(tasks, &fakeBatchStore{}, nil, leases, &fakeAttemptStore{}, nil, publisher, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	id, err := svc.handleTask(context.Background(), models.Repository{ID: "repo-1"}, &since, models.TriggerTypeManual, models.TaskPriorityManual)
+	require.NoError(t, err)
+	assert.Equal(t, models.TaskStatusPending, tasks.tasks[id].Status)
+	assert.Equal(t, id, leases.held["repo-1"])
+	assert.Equal(t, []string{id}, publisher.published)
+}
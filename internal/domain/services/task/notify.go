@@ -0,0 +1,64 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/pkg/aftercommit"
+)
+
+// Subscribe returns the events of the tasks matching the filter, from now on.
+// The returned function must be called once the events are no longer read.
+func (s *service) Subscribe(filter models.TaskEventFilter) (<-chan models.TaskEvent, func()) {
+	return s.notifier.Subscribe(filter)
+}
+
+// notifyStatus sends the new status of a task to its subscribers, as a done
+// event when the task has finished
+func (s *service) notifyStatus(ctx context.Context, taskID string) error {
+	task, batches, err := s.getWithBatches(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	progress := calculateProgress(task, batches, time.Now())
+	task.Progress = &progress
+	s.notify(ctx, models.NewTaskEvent(task))
+	return nil
+}
+
+// notifyBatch sends a batch of a task, and the progress of the task, to its subscribers
+func (s *service) notifyBatch(ctx context.Context, taskID string, batchID int) error {
+	task, batches, err := s.getWithBatches(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	s.publishBatch(ctx, task, batches, batchID)
+	return nil
+}
+
+func (s *service) publishBatch(ctx context.Context, task models.Task, batches []models.BatchDetail, batchID int) {
+	progress := calculateProgress(task, batches, time.Now())
+	task.Progress = &progress
+
+	event := models.NewTaskEvent(task)
+	event.Type = models.TaskEventBatch
+	for i := range batches {
+		if batches[i].BatchID == batchID {
+			event.Batch = &batches[i]
+			break
+		}
+	}
+	s.notify(ctx, event)
+}
+
+// notify sends an event to the subscribers, once the transaction of ctx, if any,
+// has committed, so that they never see a state that was rolled back
+func (s *service) notify(ctx context.Context, event models.TaskEvent) {
+	aftercommit.Do(ctx, func(context.Context) error {
+		s.notifier.Publish(event)
+		return nil
+	})
+}
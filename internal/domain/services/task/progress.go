@@ -0,0 +1,87 @@
+package task
+
+import (
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// calculateProgress aggregates the batches of a task into its progress.
+//
+// GitHub doesn't say how many commits a fetch will return, so the share of the
+// work done is estimated from time coverage instead: commits are fetched newest
+// first, from the end of the task window back to its start, so the oldest commit
+// fetched so far tells how much of the window has been covered. That share is
+// then scaled down by the fraction of fetched commits that are already saved.
+// The estimated completion time extrapolates the time spent so far.
+func calculateProgress(task models.Task, batches []models.BatchDetail, now time.Time) models.TaskProgress {
+	progress := models.TaskProgress{
+		TotalBatches: task.TotalBatches,
+	}
+
+	for _, batch := range batches {
+		progress.BatchesFetched++
+		progress.CommitsFetched += batch.CommitCount
+
+		switch batch.Status {
+		case models.BatchStatusSaved:
+			progress.BatchesSaved++
+			progress.CommitsSaved += batch.CommitCount
+		case models.BatchStatusFailed:
+			progress.BatchesFailed++
+		}
+
+		if batch.CommitCount > 0 && (progress.OldestCommitTime == nil || batch.OldestCommitTime.Before(*progress.OldestCommitTime)) {
+			oldest := batch.OldestCommitTime
+			progress.OldestCommitTime = &oldest
+		}
+	}
+
+	if task.Status == models.TaskStatusCompleted {
+		progress.PercentComplete = 100
+		return progress
+	}
+
+	fetched := fetchCoverage(task, progress.OldestCommitTime)
+	saved := 1.0
+	if progress.CommitsFetched > 0 {
+		saved = float64(progress.CommitsSaved) / float64(progress.CommitsFetched)
+	}
+	share := fetched * saved
+	progress.PercentComplete = float64(int(share*10000)) / 100
+
+	if task.StartedAt != nil && share > 0 && share < 1 && task.Status == models.TaskStatusInProgress {
+		elapsed := now.Sub(*task.StartedAt)
+		remaining := time.Duration(float64(elapsed) * (1 - share) / share)
+		eta := now.Add(remaining)
+		progress.EstimatedCompletionAt = &eta
+	}
+
+	return progress
+}
+
+// fetchCoverage returns the share of the task window fetched so far, between 0 and 1
+func fetchCoverage(task models.Task, oldestFetched *time.Time) float64 {
+	if task.TotalBatches != nil {
+		return 1
+	}
+	if task.Since == nil || task.Until == nil || oldestFetched == nil {
+		return 0
+	}
+
+	window := task.Until.Sub(*task.Since)
+	if window <= 0 {
+		return 0
+	}
+
+	covered := task.Until.Sub(*oldestFetched)
+	switch {
+	case covered <= 0:
+		return 0
+	case covered >= window:
+		// the oldest batch reached the start of the window, only the
+		// confirmation that there is nothing left is missing
+		return 0.99
+	}
+	return float64(covered) / float64(window)
+}
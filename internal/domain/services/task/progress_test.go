@@ -0,0 +1,49 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+func TestCalculateProgress(t *testing.T) {
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	since := now.Add(-100 * time.Hour)
+	startedAt := now.Add(-time.Hour)
+
+	task := models.Task{
+		Status:    models.TaskStatusInProgress,
+		Since:     &since,
+		Until:     &now,
+		StartedAt: &startedAt,
+	}
+	batches := []models.BatchDetail{
+		{BatchID: 1, CommitCount: 30, NewestCommitTime: now, OldestCommitTime: now.Add(-25 * time.Hour), Status: models.BatchStatusSaved},
+		{BatchID: 2, CommitCount: 10, NewestCommitTime: now.Add(-26 * time.Hour), OldestCommitTime: now.Add(-50 * time.Hour), Status: models.BatchStatusFetched},
+	}
+
+	progress := calculateProgress(task, batches, now)
+	assert.Equal(t, 2, progress.BatchesFetched)
+	assert.Equal(t, 1, progress.BatchesSaved)
+	assert.Equal(t, 40, progress.CommitsFetched)
+	assert.Equal(t, 30, progress.CommitsSaved)
+	assert.True(t, now.Add(-50*time.Hour).Equal(*progress.OldestCommitTime))
+	// half of the window fetched, three quarters of the fetched commits saved
+	assert.Equal(t, 37.5, progress.PercentComplete)
+	if assert.NotNil(t, progress.EstimatedCompletionAt) {
+		assert.Equal(t, now.Add(100*time.Minute), *progress.EstimatedCompletionAt)
+	}
+
+	// once the fetch is done progress only depends on the saved commits
+	total := 2
+	task.TotalBatches = &total
+	progress = calculateProgress(task, batches, now)
+	assert.Equal(t, 75.0, progress.PercentComplete)
+
+	task.Status = models.TaskStatusCompleted
+	progress = calculateProgress(task, batches, now)
+	assert.Equal(t, 100.0, progress.PercentComplete)
+	assert.Nil(t, progress.EstimatedCompletionAt)
+}
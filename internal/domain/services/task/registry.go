@@ -0,0 +1,58 @@
+package task
+
+import (
+	"context"
+	"sync"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+)
+
+// registry keeps the cancel functions of the tasks running in this process, so
+// that cancelling a task stops its work straight away
+type registry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	cancels map[string]map[uint64]context.CancelCauseFunc
+}
+
+func newRegistry() *registry {
+	return &registry{
+		cancels: make(map[string]map[uint64]context.CancelCauseFunc),
+	}
+}
+
+// add registers a cancellable context for the task. A task may run more than once
+// at a time, e.g. while a redelivered fetch overlaps the original one.
+func (r *registry) add(ctx context.Context, taskID string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	r.nextID++
+	id := r.nextID
+	if r.cancels[taskID] == nil {
+		r.cancels[taskID] = make(map[uint64]context.CancelCauseFunc)
+	}
+	r.cancels[taskID][id] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels[taskID], id)
+		if len(r.cancels[taskID]) == 0 {
+			delete(r.cancels, taskID)
+		}
+		r.mu.Unlock()
+
+		cancel(context.Canceled)
+	}
+}
+
+// cancel cancels every context registered for the task
+func (r *registry) cancel(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, cancel := range r.cancels[taskID] {
+		cancel(dErrors.ErrTaskCancelled)
+	}
+}
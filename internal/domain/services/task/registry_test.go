@@ -0,0 +1,34 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry()
+
+	first, releaseFirst := r.add(context.Background(), "task-1")
+	second, releaseSecond := r.add(context.Background(), "task-1")
+	other, releaseOther := r.add(context.Background(), "task-2")
+	defer releaseOther()
+
+	r.cancel("task-1")
+
+	assert.ErrorIs(t, context.Cause(first), dErrors.ErrTaskCancelled)
+	assert.ErrorIs(t, context.Cause(second), dErrors.ErrTaskCancelled)
+	assert.NoError(t, other.Err())
+
+	releaseFirst()
+	releaseSecond()
+	assert.Empty(t, r.cancels["task-1"])
+
+	// releasing a task stops its context without cancelling the task
+	ctx, release := r.add(context.Background(), "task-3")
+	release()
+	assert.ErrorIs(t, context.Cause(ctx), context.Canceled)
+	assert.NotErrorIs(t, context.Cause(ctx), dErrors.ErrTaskCancelled)
+}
@@ -0,0 +1,153 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// rateLimitMargin is added to the rate limit reset time when rescheduling a fetch
+const rateLimitMargin = 5 * time.Second
+
+// RetryPolicy decides how a task whose fetch failed with a transient error, such
+// as a GitHub server error, is retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the fetch of a task is tried before the
+	// task fails, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every retry after it
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries
+	MaxDelay time.Duration
+}
+
+// backoff returns the delay before the given retry, counted from 1. The delay
+// doubles with every retry up to MaxDelay, and half of it is random so that tasks
+// failing together don't retry together.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay > 0 && delay < p.MaxDelay; i++ {
+		// doubling past MaxDelay could overflow
+		if delay > p.MaxDelay/2 {
+			delay = p.MaxDelay
+			break
+		}
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int64N(int64(delay-half)+1))
+}
+
+// startAttempt records a new attempt for a task that has just moved to in_progress.
+// An attempt left running is one whose fetch was interrupted, e.g. by the event
+// being redelivered after the worker stopped.
+func (s *service) startAttempt(ctx context.Context, taskID string) error {
+	if err := s.attemptStore.Finish(ctx, taskID, models.AttemptStatusFailed, "interrupted before the fetch finished", nil); err != nil {
+		return err
+	}
+
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	return s.attemptStore.Create(ctx, models.TaskAttempt{
+		TaskID:    taskID,
+		Attempt:   task.AttemptCount,
+		Status:    models.AttemptStatusRunning,
+		StartedAt: time.Now(),
+	})
+}
+
+// RetryOrFail handles the fetch of a task failing with cause. A rate limited
+// fetch is rescheduled for when the rate limit resets, without counting against
+// the retry policy. A fetch failing with another transient error is retried with
+// backoff until the policy runs out of attempts. Any other error fails the task.
+// The fetch of a retried task resumes from its checkpoint.
+func (s *service) RetryOrFail(ctx context.Context, taskID string, cause error) error {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	var rateLimitErr dErrors.RateLimitError
+	switch {
+	case errors.As(cause, &rateLimitErr):
+		return s.scheduleRetry(ctx, task, cause, models.AttemptStatusRescheduled, rateLimitErr.ResetAt.Add(rateLimitMargin))
+	case dErrors.IsTransient(cause) && task.Retries+1 < s.retryPolicy.MaxAttempts:
+		retries := task.Retries + 1
+		if err := s.taskStore.SetRetries(ctx, taskID, retries); err != nil {
+			return err
+		}
+		return s.scheduleRetry(ctx, task, cause, models.AttemptStatusFailed, time.Now().Add(s.retryPolicy.backoff(retries)))
+	default:
+		return s.MarkFailed(ctx, taskID, cause.Error())
+	}
+}
+
+// scheduleRetry finishes the current attempt of a task and publishes its fetch
+// again for retryAt. The task stays in progress, and keeps its repository lease,
+// while it waits.
+func (s *service) scheduleRetry(ctx context.Context, task models.Task, cause error, attemptStatus string, retryAt time.Time) error {
+	if err := s.Heartbeat(ctx, task.ID, retryAt); err != nil {
+		if errors.Is(err, dErrors.ErrLeaseLost) {
+			return s.MarkFailed(ctx, task.ID, err.Error())
+		}
+		return err
+	}
+
+	if err := s.attemptStore.Finish(ctx, task.ID, attemptStatus, cause.Error(), &retryAt); err != nil {
+		return err
+	}
+	return s.publishFetch(ctx, task, retryAt)
+}
+
+// RetryTask runs a failed task again, with a new set of automatic retries. The
+// task keeps its fetch window, so its fetch resumes from its checkpoint. It is
+// queued when another task holds the repository lease.
+func (s *service) RetryTask(ctx context.Context, taskID string) error {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status != models.TaskStatusFailed {
+		return dErrors.ErrInvalidTaskTransition
+	}
+
+	if err := s.taskStore.SetRetries(ctx, taskID, 0); err != nil {
+		return err
+	}
+
+	acquired, err := s.leaseStore.Acquire(ctx, task.RepositoryID, task.ID, time.Now().Add(s.leaseTTL))
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		// the task starts once the task holding the lease has finished
+		return s.updateStatus(ctx, taskID, models.TaskStatusQueued, nil)
+	}
+
+	if err := s.updateStatus(ctx, taskID, models.TaskStatusPending, nil); err != nil {
+		return err
+	}
+	if task, err = s.taskStore.Get(ctx, taskID); err != nil {
+		return err
+	}
+
+	if err := s.publishFetch(ctx, task, time.Time{}); err != nil {
+		if ferr := s.MarkFailed(ctx, taskID, "failed to publish fetch commit event: "+err.Error()); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	return nil
+}
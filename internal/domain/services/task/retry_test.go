@@ -0,0 +1,56 @@
+package task
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		retry int
+		delay time.Duration
+	}{
+		{retry: 1, delay: 10 * time.Second},
+		{retry: 2, delay: 20 * time.Second},
+		{retry: 3, delay: 40 * time.Second},
+		{retry: 4, delay: time.Minute},
+		{retry: 100, delay: time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			backoff := policy.backoff(tt.retry)
+			assert.GreaterOrEqual(t, backoff, tt.delay/2, "retry %d", tt.retry)
+			assert.LessOrEqual(t, backoff, tt.delay, "retry %d", tt.retry)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff_LargeRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		delay  time.Duration
+	}{
+		{name: "past the shift overflowing the base delay", policy: RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: time.Hour}, retry: 31, delay: time.Hour},
+		{name: "past the bits of a duration", policy: RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: time.Hour}, retry: 100, delay: time.Hour},
+		{name: "largest retry", policy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Hour}, retry: math.MaxInt, delay: time.Hour},
+		{name: "uncapped", policy: RetryPolicy{BaseDelay: time.Second, MaxDelay: math.MaxInt64}, retry: 100, delay: math.MaxInt64},
+		{name: "base delay above the cap", policy: RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Minute}, retry: 1, delay: time.Minute},
+		{name: "no delay", policy: RetryPolicy{BaseDelay: 0, MaxDelay: time.Minute}, retry: 1000, delay: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := tt.policy.backoff(tt.retry)
+			assert.GreaterOrEqual(t, backoff, tt.delay/2)
+			assert.LessOrEqual(t, backoff, tt.delay)
+		})
+	}
+}
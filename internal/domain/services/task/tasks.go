@@ -2,110 +2,641 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/events"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/pkg/aftercommit"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
 )
 
 type (
 	service struct {
-		taskStore taskStore
-		repoStore repoStore
-		publisher publisher
+		taskStore       taskStore
+		batchStore      batchStore
+		checkpointStore checkpointStore
+		leaseStore      leaseStore
+		attemptStore    attemptStore
+		repoStore       repoStore
+		publisher       publisher
+		notifier        notifier
+		running         *registry
+		leaseTTL        time.Duration
+		retryPolicy     RetryPolicy
+		quietWindows    []models.QuietWindow
 	}
 
 	taskStore interface {
 		Get(ctx context.Context, taskID string) (models.Task, error)
+		GetForUpdate(ctx context.Context, taskID string) (models.Task, error)
 		Create(ctx context.Context, task models.Task) error
-		List(ctx context.Context) ([]models.Task, error)
-		UpdateStatus(ctx context.Context, taskID string, status string, errMsg *string) error
+		List(ctx context.Context, filter models.TaskFilter, pagination models.PaginationReq) ([]models.Task, models.Pagination, error)
+		CountByStatus(ctx context.Context, filter models.TaskFilter) (map[string]int64, error)
+		UpdateStatus(ctx context.Context, taskID string, from []string, status string, errMsg *string) error
+		SetTotalBatches(ctx context.Context, taskID string, total int) error
+		ListByStatus(ctx context.Context, statuses ...string) ([]models.Task, error)
+		ListForRepo(ctx context.Context, repoID string, statuses ...string) ([]models.Task, error)
+		ListStale(ctx context.Context, before time.Time) ([]models.Task, error)
+		ClaimStale(ctx context.Context, taskID string, before, at time.Time) (bool, error)
+		Heartbeat(ctx context.Context, taskID string, at time.Time) error
+		SetRetries(ctx context.Context, taskID string, retries int) error
+		RaisePriority(ctx context.Context, taskID string, priority int) error
+	}
+
+	attemptStore interface {
+		Create(ctx context.Context, attempt models.TaskAttempt) error
+		Finish(ctx context.Context, taskID string, status string, errMsg string, retryAt *time.Time) error
+		List(ctx context.Context, taskID string) ([]models.TaskAttempt, error)
+	}
+
+	leaseStore interface {
+		Acquire(ctx context.Context, repoID, taskID string, expiresAt time.Time) (bool, error)
+		Release(ctx context.Context, repoID, taskID string) error
+	}
+
+	checkpointStore interface {
+		Save(ctx context.Context, checkpoint models.TaskCheckpoint) error
+		Get(ctx context.Context, taskID string) (*models.TaskCheckpoint, error)
+	}
+
+	batchStore interface {
+		Upsert(ctx context.Context, batch models.BatchDetail) error
+		UpdateStatus(ctx context.Context, taskID string, batchID int, status string, errMsg *string) error
+		List(ctx context.Context, taskID string) ([]models.BatchDetail, error)
 	}
 
 	repoStore interface {
 		Get(ctx context.Context, RepoInfo models.RepoInfo) (models.Repository, error)
-		List(ctx context.Context) ([]models.Repository, error)
+	}
+
+	notifier interface {
+		Publish(event models.TaskEvent)
+		Subscribe(filter models.TaskEventFilter) (<-chan models.TaskEvent, func())
 	}
 
 	publisher interface {
-		Publish(ctx context.Context, topic string, message interface{}) error
+		Publish(ctx context.Context, topic string, message interface{}, opts ...eventbus.PublishOption) error
+		PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...eventbus.PublishOption) error
 	}
 )
 
-func New(taskStore taskStore, repoStore repoStore, publisher publisher) *service {
+// transitions lists, for every status a task can move to, the statuses it can
+// move from. A queued task becomes pending once it gets the repository lease. A
+// task in progress can be started again when its fetch event is redelivered or
+// rescheduled; a task in progress is cancelling until its fetch has stopped.
+// A failed task is pending or queued again when it is retried; completed and
+// cancelled are final.
+var transitions = map[string][]string{
+	models.TaskStatusQueued:     {models.TaskStatusFailed},
+	models.TaskStatusPending:    {models.TaskStatusQueued, models.TaskStatusFailed},
+	models.TaskStatusInProgress: {models.TaskStatusPending, models.TaskStatusInProgress},
+	models.TaskStatusCancelling: {models.TaskStatusInProgress},
+	models.TaskStatusCompleted:  {models.TaskStatusInProgress},
+	models.TaskStatusFailed:     {models.TaskStatusPending, models.TaskStatusInProgress, models.TaskStatusCancelling},
+	models.TaskStatusCancelled:  {models.TaskStatusQueued, models.TaskStatusPending, models.TaskStatusInProgress, models.TaskStatusCancelling},
+}
+
+func New(taskStore taskStore, batchStore batchStore, checkpointStore checkpointStore, leaseStore leaseStore, attemptStore attemptStore, repoStore repoStore, publisher publisher, notifier notifier, leaseTTL time.Duration, retryPolicy RetryPolicy, quietWindows []models.QuietWindow) *service {
 	return &service{
-		taskStore: taskStore,
-		repoStore: repoStore,
-		publisher: publisher,
+		taskStore:       taskStore,
+		batchStore:      batchStore,
+		checkpointStore: checkpointStore,
+		leaseStore:      leaseStore,
+		attemptStore:    attemptStore,
+		repoStore:       repoStore,
+		publisher:       publisher,
+		notifier:        notifier,
+		running:         newRegistry(),
+		leaseTTL:        leaseTTL,
+		retryPolicy:     retryPolicy,
+		quietWindows:    quietWindows,
 	}
 }
 
-func (s *service) StartTasks(ctx context.Context) error {
-	activeRepos, err := s.repoStore.List(ctx)
-	if err != nil {
-		return fmt.Errorf("error retrieving active repos %w", err)
+// StartScheduledTask creates the scheduled task of a repository, fetching the
+// commits since the last one fetched, or its whole history as a backfill when
+// none has been fetched yet
+func (s *service) StartScheduledTask(ctx context.Context, repo models.Repository) (string, error) {
+	priority := models.TaskPriorityScheduled
+	if repo.LastFetchedCommitTime == nil {
+		priority = models.TaskPriorityBackfill
 	}
+	return s.handleTask(ctx, repo, repo.LastFetchedCommitTime, models.TriggerTypeScheduled, priority)
+}
 
-	for _, repo := range activeRepos {
-		if !repo.IsActive {
-			continue
-		}
-		if _, err := s.handleTask(ctx, repo, repo.LastFetchedCommitTime); err != nil {
-			return fmt.Errorf("error starting task %w", err)
-		}
+// TriggerTask creates a task fetching the commits of a repository since the given
+// time, recording the trigger type that caused it
+func (s *service) TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time, triggerType string) (string, error) {
+	repo, err := s.repoStore.Get(ctx, RepoInfo)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving active repos %w", err)
 	}
-	return nil
+	return s.handleTask(ctx, repo, since, triggerType, triggerPriority(triggerType))
 }
 
-func (s *service) TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time) (string, error) {
+// TriggerManualTask creates a manual task fetching the commits of a repository.
+// It is refused while a global or repository quiet window is open, unless
+// override is set.
+func (s *service) TriggerManualTask(ctx context.Context, RepoInfo models.RepoInfo, override bool) (string, error) {
 	repo, err := s.repoStore.Get(ctx, RepoInfo)
 	if err != nil {
 		return "", fmt.Errorf("error retrieving active repos %w", err)
 	}
-	return s.handleTask(ctx, repo, since)
+
+	if !override {
+		windows := slices.Concat(s.quietWindows, repo.Schedule.QuietWindows)
+		if _, closesAt, quiet := models.QuietAt(time.Now(), windows); quiet {
+			return "", dErrors.ErrQuietWindow.WithError(fmt.Errorf("quiet window closes at %s", closesAt.Format(time.RFC3339)))
+		}
+	}
+	return s.handleTask(ctx, repo, nil, models.TriggerTypeManual, models.TaskPriorityManual)
+}
+
+// triggerPriority returns the priority of a task created by the given trigger
+func triggerPriority(triggerType string) int {
+	switch triggerType {
+	case models.TriggerTypeManual, models.TriggerTypeReset:
+		return models.TaskPriorityManual
+	case models.TriggerTypeWebhook:
+		return models.TaskPriorityWebhook
+	default:
+		return models.TaskPriorityScheduled
+	}
 }
 
-func (s *service) handleTask(ctx context.Context, repo models.Repository, since *time.Time) (string, error) {
+func (s *service) handleTask(ctx context.Context, repo models.Repository, since *time.Time, triggerType string, priority int) (string, error) {
+	// the fetch window is fixed when the task is created, so that retries of
+	// the task fetch the same commits and its progress can be measured
+	fetchSince := repo.CommitTrackingStartTime
+	if since != nil {
+		fetchSince = *since
+	}
+	fetchUntil := time.Now()
+
 	task := models.Task{
-		ID:            models.NewUUIDWithPrefix(models.TaskPrefix),
-		RepoName:      repo.Name,
-		RepositoryID:  repo.ID,
-		RepoOwner:     repo.Owner,
-		Status:        models.TaskStatusPending,
-		CreatedAt:     time.Now(),
+		ID:           models.NewUUIDWithPrefix(models.TaskPrefix),
+		RepoName:     repo.Name,
+		RepositoryID: repo.ID,
+		RepoOwner:    repo.Owner,
+		Status:       models.TaskStatusPending,
+		TriggerType:  triggerType,
+		Priority:     priority,
+		Since:        &fetchSince,
+		Until:        &fetchUntil,
+		CreatedAt:    time.Now(),
+	}
+
+	// only the task holding the lease of the repository fetches it, any other
+	// task joins an unfinished one covering its window or queues behind them
+	acquired, err := s.leaseStore.Acquire(ctx, repo.ID, task.ID, time.Now().Add(s.leaseTTL))
+	if err != nil {
+		return "", err
+	}
+	if !acquired {
+		return s.coalesceOrQueue(ctx, task)
 	}
+
 	if err := s.taskStore.Create(ctx, task); err != nil {
-		return "", fmt.Errorf("failed to create task")
+		if rerr := s.leaseStore.Release(ctx, repo.ID, task.ID); rerr != nil {
+			return "", fmt.Errorf("failed to create task and release lease: %w", rerr)
+		}
+		return "", fmt.Errorf("failed to create task: %w", err)
+	}
+
+	if err := s.publishFetch(ctx, task, time.Time{}); err != nil {
+		errMsg := fmt.Sprintf("failed to publish fetch commit event: %v", err)
+		if ferr := s.MarkFailed(ctx, task.ID, errMsg); ferr != nil {
+			return "", fmt.Errorf("failed to publish event and mark task failed: %w", ferr)
+		}
+		return "", fmt.Errorf("failed to publish event")
 	}
 
+	return task.ID, nil
+}
+
+// publishFetch publishes the fetch commit event of a task for its fetch window,
+// with the priority of the task, to be delivered at the given time or straight
+// away when it is zero. Within a transaction the event is only published once it
+// has committed.
+func (s *service) publishFetch(ctx context.Context, task models.Task, at time.Time) error {
 	event := events.FetchCommitEvent{
 		TaskID: task.ID,
 		RepoInfo: models.RepoInfo{
-			Owner: repo.Owner,
-			Name:  repo.Name,
+			Owner: task.RepoOwner,
+			Name:  task.RepoName,
 		},
-		RepoID:        repo.ID,
-		Since: repo.CommitTrackingStartTime,
+		RepoID: task.RepositoryID,
 	}
-	if since != nil {
-		event.Since = *since
+	if task.Since != nil {
+		event.Since = *task.Since
 	}
-	if err := s.publisher.Publish(ctx, events.FetchCommitEventTopic, event); err != nil {
-		return "", fmt.Errorf("failed to publish event")
+	if task.Until != nil {
+		event.Until = *task.Until
 	}
 
-	return task.ID, nil
+	opts := []eventbus.PublishOption{
+		eventbus.WithCorrelationID(task.ID),
+		eventbus.WithSchemaVersion(events.FetchCommitEventVersion),
+		eventbus.WithPriority(task.Priority),
+	}
+	return aftercommit.Do(ctx, func(ctx context.Context) error {
+		if at.IsZero() {
+			return s.publisher.Publish(ctx, events.FetchCommitEventTopic, event, opts...)
+		}
+		return s.publisher.PublishAt(ctx, events.FetchCommitEventTopic, event, at, opts...)
+	})
 }
 
-func (s *service) List(ctx context.Context) ([]models.Task, error) {
-	return s.taskStore.List(ctx)
+// ResumeTasks picks up the tasks interrupted by the process stopping, i.e. the
+// tasks with no heartbeat or status change within staleAfter. Tasks whose
+// heartbeat is fresher may still be running in another process, or have their
+// fetch event redelivered by the event bus, and are left alone. Tasks in progress
+// are fetched again and resume from their checkpoint, while tasks that were
+// cancelling are marked cancelled since their fetch has stopped. Instances
+// starting together find the same tasks, and only the one claiming a task first
+// fetches it again.
+func (s *service) ResumeTasks(ctx context.Context, staleAfter time.Duration) error {
+	before := time.Now().Add(-staleAfter)
+	tasks, err := s.taskStore.ListStale(ctx, before)
+	if err != nil {
+		return fmt.Errorf("error retrieving interrupted tasks %w", err)
+	}
+
+	var errs []error
+	for _, task := range tasks {
+		if task.Status == models.TaskStatusCancelling {
+			if err := s.FinishCancel(ctx, task.ID); err != nil && !errors.Is(err, dErrors.ErrInvalidTaskTransition) {
+				errs = append(errs, fmt.Errorf("error cancelling task %s: %w", task.ID, err))
+			}
+			continue
+		}
+		if task.Status != models.TaskStatusInProgress {
+			// pending tasks haven't started, and are left to the watchdog
+			continue
+		}
+
+		claimed, err := s.taskStore.ClaimStale(ctx, task.ID, before, time.Now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error resuming task %s: %w", task.ID, err))
+			continue
+		}
+		if !claimed {
+			// resumed by another instance, or alive again since it was listed
+			continue
+		}
+
+		// the lease may have expired and been taken over while the process was down
+		if err := s.Heartbeat(ctx, task.ID, time.Now()); err != nil {
+			if errors.Is(err, dErrors.ErrLeaseLost) {
+				err = s.MarkFailed(ctx, task.ID, err.Error())
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error resuming task %s: %w", task.ID, err))
+			}
+			continue
+		}
+
+		if err := s.attemptStore.Finish(ctx, task.ID, models.AttemptStatusFailed, "interrupted by the process stopping", nil); err != nil {
+			errs = append(errs, fmt.Errorf("error resuming task %s: %w", task.ID, err))
+			continue
+		}
+		if err := s.publishFetch(ctx, task, time.Time{}); err != nil {
+			errs = append(errs, fmt.Errorf("error resuming task %s: %w", task.ID, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
+// GetCheckpoint returns the checkpoint of a task, or nil when none of its batches
+// has been saved yet
+func (s *service) GetCheckpoint(ctx context.Context, taskID string) (*models.TaskCheckpoint, error) {
+	return s.checkpointStore.Get(ctx, taskID)
+}
+
+// List returns a page of the tasks matching the filter, with the number of tasks
+// in every status
+func (s *service) List(ctx context.Context, filter models.TaskFilter, pagination models.PaginationReq) (models.TaskList, error) {
+	tasks, page, err := s.taskStore.List(ctx, filter, pagination)
+	if err != nil {
+		return models.TaskList{}, err
+	}
+
+	summary, err := s.taskStore.CountByStatus(ctx, filter)
+	if err != nil {
+		return models.TaskList{}, err
+	}
+
+	return models.TaskList{
+		Tasks:      tasks,
+		Pagination: page,
+		Summary:    summary,
+	}, nil
+}
+
+// GetTask returns a task along with its batches and the progress they add up to,
+// and its attempts
 func (s *service) GetTask(ctx context.Context, taskID string) (models.Task, error) {
-	return s.taskStore.Get(ctx, taskID)
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	batches, err := s.batchStore.List(ctx, taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	attempts, err := s.attemptStore.List(ctx, taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	progress := calculateProgress(task, batches, time.Now())
+	task.Progress = &progress
+	task.Batches = batches
+	task.Attempts = attempts
+
+	return task, nil
 }
 
-func (s *service) UpdateStatus(ctx context.Context, taskID string, status string, errMsg *string) error {
-	return s.taskStore.UpdateStatus(ctx, taskID, status, errMsg)
+// RecordBatchFetched records a batch of commits fetched for a task, before it is
+// handed over to be saved
+func (s *service) RecordBatchFetched(ctx context.Context, taskID string, batchID int, commits []models.Commit) error {
+	batch := models.BatchDetail{
+		TaskID:      taskID,
+		BatchID:     batchID,
+		CommitCount: len(commits),
+		Status:      models.BatchStatusFetched,
+		FetchedAt:   time.Now(),
+	}
+	if len(commits) > 0 {
+		// commits are fetched newest first
+		batch.NewestCommitTime = commits[0].Date
+		batch.OldestCommitTime = commits[len(commits)-1].Date
+	}
+
+	if err := s.batchStore.Upsert(ctx, batch); err != nil {
+		return err
+	}
+	return s.notifyBatch(ctx, taskID, batchID)
+}
+
+// RecordBatchSaved marks a batch saved and completes the task if it was the last one
+func (s *service) RecordBatchSaved(ctx context.Context, taskID string, batchID int) error {
+	if err := s.batchStore.UpdateStatus(ctx, taskID, batchID, models.BatchStatusSaved, nil); err != nil {
+		return err
+	}
+	// saving batches is progress too, once the fetch has finished it is the
+	// only sign the task is alive
+	if err := s.taskStore.Heartbeat(ctx, taskID, time.Now()); err != nil {
+		return err
+	}
+
+	task, batches, err := s.getWithBatches(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if err := s.saveCheckpoint(ctx, task, batches); err != nil {
+		return err
+	}
+	s.publishBatch(ctx, task, batches, batchID)
+	return s.completeIfDone(ctx, taskID)
+}
+
+// RecordBatchFailed records why a batch couldn't be saved
+func (s *service) RecordBatchFailed(ctx context.Context, taskID string, batchID int, errMsg string) error {
+	if err := s.batchStore.UpdateStatus(ctx, taskID, batchID, models.BatchStatusFailed, &errMsg); err != nil {
+		return err
+	}
+	return s.notifyBatch(ctx, taskID, batchID)
+}
+
+// FinishFetch records the number of batches fetched for a task and completes the
+// task if they have all been saved already. Otherwise the task is completed when
+// its last batch is saved.
+func (s *service) FinishFetch(ctx context.Context, taskID string, totalBatches int) error {
+	if err := s.taskStore.SetTotalBatches(ctx, taskID, totalBatches); err != nil {
+		return err
+	}
+	if err := s.attemptStore.Finish(ctx, taskID, models.AttemptStatusSucceeded, "", nil); err != nil {
+		return err
+	}
+	return s.completeIfDone(ctx, taskID)
+}
+
+func (s *service) getWithBatches(ctx context.Context, taskID string) (models.Task, []models.BatchDetail, error) {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return models.Task{}, nil, err
+	}
+
+	batches, err := s.batchStore.List(ctx, taskID)
+	if err != nil {
+		return models.Task{}, nil, err
+	}
+	return task, batches, nil
+}
+
+// saveCheckpoint moves the checkpoint of a task up to the last batch saved with
+// all the batches before it. Batches are saved concurrently, so a later batch
+// saved first doesn't move the checkpoint until the gap before it is filled.
+func (s *service) saveCheckpoint(ctx context.Context, task models.Task, batches []models.BatchDetail) error {
+	page := savedPages(batches)
+	if page == 0 || task.Until == nil {
+		return nil
+	}
+
+	return s.checkpointStore.Save(ctx, models.TaskCheckpoint{
+		TaskID:           task.ID,
+		Page:             page,
+		Until:            *task.Until,
+		OldestCommitTime: batches[page-1].OldestCommitTime,
+		UpdatedAt:        time.Now(),
+	})
+}
+
+// savedPages returns the number of pages saved without gaps from the first one.
+// A batch holds one page of commits and batch IDs match page numbers.
+func savedPages(batches []models.BatchDetail) int {
+	page := 0
+	for _, batch := range batches {
+		if batch.BatchID != page+1 || batch.Status != models.BatchStatusSaved {
+			break
+		}
+		page++
+	}
+	return page
+}
+
+// completeIfDone completes a task once its fetch has finished and all of its
+// batches have been saved. The saver and the fetcher check concurrently, so the
+// task is read with its row locked: the check running second waits for the first
+// to commit, and sees both the total and the last batch saved.
+func (s *service) completeIfDone(ctx context.Context, taskID string) error {
+	task, err := s.taskStore.GetForUpdate(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task.TotalBatches == nil || task.Status != models.TaskStatusInProgress {
+		return nil
+	}
+	batches, err := s.batchStore.List(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	saved := 0
+	for _, batch := range batches {
+		if batch.BatchID <= *task.TotalBatches && batch.Status == models.BatchStatusSaved {
+			saved++
+		}
+	}
+	if saved < *task.TotalBatches {
+		return nil
+	}
+
+	err = s.MarkCompleted(ctx, task.ID)
+	if errors.Is(err, dErrors.ErrInvalidTaskTransition) {
+		// completed concurrently by the fetcher or another saver
+		return nil
+	}
+	return err
+}
+
+// MarkStarted moves a task to in_progress and records a new attempt
+func (s *service) MarkStarted(ctx context.Context, taskID string) error {
+	return s.updateStatus(ctx, taskID, models.TaskStatusInProgress, nil)
+}
+
+// MarkCompleted moves a task in progress to completed
+func (s *service) MarkCompleted(ctx context.Context, taskID string) error {
+	return s.updateStatus(ctx, taskID, models.TaskStatusCompleted, nil)
+}
+
+// MarkFailed moves a task that hasn't finished yet to failed, recording the reason
+func (s *service) MarkFailed(ctx context.Context, taskID string, errMsg string) error {
+	return s.updateStatus(ctx, taskID, models.TaskStatusFailed, &errMsg)
+}
+
+// MarkCancelled moves a task that hasn't finished yet to cancelled
+func (s *service) MarkCancelled(ctx context.Context, taskID string) error {
+	return s.updateStatus(ctx, taskID, models.TaskStatusCancelled, nil)
+}
+
+// FinishCancel moves a cancelling task to cancelled once its fetch has stopped.
+// It returns ErrInvalidTaskTransition when the task isn't cancelling, e.g. when
+// a stale fetch event is delivered for a task queued again since.
+func (s *service) FinishCancel(ctx context.Context, taskID string) error {
+	return s.updateStatusFrom(ctx, taskID, []string{models.TaskStatusCancelling}, models.TaskStatusCancelled, nil)
+}
+
+// CancelTask cancels a task. A pending task, or a task in progress waiting for
+// its fetch to be retried, is cancelled straight away, which releases its
+// repository lease. A task whose fetch is running is marked cancelling and the
+// context of its fetch is cancelled when it runs in this process; fetchers in
+// other processes notice the status between batches. The fetcher marks the task
+// cancelled once it has stopped, and the batches it had already fetched are
+// discarded by the saver.
+func (s *service) CancelTask(ctx context.Context, taskID string) error {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	switch task.Status {
+	case models.TaskStatusQueued, models.TaskStatusPending:
+		err = s.MarkCancelled(ctx, taskID)
+	case models.TaskStatusInProgress:
+		var fetching bool
+		if fetching, err = s.isFetching(ctx, taskID); err != nil {
+			return err
+		}
+		if fetching {
+			err = s.updateStatus(ctx, taskID, models.TaskStatusCancelling, nil)
+		} else {
+			err = s.MarkCancelled(ctx, taskID)
+		}
+	case models.TaskStatusCancelling:
+		// cancelling again reaches fetches that started since the first request
+	default:
+		return dErrors.ErrInvalidTaskTransition
+	}
+	if err != nil {
+		return err
+	}
+
+	s.running.cancel(taskID)
+	return nil
+}
+
+// isFetching reports whether the fetch of a task in progress is running, in any
+// process, rather than waiting to be retried or resumed
+func (s *service) isFetching(ctx context.Context, taskID string) (bool, error) {
+	attempts, err := s.attemptStore.List(ctx, taskID)
+	if err != nil {
+		return false, err
+	}
+	for _, attempt := range attempts {
+		if attempt.Status == models.AttemptStatusRunning {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsCancelled reports whether a task has been asked to cancel
+func (s *service) IsCancelled(ctx context.Context, taskID string) (bool, error) {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return false, err
+	}
+	return task.Status == models.TaskStatusCancelling || task.Status == models.TaskStatusCancelled, nil
+}
+
+// WithCancellation returns a copy of ctx that is cancelled with ErrTaskCancelled
+// when the task is cancelled. The returned function must be called once the work
+// on the task is done.
+func (s *service) WithCancellation(ctx context.Context, taskID string) (context.Context, context.CancelFunc) {
+	return s.running.add(ctx, taskID)
+}
+
+func (s *service) updateStatus(ctx context.Context, taskID string, status string, errMsg *string) error {
+	from, ok := transitions[status]
+	if !ok {
+		return dErrors.ErrInvalidTaskTransition
+	}
+	return s.updateStatusFrom(ctx, taskID, from, status, errMsg)
+}
+
+// updateStatusFrom moves a task to status from one of the given statuses, which
+// narrow the ones transitions allows
+func (s *service) updateStatusFrom(ctx context.Context, taskID string, from []string, status string, errMsg *string) error {
+	if err := s.taskStore.UpdateStatus(ctx, taskID, from, status, errMsg); err != nil {
+		return err
+	}
+	if err := s.notifyStatus(ctx, taskID); err != nil {
+		return err
+	}
+
+	switch status {
+	case models.TaskStatusInProgress:
+		return s.startAttempt(ctx, taskID)
+	case models.TaskStatusFailed:
+		if err := s.attemptStore.Finish(ctx, taskID, models.AttemptStatusFailed, *errMsg, nil); err != nil {
+			return err
+		}
+		return s.releaseLease(ctx, taskID)
+	case models.TaskStatusCancelled:
+		if err := s.attemptStore.Finish(ctx, taskID, models.AttemptStatusCancelled, "", nil); err != nil {
+			return err
+		}
+		return s.releaseLease(ctx, taskID)
+	case models.TaskStatusCompleted:
+		return s.releaseLease(ctx, taskID)
+	}
+	return nil
 }
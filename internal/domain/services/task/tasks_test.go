@@ -0,0 +1,334 @@
+package task
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/events"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+)
+
+func TestSavedPages(t *testing.T) {
+	batches := []models.BatchDetail{
+		{BatchID: 1, Status: models.BatchStatusSaved},
+		{BatchID: 2, Status: models.BatchStatusSaved},
+		{BatchID: 3, Status: models.BatchStatusFetched},
+		{BatchID: 4, Status: models.BatchStatusSaved},
+	}
+	assert.Equal(t, 2, savedPages(batches))
+
+	// a gap holds the checkpoint back until it is saved
+	batches[2].Status = models.BatchStatusSaved
+	assert.Equal(t, 4, savedPages(batches))
+
+	assert.Equal(t, 0, savedPages(batches[1:]))
+	assert.Equal(t, 0, savedPages(nil))
+}
+
+// fakeTaskStore holds the tasks. snapshot, when set, is what Get returns for a
+// task instead, as a read made before a concurrent write, while GetForUpdate
+// waits for it and always returns the latest.
+type fakeTaskStore struct {
+	taskStore
+	tasks    map[string]models.Task
+	snapshot map[string]models.Task
+}
+
+func (f *fakeTaskStore) Get(ctx context.Context, taskID string) (models.Task, error) {
+	if task, ok := f.snapshot[taskID]; ok {
+		return task, nil
+	}
+	return f.tasks[taskID], nil
+}
+
+func (f *fakeTaskStore) GetForUpdate(ctx context.Context, taskID string) (models.Task, error) {
+	return f.tasks[taskID], nil
+}
+
+func (f *fakeTaskStore) SetTotalBatches(ctx context.Context, taskID string, total int) error {
+	task := f.tasks[taskID]
+	task.TotalBatches = &total
+	f.tasks[taskID] = task
+	return nil
+}
+
+func (f *fakeTaskStore) ListStale(ctx context.Context, before time.Time) ([]models.Task, error) {
+	var stale []models.Task
+	for _, task := range f.tasks {
+		lastSeen := task.CreatedAt
+		if task.HeartbeatAt != nil {
+			lastSeen = *task.HeartbeatAt
+		}
+		if lastSeen.Before(before) {
+			stale = append(stale, task)
+		}
+	}
+	return stale, nil
+}
+
+func (f *fakeTaskStore) ClaimStale(ctx context.Context, taskID string, before, at time.Time) (bool, error) {
+	task := f.tasks[taskID]
+	lastSeen := task.CreatedAt
+	if task.HeartbeatAt != nil {
+		lastSeen = *task.HeartbeatAt
+	}
+	if !lastSeen.Before(before) {
+		return false, nil
+	}
+	task.HeartbeatAt = &at
+	f.tasks[taskID] = task
+	return true, nil
+}
+
+func (f *fakeTaskStore) Heartbeat(ctx context.Context, taskID string, at time.Time) error {
+	task := f.tasks[taskID]
+	task.HeartbeatAt = &at
+	f.tasks[taskID] = task
+	return nil
+}
+
+func (f *fakeTaskStore) UpdateStatus(ctx context.Context, taskID string, from []string, status string, errMsg *string) error {
+	task := f.tasks[taskID]
+	if !slices.Contains(from, task.Status) {
+		return dErrors.ErrInvalidTaskTransition
+	}
+	task.Status = status
+	f.tasks[taskID] = task
+	return nil
+}
+
+func (f *fakeTaskStore) Create(ctx context.Context, task models.Task) error {
+	f.tasks[task.ID] = task
+	return nil
+}
+
+func (f *fakeTaskStore) ListForRepo(ctx context.Context, repoID string, statuses ...string) ([]models.Task, error) {
+	var tasks []models.Task
+	for _, task := range f.tasks {
+		if task.RepositoryID == repoID && slices.Contains(statuses, task.Status) {
+			tasks = append(tasks, task)
+		}
+	}
+	slices.SortFunc(tasks, func(a, b models.Task) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return tasks, nil
+}
+
+func (f *fakeTaskStore) RaisePriority(ctx context.Context, taskID string, priority int) error {
+	task := f.tasks[taskID]
+	task.Priority = max(task.Priority, priority)
+	f.tasks[taskID] = task
+	return nil
+}
+
+type fakeBatchStore struct {
+	batchStore
+	batches []models.BatchDetail
+}
+
+func (f *fakeBatchStore) UpdateStatus(ctx context.Context, taskID string, batchID int, status string, errMsg *string) error {
+	for i := range f.batches {
+		if f.batches[i].TaskID == taskID && f.batches[i].BatchID == batchID {
+			f.batches[i].Status = status
+		}
+	}
+	return nil
+}
+
+func (f *fakeBatchStore) List(ctx context.Context, taskID string) ([]models.BatchDetail, error) {
+	var batches []models.BatchDetail
+	for _, batch := range f.batches {
+		if batch.TaskID == taskID {
+			batches = append(batches, batch)
+		}
+	}
+	return batches, nil
+}
+
+type fakeCheckpointStore struct{ checkpointStore }
+
+func (f *fakeCheckpointStore) Save(ctx context.Context, checkpoint models.TaskCheckpoint) error {
+	return nil
+}
+
+// fakeLeaseStore holds the leases of the repositories, ignoring their expiry.
+// denied, when set, is called every time a lease is held by another task.
+type fakeLeaseStore struct {
+	held   map[string]string
+	denied func()
+}
+
+func (f *fakeLeaseStore) Acquire(ctx context.Context, repoID, taskID string, expiresAt time.Time) (bool, error) {
+	if f.held == nil {
+		f.held = map[string]string{}
+	}
+	if holder, ok := f.held[repoID]; ok && holder != taskID {
+		if f.denied != nil {
+			f.denied()
+		}
+		return false, nil
+	}
+	f.held[repoID] = taskID
+	return true, nil
+}
+
+func (f *fakeLeaseStore) Release(ctx context.Context, repoID, taskID string) error {
+	if f.held[repoID] == taskID {
+		delete(f.held, repoID)
+	}
+	return nil
+}
+
+type fakeAttemptStore struct {
+	attemptStore
+	attempts []models.TaskAttempt
+}
+
+func (f *fakeAttemptStore) List(ctx context.Context, taskID string) ([]models.TaskAttempt, error) {
+	var attempts []models.TaskAttempt
+	for _, attempt := range f.attempts {
+		if attempt.TaskID == taskID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
+func (f *fakeAttemptStore) Finish(ctx context.Context, taskID string, status string, errMsg string, retryAt *time.Time) error {
+	return nil
+}
+
+type fakeNotifier struct{ notifier }
+
+func (f *fakeNotifier) Publish(event models.TaskEvent) {}
+
+type fakePublisher struct {
+	published []string
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, topic string, message interface{}, opts ...eventbus.PublishOption) error {
+	f.published = append(f.published, message.(events.FetchCommitEvent).TaskID)
+	return nil
+}
+
+func (f *fakePublisher) PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...eventbus.PublishOption) error {
+	return f.Publish(ctx, topic, message, opts...)
+}
+
+func TestResumeTasks(t *testing.T) {
+	now := time.Now()
+	fresh, stale := now.Add(-time.Second), now.Add(-time.Hour)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"running":          {ID: "running", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, HeartbeatAt: &fresh},
+		"interrupted":      {ID: "interrupted", RepositoryID: "repo-2", Status: models.TaskStatusInProgress, HeartbeatAt: &stale},
+		"cancelling":       {ID: "cancelling", RepositoryID: "repo-3", Status: models.TaskStatusCancelling, HeartbeatAt: &fresh},
+		"stale-cancelling": {ID: "stale-cancelling", RepositoryID: "repo-4", Status: models.TaskStatusCancelling, HeartbeatAt: &stale},
+		"stale-pending":    {ID: "stale-pending", RepositoryID: "repo-5", Status: models.TaskStatusPending, CreatedAt: stale},
+	}}
+	publisher := &fakePublisher{}
+	svc := New(tasks, &fakeBatchStore{}, nil, &fakeLeaseStore{}, &fakeAttemptStore{}, nil, publisher, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	require.NoError(t, svc.ResumeTasks(context.Background(), 10*time.Minute))
+
+	// a task with a fresh heartbeat may still be running elsewhere, or have its
+	// fetch event redelivered, so it isn't fetched again
+	assert.Equal(t, []string{"interrupted"}, publisher.published)
+	assert.Equal(t, models.TaskStatusInProgress, tasks.tasks["running"].Status)
+	assert.Equal(t, models.TaskStatusCancelling, tasks.tasks["cancelling"].Status)
+	assert.Equal(t, models.TaskStatusCancelled, tasks.tasks["stale-cancelling"].Status)
+	assert.Equal(t, models.TaskStatusPending, tasks.tasks["stale-pending"].Status)
+}
+
+func TestCompleteWhenLastSaveAndFinishFetchInterleave(t *testing.T) {
+	until := time.Now()
+	task := models.Task{ID: "task", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, Until: &until}
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{task.ID: task}}
+	batches := &fakeBatchStore{batches: []models.BatchDetail{
+		{TaskID: task.ID, BatchID: 1, Status: models.BatchStatusSaved},
+		{TaskID: task.ID, BatchID: 2, Status: models.BatchStatusFetched},
+	}}
+	svc := New(tasks, batches, &fakeCheckpointStore{}, &fakeLeaseStore{}, &fakeAttemptStore{}, nil, &fakePublisher{}, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	// the fetch finishes before the last batch is saved, and leaves the task to
+	// the saver
+	require.NoError(t, svc.FinishFetch(context.Background(), task.ID, 2))
+	assert.Equal(t, models.TaskStatusInProgress, tasks.tasks[task.ID].Status)
+
+	// the saver read the task before the fetch recorded the total
+	tasks.snapshot = map[string]models.Task{task.ID: task}
+	require.NoError(t, svc.RecordBatchSaved(context.Background(), task.ID, 2))
+	assert.Equal(t, models.TaskStatusCompleted, tasks.tasks[task.ID].Status)
+}
+
+func TestFinishCancel(t *testing.T) {
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"cancelling": {ID: "cancelling", RepositoryID: "repo-1", Status: models.TaskStatusCancelling},
+		"queued":     {ID: "queued", RepositoryID: "repo-2", Status: models.TaskStatusQueued},
+	}}
+	svc := New(tasks, &fakeBatchStore{}, nil, &fakeLeaseStore{}, &fakeAttemptStore{}, nil, &fakePublisher{}, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	require.NoError(t, svc.FinishCancel(context.Background(), "cancelling"))
+	assert.Equal(t, models.TaskStatusCancelled, tasks.tasks["cancelling"].Status)
+
+	// a stale fetch event of a task queued again doesn't cancel it
+	assert.ErrorIs(t, svc.FinishCancel(context.Background(), "queued"), dErrors.ErrInvalidTaskTransition)
+	assert.Equal(t, models.TaskStatusQueued, tasks.tasks["queued"].Status)
+}
+
+func TestCancelTask(t *testing.T) {
+	retryAt := time.Now().Add(time.Minute)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"fetching": {ID: "fetching", RepositoryID: "repo-1", Status: models.TaskStatusInProgress},
+		"waiting":  {ID: "waiting", RepositoryID: "repo-2", Status: models.TaskStatusInProgress},
+	}}
+	attempts := &fakeAttemptStore{attempts: []models.TaskAttempt{
+		{TaskID: "fetching", Attempt: 1, Status: models.AttemptStatusRunning},
+		{TaskID: "waiting", Attempt: 1, Status: models.AttemptStatusRescheduled, RetryAt: &retryAt},
+	}}
+	leases := &fakeLeaseStore{held: map[string]string{"repo-1": "fetching", "repo-2": "waiting"}}
+	svc := New(tasks, &fakeBatchStore{}, nil, leases, attempts, nil, &fakePublisher{}, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	// the fetch running is stopped before the task is cancelled
+	require.NoError(t, svc.CancelTask(context.Background(), "fetching"))
+	assert.Equal(t, models.TaskStatusCancelling, tasks.tasks["fetching"].Status)
+	assert.Equal(t, "fetching", leases.held["repo-1"])
+
+	// a task waiting for its fetch to be retried has nothing to stop
+	require.NoError(t, svc.CancelTask(context.Background(), "waiting"))
+	assert.Equal(t, models.TaskStatusCancelled, tasks.tasks["waiting"].Status)
+	assert.NotContains(t, leases.held, "repo-2")
+}
+
+func TestResumeTasks_ClaimsEachTaskOnce(t *testing.T) {
+	stale := time.Now().Add(-time.Hour)
+	tasks := &fakeTaskStore{tasks: map[string]models.Task{
+		"interrupted": {ID: "interrupted", RepositoryID: "repo-1", Status: models.TaskStatusInProgress, HeartbeatAt: &stale},
+	}}
+	publisher := &fakePublisher{}
+	leases := &fakeLeaseStore{}
+
+	// two instances starting together both list the task before either claims it
+	listed, err := tasks.ListStale(context.Background(), time.Now())
+	require.NoError(t, err)
+	first := New(&listedTaskStore{fakeTaskStore: tasks, listed: listed}, &fakeBatchStore{}, nil, leases, &fakeAttemptStore{}, nil, publisher, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+	second := New(&listedTaskStore{fakeTaskStore: tasks, listed: listed}, &fakeBatchStore{}, nil, leases, &fakeAttemptStore{}, nil, publisher, &fakeNotifier{}, time.Minute, RetryPolicy{}, nil)
+
+	require.NoError(t, first.ResumeTasks(context.Background(), 10*time.Minute))
+	require.NoError(t, second.ResumeTasks(context.Background(), 10*time.Minute))
+	assert.Equal(t, []string{"interrupted"}, publisher.published)
+}
+
+// listedTaskStore lists the stale tasks as they were before any was claimed
+type listedTaskStore struct {
+	*fakeTaskStore
+	listed []models.Task
+}
+
+func (f *listedTaskStore) ListStale(ctx context.Context, before time.Time) ([]models.Task, error) {
+	return f.listed, nil
+}
@@ -0,0 +1,85 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// Heartbeat records that a task is alive as of at and keeps its repository lease
+// until the lease TTL after at. at is in the future when the fetch of the task is
+// waiting to resume, e.g. for a rate limit to reset. It returns ErrLeaseLost when
+// the lease expired and another task took it over.
+func (s *service) Heartbeat(ctx context.Context, taskID string, at time.Time) error {
+	task, err := s.taskStore.Get(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	acquired, err := s.leaseStore.Acquire(ctx, task.RepositoryID, task.ID, at.Add(s.leaseTTL))
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return dErrors.ErrLeaseLost
+	}
+
+	return s.taskStore.Heartbeat(ctx, taskID, at)
+}
+
+// ReapStaleTasks finishes the tasks with no heartbeat or status change within
+// timeout, whose worker has died or whose fetch event was lost. Stale tasks are
+// marked failed, or cancelled when they were cancelling, which releases their
+// repository lease. With requeue, a new task is triggered for the same window
+// of every failed task.
+func (s *service) ReapStaleTasks(ctx context.Context, timeout time.Duration, requeue bool) (int, error) {
+	stale, err := s.taskStore.ListStale(ctx, time.Now().Add(-timeout))
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving stale tasks %w", err)
+	}
+
+	reaped := 0
+	var errs []error
+	for _, task := range stale {
+		if task.Status == models.TaskStatusCancelling {
+			err = s.FinishCancel(ctx, task.ID)
+		} else {
+			lastSeen := task.CreatedAt
+			if task.HeartbeatAt != nil {
+				lastSeen = *task.HeartbeatAt
+			}
+			err = s.MarkFailed(ctx, task.ID, fmt.Sprintf("no heartbeat since %s, the worker running the task stopped", lastSeen.Format(time.RFC3339)))
+		}
+		if errors.Is(err, dErrors.ErrInvalidTaskTransition) {
+			// the task moved on since it was listed
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reaping task %s: %w", task.ID, err))
+			continue
+		}
+		reaped++
+
+		if requeue && task.Status != models.TaskStatusCancelling {
+			if err := s.requeue(ctx, task); err != nil {
+				errs = append(errs, fmt.Errorf("error requeueing task %s: %w", task.ID, err))
+			}
+		}
+	}
+	return reaped, errors.Join(errs...)
+}
+
+// requeue triggers a new task for the repository and window of a reaped task
+func (s *service) requeue(ctx context.Context, task models.Task) error {
+	repo, err := s.repoStore.Get(ctx, models.RepoInfo{Owner: task.RepoOwner, Name: task.RepoName})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.handleTask(ctx, repo, task.Since, task.TriggerType, task.Priority)
+	return err
+}
@@ -47,10 +47,13 @@ func MapError(err error) (int, HTTPError) {
 	var de domainErr.DomainError
 	if errors.As(err, &de) { // Use errors.As to handle wrapped errors
 		switch de.Code {
-		case "RepositoryNotFound", "TrackedRepositoryNotFound", "JobNotFound":
+		case "InvalidInput":
+			return http.StatusBadRequest, NewHTTPError(de.Code, de.Message)
+
+		case "RepositoryNotFound", "TrackedRepositoryNotFound", "ErrTaskNotFound":
 			return http.StatusNotFound, NewHTTPError(de.Code, de.Message)
 
-		case "DuplicateRepository":
+		case "DuplicateRepository", "InvalidTaskTransition", "QuietWindow":
 			return http.StatusConflict, NewHTTPError(de.Code, de.Message)
 
 		case "Unauthorized":
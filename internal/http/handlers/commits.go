@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	domainModels "github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/http/errors"
 	"github.com/victor-nach/git-monitor/internal/http/models"
 	"github.com/victor-nach/git-monitor/internal/http/utils"
@@ -54,14 +55,19 @@ func (h *Handler) ListCommits(c *gin.Context) {
 	}
 	log = utils.WithRepoInfo(log, repoInfo)
 
-	paginationRq := utils.ExtractPaginationReq(c)
+	paginationRq, err := utils.ExtractPaginationReq(c)
+	if err != nil {
+		log.Error("invalid pagination parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
 	log = log.With(
 		zap.Int("limit", paginationRq.Limit),
 		zap.String("cursor", paginationRq.Cursor))
 
 	log.Info("handling List commits API request")
 
-	commits, cursor, err := h.commitSvc.List(c.Request.Context(), repoInfo, paginationRq)
+	commits, page, err := h.commitSvc.List(c.Request.Context(), repoInfo, paginationRq)
 	if err != nil {
 		log.Error("failed to list commits", zap.Error(err))
 		status, httpErr := errors.MapError(err)
@@ -69,14 +75,10 @@ func (h *Handler) ListCommits(c *gin.Context) {
 		return
 	}
 
-	paginationResp := models.Pagination{
-		NextCursor:     cursor,
-		PreviousCursor: paginationRq.Cursor,
-	}
 	resp := models.APIResponse{
 		Status:     models.SuccessStatus,
 		Message:    "Commits listed successfully",
-		Pagination: &paginationResp,
+		Pagination: models.NewPagination(page),
 		Data:       commits,
 	}
 
@@ -84,3 +86,64 @@ func (h *Handler) ListCommits(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// SearchCommits searches the commit messages of a repository
+func (h *Handler) SearchCommits(c *gin.Context) {
+	log := h.log.With(zap.String("method", "SearchCommits"))
+
+	repoInfo, err := GetRepoInfo(c.Request.Context())
+	if err != nil {
+		h.log.Error("failed to retrieve repository info from context", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, errors.ErrInternalServer)
+		return
+	}
+
+	h.searchCommits(c, utils.WithRepoInfo(log, repoInfo), &repoInfo)
+}
+
+// SearchAllCommits searches the commit messages of every tracked repository
+func (h *Handler) SearchAllCommits(c *gin.Context) {
+	h.searchCommits(c, h.log.With(zap.String("method", "SearchAllCommits")), nil)
+}
+
+func (h *Handler) searchCommits(c *gin.Context, log *zap.Logger, repoInfo *domainModels.RepoInfo) {
+	query := c.Query("q")
+	expr, err := domainModels.ParseSearchQuery(query)
+	if err != nil {
+		httpErr := errors.ErrInputValidation(err.Error())
+		log.Error("invalid search query", zap.Error(err))
+		c.JSON(http.StatusBadRequest, httpErr)
+		return
+	}
+
+	paginationRq, err := utils.ExtractPaginationReq(c)
+	if err != nil {
+		log.Error("invalid pagination parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(
+		zap.String("query", query),
+		zap.Int("limit", paginationRq.Limit),
+		zap.String("cursor", paginationRq.Cursor))
+
+	log.Info("handling search commits API request")
+
+	matches, page, err := h.commitSvc.Search(c.Request.Context(), expr, repoInfo, paginationRq)
+	if err != nil {
+		log.Error("failed to search commits", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:     models.SuccessStatus,
+		Message:    "Commits searched successfully",
+		Pagination: models.NewPagination(page),
+		Data:       matches,
+	}
+
+	log.Info("commits searched successfully", zap.Int("count", len(matches)))
+	c.JSON(http.StatusOK, resp)
+}
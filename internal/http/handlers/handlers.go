@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/victor-nach/git-monitor/internal/domain/models"
@@ -10,36 +11,61 @@ import (
 
 type (
 	Handler struct {
-		log       *zap.Logger
-		repoSvc   repoSvc
-		commitSvc commitSvc
-		taskSvc   taskSvc
+		log          *zap.Logger
+		repoSvc      repoSvc
+		commitSvc    commitSvc
+		taskSvc      taskSvc
+		schedulerSvc schedulerSvc
+
+		// streamsDone is closed to end the event streams when the server shuts down
+		streamsDone  chan struct{}
+		closeStreams sync.Once
 	}
 
 	repoSvc interface {
 		Create(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time) (models.Repository, string, error)
-		List(ctx context.Context) ([]models.Repository, error)
+		List(ctx context.Context, pagination models.PaginationReq) ([]models.Repository, models.Pagination, error)
 		Reset(ctx context.Context, RepoInfo models.RepoInfo, startTime *time.Time) (string, error)
 		UpdateStatus(ctx context.Context, RepoInfo models.RepoInfo, isActive *bool) error
+		UpdateSchedule(ctx context.Context, repoInfo models.RepoInfo, update models.ScheduleUpdate) (models.RepoSchedule, error)
 	}
 
 	taskSvc interface {
+		CancelTask(ctx context.Context, id string) error
 		GetTask(ctx context.Context, id string) (models.Task, error)
-		List(ctx context.Context) ([]models.Task, error)
-		TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time)  (string, error)
+		List(ctx context.Context, filter models.TaskFilter, pagination models.PaginationReq) (models.TaskList, error)
+		RetryTask(ctx context.Context, id string) error
+		Subscribe(filter models.TaskEventFilter) (<-chan models.TaskEvent, func())
+		TriggerManualTask(ctx context.Context, RepoInfo models.RepoInfo, override bool) (string, error)
+	}
+
+	schedulerSvc interface {
+		Status(ctx context.Context) (models.SchedulerStatus, error)
+		Pause(ctx context.Context) (models.SchedulerStatus, error)
+		Resume(ctx context.Context) (models.SchedulerStatus, error)
+		RunNow(ctx context.Context) (models.SchedulerStatus, error)
 	}
 
 	commitSvc interface {
 		GetTopAuthors(ctx context.Context, RepoInfo models.RepoInfo, limit int) ([]models.AuthorStats, error)
-		List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, string, error)
+		List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, models.Pagination, error)
+		Search(ctx context.Context, expr models.SearchExpr, repoInfo *models.RepoInfo, pagination models.PaginationReq) ([]models.CommitMatch, models.Pagination, error)
 	}
 )
 
-func New(log *zap.Logger, repoSvc repoSvc, commitSvc commitSvc, taskSvc taskSvc) *Handler {
+func New(log *zap.Logger, repoSvc repoSvc, commitSvc commitSvc, taskSvc taskSvc, schedulerSvc schedulerSvc) *Handler {
 	return &Handler{
-		log:       log,
-		repoSvc:   repoSvc,
-		commitSvc: commitSvc,
-		taskSvc:   taskSvc,
+		log:          log,
+		repoSvc:      repoSvc,
+		commitSvc:    commitSvc,
+		taskSvc:      taskSvc,
+		schedulerSvc: schedulerSvc,
+		streamsDone:  make(chan struct{}),
 	}
 }
+
+// CloseStreams ends the event streams open, and any opened afterwards, so that
+// shutting the server down doesn't wait for their clients to disconnect
+func (h *Handler) CloseStreams() {
+	h.closeStreams.Do(func() { close(h.streamsDone) })
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/http/handlers/mocks"
 	"go.uber.org/mock/gomock"
@@ -23,7 +26,7 @@ func TestAddTrackedRepository(t *testing.T) {
 	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
 
 	log := zap.NewNop()
-	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc)
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
 
 	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
 
@@ -50,19 +53,22 @@ func TestListTrackedRepositories(t *testing.T) {
 	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
 
 	log := zap.NewNop()
-	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc)
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
 
 	repos := []models.Repository{
 		{Name: "repo1", Owner: "owner1"},
 		{Name: "repo2", Owner: "owner2"},
 	}
 
-	mockRepoSvc.EXPECT().List(gomock.Any()).Return(repos, nil)
+	total := int64(5)
+	page := models.Pagination{NextCursor: "cursor2", Limit: 2, TotalCount: &total}
+
+	mockRepoSvc.EXPECT().List(gomock.Any(), models.PaginationReq{Limit: 2, IncludeTotal: true}).Return(repos, page, nil)
 
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest(http.MethodGet, "/repos", nil)
+	c.Request = httptest.NewRequest(http.MethodGet, "/repos?limit=2&total=true", nil)
 
 	h.ListTrackedRepositories(c)
 
@@ -70,6 +76,8 @@ func TestListTrackedRepositories(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Tracked repositories listed successfully")
 	assert.Contains(t, w.Body.String(), "repo1")
 	assert.Contains(t, w.Body.String(), "repo2")
+	assert.Contains(t, w.Body.String(), `"next_cursor":"cursor2"`)
+	assert.Contains(t, w.Body.String(), `"total_count":5`)
 }
 
 func TestResetRepo(t *testing.T) {
@@ -81,7 +89,7 @@ func TestResetRepo(t *testing.T) {
 	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
 
 	log := zap.NewNop()
-	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc)
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
 
 	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
 	taskID := "task-id"
@@ -101,6 +109,85 @@ func TestResetRepo(t *testing.T) {
 	assert.Contains(t, w.Body.String(), taskID)
 }
 
+func TestUpdateRepoSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
+	cron := "0 */6 * * *"
+	nextRunAt := time.Date(2025, 3, 17, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func()
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "updated",
+			body: `{"cron": "0 */6 * * *"}`,
+			setup: func() {
+				mockRepoSvc.EXPECT().UpdateSchedule(gomock.Any(), repoInfo, models.ScheduleUpdate{Cron: &cron}).
+					Return(models.RepoSchedule{Cron: cron, Enabled: true, NextRunAt: &nextRunAt}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "2025-03-17T06:00:00Z",
+		},
+		{
+			name:       "malformed body",
+			body:       `{"enabled": "yes"}`,
+			setup:      func() {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "InputValidation",
+		},
+		{
+			name: "invalid schedule",
+			body: `{"interval": "1s"}`,
+			setup: func() {
+				mockRepoSvc.EXPECT().UpdateSchedule(gomock.Any(), repoInfo, gomock.Any()).
+					Return(models.RepoSchedule{}, dErrors.ErrInvalidInput)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "InvalidInput",
+		},
+		{
+			name: "untracked repository",
+			body: `{"enabled": false}`,
+			setup: func() {
+				mockRepoSvc.EXPECT().UpdateSchedule(gomock.Any(), repoInfo, gomock.Any()).
+					Return(models.RepoSchedule{}, dErrors.ErrTrackedRepositoryNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "TrackedRepositoryNotFound",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/repos/owner/test-repo/schedule", strings.NewReader(tt.body))
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repoInfoKey, repoInfo))
+
+			h.UpdateRepoSchedule(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
 func TestGetTopCommitAuthors(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -110,7 +197,7 @@ func TestGetTopCommitAuthors(t *testing.T) {
 	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
 
 	log := zap.NewNop()
-	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc)
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
 
 	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
 	limit := 5
@@ -144,7 +231,7 @@ func TestListCommits(t *testing.T) {
 	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
 
 	log := zap.NewNop()
-	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc)
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
 
 	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
 	paginationReq := models.PaginationReq{Limit: 10, Cursor: "cursor1"}
@@ -152,9 +239,9 @@ func TestListCommits(t *testing.T) {
 		{SHA: "abc123", Message: "Initial commit"},
 		{SHA: "def456", Message: "Add feature"},
 	}
-	nextCursor := "cursor2"
+	page := models.Pagination{NextCursor: "cursor2", PreviousCursor: "cursor0", Limit: 10}
 
-	mockCommitSvc.EXPECT().List(gomock.Any(), repoInfo, paginationReq).Return(commits, nextCursor, nil)
+	mockCommitSvc.EXPECT().List(gomock.Any(), repoInfo, paginationReq).Return(commits, page, nil)
 
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
@@ -168,5 +255,524 @@ func TestListCommits(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Commits listed successfully")
 	assert.Contains(t, w.Body.String(), "abc123")
 	assert.Contains(t, w.Body.String(), "def456")
-	assert.Contains(t, w.Body.String(), "cursor2") // Verify next cursor
+	assert.Contains(t, w.Body.String(), `"next_cursor":"cursor2"`)
+	assert.Contains(t, w.Body.String(), `"previous_cursor":"cursor0"`)
+	assert.NotContains(t, w.Body.String(), "total_count")
+}
+
+func TestSearchCommits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
+	expr := models.SearchExpr{Words: []string{"login"}, Prefix: true}
+	matches := []models.CommitMatch{
+		{Commit: models.Commit{SHA: "abc123", Message: "Fix login"}, Snippet: "Fix <mark>login</mark>", Score: 1.5},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		query      string
+		allRepos   bool
+		setup      func()
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:  "repository",
+			query: "?q=login*&limit=5&cursor=cursor1",
+			setup: func() {
+				mockCommitSvc.EXPECT().Search(gomock.Any(), expr, &repoInfo, models.PaginationReq{Limit: 5, Cursor: "cursor1"}).Return(matches, models.Pagination{NextCursor: "cursor2", Limit: 5}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "cursor2",
+		},
+		{
+			name:     "every repository",
+			query:    "?q=login*",
+			allRepos: true,
+			setup: func() {
+				mockCommitSvc.EXPECT().Search(gomock.Any(), expr, nil, models.PaginationReq{Limit: 10}).Return(matches, models.Pagination{Limit: 10}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"snippet":"Fix \u003cmark\u003elogin\u003c/mark\u003e"`,
+		},
+		{
+			name:  "invalid cursor",
+			query: "?q=login*&cursor=bad",
+			setup: func() {
+				mockCommitSvc.EXPECT().Search(gomock.Any(), expr, &repoInfo, models.PaginationReq{Limit: 10, Cursor: "bad"}).Return(nil, models.Pagination{}, dErrors.ErrInvalidInput)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "InvalidInput",
+		},
+		{
+			name:       "missing query",
+			setup:      func() {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "search query is empty",
+		},
+		{
+			name:       "invalid query",
+			query:      "?q=%22login",
+			setup:      func() {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "unterminated phrase",
+		},
+		{
+			name:  "limit clamped",
+			query: "?q=login*&limit=500",
+			setup: func() {
+				mockCommitSvc.EXPECT().Search(gomock.Any(), expr, &repoInfo, models.PaginationReq{Limit: 100}).Return(matches, models.Pagination{Limit: 100}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"limit":100`,
+		},
+		{
+			name:       "invalid limit",
+			query:      "?q=login&limit=0",
+			setup:      func() {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "limit must be a positive integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.allRepos {
+				c.Request = httptest.NewRequest(http.MethodGet, "/commits/search"+tt.query, nil)
+				h.SearchAllCommits(c)
+			} else {
+				c.Request = httptest.NewRequest(http.MethodGet, "/repos/owner/test-repo/commits/search"+tt.query, nil)
+				c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repoInfoKey, repoInfo))
+				h.SearchCommits(c)
+			}
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestTriggerTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	repoInfo := models.RepoInfo{Name: "test-repo", Owner: "owner"}
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		query      string
+		setup      func()
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "triggered",
+			setup: func() {
+				mockTaskSvc.EXPECT().TriggerManualTask(gomock.Any(), repoInfo, false).Return("task-id", nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "task-id",
+		},
+		{
+			name: "quiet window",
+			setup: func() {
+				mockTaskSvc.EXPECT().TriggerManualTask(gomock.Any(), repoInfo, false).Return("", dErrors.ErrQuietWindow)
+			},
+			wantStatus: http.StatusConflict,
+			wantBody:   "QuietWindow",
+		},
+		{
+			name:  "override",
+			query: "?override=true",
+			setup: func() {
+				mockTaskSvc.EXPECT().TriggerManualTask(gomock.Any(), repoInfo, true).Return("task-id", nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "task-id",
+		},
+		{
+			name:       "invalid override",
+			query:      "?override=maybe",
+			setup:      func() {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "override must be true or false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/repos/owner/test-repo/trigger"+tt.query, nil)
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repoInfoKey, repoInfo))
+
+			h.TriggerTask(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	mockTaskSvc.EXPECT().CancelTask(gomock.Any(), "task-id").Return(nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/tasks/task-id/cancel", nil)
+	c.Params = gin.Params{{Key: "id", Value: "task-id"}}
+
+	h.CancelTask(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Task cancellation requested successfully")
+	assert.Contains(t, w.Body.String(), "task-id")
+
+	// a finished task can't be cancelled
+	mockTaskSvc.EXPECT().CancelTask(gomock.Any(), "finished-task").Return(dErrors.ErrInvalidTaskTransition)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/tasks/finished-task/cancel", nil)
+	c.Params = gin.Params{{Key: "id", Value: "finished-task"}}
+
+	h.CancelTask(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "InvalidTaskTransition")
+}
+
+func TestRetryTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	mockTaskSvc.EXPECT().RetryTask(gomock.Any(), "task-id").Return(nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/tasks/task-id/retry", nil)
+	c.Params = gin.Params{{Key: "id", Value: "task-id"}}
+
+	h.RetryTask(c)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "Task retry started successfully")
+	assert.Contains(t, w.Body.String(), "task-id")
+
+	// only a failed task can be retried
+	mockTaskSvc.EXPECT().RetryTask(gomock.Any(), "completed-task").Return(dErrors.ErrInvalidTaskTransition)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/tasks/completed-task/retry", nil)
+	c.Params = gin.Params{{Key: "id", Value: "completed-task"}}
+
+	h.RetryTask(c)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "InvalidTaskTransition")
+}
+
+func TestStreamTaskEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	// the stream starts with the state of the task and ends once it is done
+	events := make(chan models.TaskEvent, 3)
+	events <- models.TaskEvent{Type: models.TaskEventBatch, TaskID: "task-id", Status: models.TaskStatusInProgress, Batch: &models.BatchDetail{BatchID: 1}}
+	events <- models.TaskEvent{Type: models.TaskEventDone, TaskID: "task-id", Status: models.TaskStatusCompleted}
+	events <- models.TaskEvent{Type: models.TaskEventStatus, TaskID: "task-id", Status: "after-done"}
+
+	mockTaskSvc.EXPECT().Subscribe(models.TaskEventFilter{TaskID: "task-id"}).Return((<-chan models.TaskEvent)(events), func() {})
+	mockTaskSvc.EXPECT().GetTask(gomock.Any(), "task-id").Return(models.Task{ID: "task-id", Status: models.TaskStatusInProgress}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/tasks/task-id/events", nil)
+	c.Params = gin.Params{{Key: "id", Value: "task-id"}}
+
+	h.StreamTaskEvents(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	status := strings.Index(body, "event:status")
+	batch := strings.Index(body, "event:batch")
+	done := strings.Index(body, "event:done")
+	assert.True(t, status >= 0 && status < batch && batch < done, body)
+	assert.NotContains(t, body, "after-done")
+
+	// a missing task is reported before the stream starts
+	mockTaskSvc.EXPECT().Subscribe(models.TaskEventFilter{TaskID: "unknown"}).Return((<-chan models.TaskEvent)(make(chan models.TaskEvent)), func() {})
+	mockTaskSvc.EXPECT().GetTask(gomock.Any(), "unknown").Return(models.Task{}, dErrors.ErrTaskNotFound)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/tasks/unknown/events", nil)
+	c.Params = gin.Params{{Key: "id", Value: "unknown"}}
+
+	h.StreamTaskEvents(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStreamRepoTaskEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	// the stream of a repository goes on past done events, until the subscription ends
+	events := make(chan models.TaskEvent, 2)
+	events <- models.TaskEvent{Type: models.TaskEventDone, TaskID: "task-1", Status: models.TaskStatusCompleted}
+	events <- models.TaskEvent{Type: models.TaskEventStatus, TaskID: "task-2", Status: models.TaskStatusPending}
+	close(events)
+
+	repoInfo := models.RepoInfo{Owner: "test-owner", Name: "test-repo"}
+	mockTaskSvc.EXPECT().Subscribe(models.TaskEventFilter{RepoOwner: "test-owner", RepoName: "test-repo"}).Return((<-chan models.TaskEvent)(events), func() {})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/repos/test-owner/test-repo/events", nil)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repoInfoKey, repoInfo))
+
+	h.StreamRepoTaskEvents(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "task-1")
+	assert.Contains(t, w.Body.String(), "task-2")
+}
+
+func TestCloseStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+	h := New(zap.NewNop(), mocks.NewMockrepoSvc(ctrl), mocks.NewMockcommitSvc(ctrl), mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	// the subscription of a repository never ends on its own
+	repoInfo := models.RepoInfo{Owner: "test-owner", Name: "test-repo"}
+	mockTaskSvc.EXPECT().Subscribe(gomock.Any()).Return((<-chan models.TaskEvent)(make(chan models.TaskEvent)), func() {})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/repos/test-owner/test-repo/events", nil)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repoInfoKey, repoInfo))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.StreamRepoTaskEvents(c)
+	}()
+
+	h.CloseStreams()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the stream didn't end when the streams were closed")
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestListTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepoSvc := mocks.NewMockrepoSvc(ctrl)
+	mockCommitSvc := mocks.NewMockcommitSvc(ctrl)
+	mockTaskSvc := mocks.NewMocktaskSvc(ctrl)
+
+	log := zap.NewNop()
+	h := New(log, mockRepoSvc, mockCommitSvc, mockTaskSvc, mocks.NewMockschedulerSvc(ctrl))
+
+	gin.SetMode(gin.TestMode)
+
+	createdAfter := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	filter := models.TaskFilter{
+		Statuses:     []string{models.TaskStatusPending, models.TaskStatusFailed},
+		TriggerTypes: []string{models.TriggerTypeManual},
+		RepoOwner:    "owner",
+		RepoName:     "test-repo",
+		CreatedAfter: &createdAfter,
+		SortOrder:    models.SortOrderAsc,
+	}
+	tasks := models.TaskList{
+		Tasks:      []models.Task{{ID: "task-1", Status: models.TaskStatusFailed}},
+		Pagination: models.Pagination{NextCursor: "next-cursor", Limit: 20},
+		Summary:    map[string]int64{models.TaskStatusFailed: 3},
+	}
+	mockTaskSvc.EXPECT().List(gomock.Any(), filter, models.PaginationReq{Limit: 20, Cursor: "cursor1"}).Return(tasks, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/tasks?status=pending,failed&trigger_type=manual&owner=owner&repo=test-repo&created_after=2025-03-01T00:00:00Z&order=asc&limit=20&cursor=cursor1", nil)
+
+	h.ListTasks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "task-1")
+	assert.Contains(t, w.Body.String(), `"next_cursor":"next-cursor"`)
+	assert.Contains(t, w.Body.String(), `"summary":{"failed":3}`)
+
+	// unknown filter values are rejected before reaching the service
+	for _, query := range []string{"status=running", "trigger_type=cron", "order=up", "limit=0", "limit=ten", "total=maybe", "created_before=yesterday"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/tasks?"+query, nil)
+
+		h.ListTasks(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestSchedulerControl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSchedulerSvc := mocks.NewMockschedulerSvc(ctrl)
+	h := New(zap.NewNop(), mocks.NewMockrepoSvc(ctrl), mocks.NewMockcommitSvc(ctrl), mocks.NewMocktaskSvc(ctrl), mockSchedulerSvc)
+
+	requestedAt := time.Date(2025, 3, 17, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		handle     gin.HandlerFunc
+		setup      func()
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:   "status",
+			handle: h.GetSchedulerStatus,
+			setup: func() {
+				mockSchedulerSvc.EXPECT().Status(gomock.Any()).Return(models.SchedulerStatus{
+					State:          models.SchedulerStateRunning,
+					Leader:         "instance-1",
+					SchedulerState: models.SchedulerState{LastDispatched: []models.DispatchedRepo{{Owner: "owner", Name: "repo"}}},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"leader":"instance-1"`,
+		},
+		{
+			name:   "pause",
+			handle: h.PauseScheduler,
+			setup: func() {
+				mockSchedulerSvc.EXPECT().Pause(gomock.Any()).Return(models.SchedulerStatus{State: models.SchedulerStatePaused}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"state":"paused"`,
+		},
+		{
+			name:   "resume",
+			handle: h.ResumeScheduler,
+			setup: func() {
+				mockSchedulerSvc.EXPECT().Resume(gomock.Any()).Return(models.SchedulerStatus{State: models.SchedulerStateRunning}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"state":"running"`,
+		},
+		{
+			name:   "run now",
+			handle: h.RunScheduler,
+			setup: func() {
+				mockSchedulerSvc.EXPECT().RunNow(gomock.Any()).Return(models.SchedulerStatus{
+					State:          models.SchedulerStateRunning,
+					SchedulerState: models.SchedulerState{RunRequestedAt: &requestedAt},
+				}, nil)
+			},
+			wantStatus: http.StatusAccepted,
+			wantBody:   `"run_requested_at":"2025-03-17T06:00:00Z"`,
+		},
+		{
+			name:   "failed",
+			handle: h.PauseScheduler,
+			setup: func() {
+				mockSchedulerSvc.EXPECT().Pause(gomock.Any()).Return(models.SchedulerStatus{}, assert.AnError)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/scheduler", nil)
+
+			tt.handle(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
 }
@@ -57,11 +57,11 @@ func (mr *MockcommitSvcMockRecorder) GetTopAuthors(ctx, RepoInfo, limit any) *go
 }
 
 // List mocks base method.
-func (m *MockcommitSvc) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, string, error) {
+func (m *MockcommitSvc) List(ctx context.Context, RepoInfo models.RepoInfo, pagination models.PaginationReq) ([]models.Commit, models.Pagination, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List", ctx, RepoInfo, pagination)
 	ret0, _ := ret[0].([]models.Commit)
-	ret1, _ := ret[1].(string)
+	ret1, _ := ret[1].(models.Pagination)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
@@ -71,3 +71,19 @@ func (mr *MockcommitSvcMockRecorder) List(ctx, RepoInfo, pagination any) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockcommitSvc)(nil).List), ctx, RepoInfo, pagination)
 }
+
+// Search mocks base method.
+func (m *MockcommitSvc) Search(ctx context.Context, expr models.SearchExpr, repoInfo *models.RepoInfo, pagination models.PaginationReq) ([]models.CommitMatch, models.Pagination, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, expr, repoInfo, pagination)
+	ret0, _ := ret[0].([]models.CommitMatch)
+	ret1, _ := ret[1].(models.Pagination)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockcommitSvcMockRecorder) Search(ctx, expr, repoInfo, pagination any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockcommitSvc)(nil).Search), ctx, expr, repoInfo, pagination)
+}
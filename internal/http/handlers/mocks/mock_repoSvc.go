@@ -59,18 +59,19 @@ func (mr *MockrepoSvcMockRecorder) Create(ctx, RepoInfo, since any) *gomock.Call
 }
 
 // List mocks base method.
-func (m *MockrepoSvc) List(ctx context.Context) ([]models.Repository, error) {
+func (m *MockrepoSvc) List(ctx context.Context, pagination models.PaginationReq) ([]models.Repository, models.Pagination, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "List", ctx)
+	ret := m.ctrl.Call(m, "List", ctx, pagination)
 	ret0, _ := ret[0].([]models.Repository)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(models.Pagination)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // List indicates an expected call of List.
-func (mr *MockrepoSvcMockRecorder) List(ctx any) *gomock.Call {
+func (mr *MockrepoSvcMockRecorder) List(ctx, pagination any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockrepoSvc)(nil).List), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockrepoSvc)(nil).List), ctx, pagination)
 }
 
 // Reset mocks base method.
@@ -88,6 +89,21 @@ func (mr *MockrepoSvcMockRecorder) Reset(ctx, RepoInfo, startTime any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockrepoSvc)(nil).Reset), ctx, RepoInfo, startTime)
 }
 
+// UpdateSchedule mocks base method.
+func (m *MockrepoSvc) UpdateSchedule(ctx context.Context, repoInfo models.RepoInfo, update models.ScheduleUpdate) (models.RepoSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSchedule", ctx, repoInfo, update)
+	ret0, _ := ret[0].(models.RepoSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSchedule indicates an expected call of UpdateSchedule.
+func (mr *MockrepoSvcMockRecorder) UpdateSchedule(ctx, repoInfo, update any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSchedule", reflect.TypeOf((*MockrepoSvc)(nil).UpdateSchedule), ctx, repoInfo, update)
+}
+
 // UpdateStatus mocks base method.
 func (m *MockrepoSvc) UpdateStatus(ctx context.Context, RepoInfo models.RepoInfo, isActive *bool) error {
 	m.ctrl.T.Helper()
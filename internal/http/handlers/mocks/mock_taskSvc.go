@@ -12,7 +12,6 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
-	time "time"
 
 	models "github.com/victor-nach/git-monitor/internal/domain/models"
 	gomock "go.uber.org/mock/gomock"
@@ -42,6 +41,20 @@ func (m *MocktaskSvc) EXPECT() *MocktaskSvcMockRecorder {
 	return m.recorder
 }
 
+// CancelTask mocks base method.
+func (m *MocktaskSvc) CancelTask(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelTask", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelTask indicates an expected call of CancelTask.
+func (mr *MocktaskSvcMockRecorder) CancelTask(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelTask", reflect.TypeOf((*MocktaskSvc)(nil).CancelTask), ctx, id)
+}
+
 // GetTask mocks base method.
 func (m *MocktaskSvc) GetTask(ctx context.Context, id string) (models.Task, error) {
 	m.ctrl.T.Helper()
@@ -58,31 +71,60 @@ func (mr *MocktaskSvcMockRecorder) GetTask(ctx, id any) *gomock.Call {
 }
 
 // List mocks base method.
-func (m *MocktaskSvc) List(ctx context.Context) ([]models.Task, error) {
+func (m *MocktaskSvc) List(ctx context.Context, filter models.TaskFilter, pagination models.PaginationReq) (models.TaskList, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "List", ctx)
-	ret0, _ := ret[0].([]models.Task)
+	ret := m.ctrl.Call(m, "List", ctx, filter, pagination)
+	ret0, _ := ret[0].(models.TaskList)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // List indicates an expected call of List.
-func (mr *MocktaskSvcMockRecorder) List(ctx any) *gomock.Call {
+func (mr *MocktaskSvcMockRecorder) List(ctx, filter, pagination any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MocktaskSvc)(nil).List), ctx, filter, pagination)
+}
+
+// RetryTask mocks base method.
+func (m *MocktaskSvc) RetryTask(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTask", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryTask indicates an expected call of RetryTask.
+func (mr *MocktaskSvcMockRecorder) RetryTask(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTask", reflect.TypeOf((*MocktaskSvc)(nil).RetryTask), ctx, id)
+}
+
+// Subscribe mocks base method.
+func (m *MocktaskSvc) Subscribe(filter models.TaskEventFilter) (<-chan models.TaskEvent, func()) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", filter)
+	ret0, _ := ret[0].(<-chan models.TaskEvent)
+	ret1, _ := ret[1].(func())
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MocktaskSvcMockRecorder) Subscribe(filter any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MocktaskSvc)(nil).List), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MocktaskSvc)(nil).Subscribe), filter)
 }
 
-// TriggerTask mocks base method.
-func (m *MocktaskSvc) TriggerTask(ctx context.Context, RepoInfo models.RepoInfo, since *time.Time) (string, error) {
+// TriggerManualTask mocks base method.
+func (m *MocktaskSvc) TriggerManualTask(ctx context.Context, RepoInfo models.RepoInfo, override bool) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TriggerTask", ctx, RepoInfo, since)
+	ret := m.ctrl.Call(m, "TriggerManualTask", ctx, RepoInfo, override)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// TriggerTask indicates an expected call of TriggerTask.
-func (mr *MocktaskSvcMockRecorder) TriggerTask(ctx, RepoInfo, since any) *gomock.Call {
+// TriggerManualTask indicates an expected call of TriggerManualTask.
+func (mr *MocktaskSvcMockRecorder) TriggerManualTask(ctx, RepoInfo, override any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TriggerTask", reflect.TypeOf((*MocktaskSvc)(nil).TriggerTask), ctx, RepoInfo, since)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TriggerManualTask", reflect.TypeOf((*MocktaskSvc)(nil).TriggerManualTask), ctx, RepoInfo, override)
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	domainModels "github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/http/errors"
 	"github.com/victor-nach/git-monitor/internal/http/models"
 	"github.com/victor-nach/git-monitor/internal/http/utils"
@@ -57,9 +58,19 @@ func (h *Handler) AddTrackedRepository(c *gin.Context) {
 func (h *Handler) ListTrackedRepositories(c *gin.Context) {
 	log := h.log.With(zap.String("method", "ListTrackedRepositories"))
 
+	paginationRq, err := utils.ExtractPaginationReq(c)
+	if err != nil {
+		log.Error("invalid pagination parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(
+		zap.Int("limit", paginationRq.Limit),
+		zap.String("cursor", paginationRq.Cursor))
+
 	log.Info("handling list tracked repositories API request")
 
-	repos, err := h.repoSvc.List(c.Request.Context())
+	repos, page, err := h.repoSvc.List(c.Request.Context(), paginationRq)
 	if err != nil {
 		log.Error("failed to list tracked repository", zap.Error(err))
 		status, httpErr := errors.MapError(err)
@@ -69,9 +80,10 @@ func (h *Handler) ListTrackedRepositories(c *gin.Context) {
 	}
 
 	resp := models.APIResponse{
-		Status:  models.SuccessStatus,
-		Message: "Tracked repositories listed successfully",
-		Data:    repos,
+		Status:     models.SuccessStatus,
+		Message:    "Tracked repositories listed successfully",
+		Pagination: models.NewPagination(page),
+		Data:       repos,
 	}
 
 	log.Info("Tracked repositories listed successfully", zap.Int("count", len(repos)))
@@ -169,3 +181,42 @@ func (h *Handler) UpdateRepoStatus(c *gin.Context) {
 	log.Info("Repository status updated successfully")
 	c.JSON(http.StatusOK, resp)
 }
+
+func (h *Handler) UpdateRepoSchedule(c *gin.Context) {
+	log := h.log.With(zap.String("method", "UpdateRepoSchedule"))
+
+	repoInfo, err := GetRepoInfo(c.Request.Context())
+	if err != nil {
+		h.log.Error("failed to retrieve repository info from context", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, errors.ErrInternalServer)
+		return
+	}
+	log = utils.WithRepoInfo(log, repoInfo)
+
+	var update domainModels.ScheduleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		log.Error("failed to decode schedule update", zap.Error(err))
+		c.JSON(http.StatusBadRequest, errors.ErrInputValidation("a valid schedule is required"))
+		return
+	}
+
+	log.Info("handling update repository schedule API request")
+
+	schedule, err := h.repoSvc.UpdateSchedule(c.Request.Context(), repoInfo, update)
+	if err != nil {
+		log.Error("failed to update repository schedule", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		httpErr.WithMessage("failed to update repository schedule")
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:  models.SuccessStatus,
+		Message: "Repository schedule updated successfully",
+		Data:    schedule,
+	}
+
+	log.Info("Repository schedule updated successfully")
+	c.JSON(http.StatusOK, resp)
+}
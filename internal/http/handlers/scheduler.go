@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	domainModels "github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/internal/http/errors"
+	"github.com/victor-nach/git-monitor/internal/http/models"
+	"go.uber.org/zap"
+)
+
+func (h *Handler) GetSchedulerStatus(c *gin.Context) {
+	log := h.log.With(zap.String("method", "GetSchedulerStatus"))
+
+	log.Info("handling get scheduler status API request")
+
+	schedulerStatus, err := h.schedulerSvc.Status(c.Request.Context())
+	if err != nil {
+		log.Error("failed to get scheduler status", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		httpErr.WithMessage("failed to get scheduler status")
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:  models.SuccessStatus,
+		Message: "Scheduler status retrieved successfully",
+		Data:    schedulerStatus,
+	}
+
+	log.Info("Scheduler status retrieved successfully", zap.String("state", schedulerStatus.State))
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) PauseScheduler(c *gin.Context) {
+	h.controlScheduler(c, "PauseScheduler", h.schedulerSvc.Pause, "Scheduler paused successfully", http.StatusOK)
+}
+
+func (h *Handler) ResumeScheduler(c *gin.Context) {
+	h.controlScheduler(c, "ResumeScheduler", h.schedulerSvc.Resume, "Scheduler resumed successfully", http.StatusOK)
+}
+
+// RunScheduler asks for a sweep of every repository, which the instance running
+// the scheduler starts shortly after
+func (h *Handler) RunScheduler(c *gin.Context) {
+	h.controlScheduler(c, "RunScheduler", h.schedulerSvc.RunNow, "Scheduler run requested successfully", http.StatusAccepted)
+}
+
+// controlScheduler handles a request changing the state of the scheduler and
+// responds with its new status
+func (h *Handler) controlScheduler(c *gin.Context, method string, action func(ctx context.Context) (domainModels.SchedulerStatus, error), message string, code int) {
+	log := h.log.With(zap.String("method", method))
+
+	log.Info("handling scheduler control API request")
+
+	schedulerStatus, err := action(c.Request.Context())
+	if err != nil {
+		log.Error("failed to control scheduler", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		httpErr.WithMessage("failed to control scheduler")
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:  models.SuccessStatus,
+		Message: message,
+		Data:    schedulerStatus,
+	}
+
+	log.Info(message, zap.String("state", schedulerStatus.State))
+	c.JSON(code, resp)
+}
@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	domainModels "github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/http/errors"
 	"github.com/victor-nach/git-monitor/internal/http/models"
 	"github.com/victor-nach/git-monitor/internal/http/utils"
 	"go.uber.org/zap"
 )
 
+// sseKeepAlive is how often a comment is sent on an idle event stream, so that
+// proxies and clients don't time it out
+const sseKeepAlive = 15 * time.Second
+
 func (h *Handler) TriggerTask(c *gin.Context) {
 	log := h.log.With(zap.String("method", "TriggerTask"))
 	repoInfo, err := GetRepoInfo(c.Request.Context())
@@ -22,7 +32,15 @@ func (h *Handler) TriggerTask(c *gin.Context) {
 	
 	log.Info("handling trigger task API request")
 
-	taskID, err := h.taskSvc.TriggerTask(c.Request.Context(), repoInfo, nil)
+	// override fetches the repository even while a quiet window is open
+	override, err := extractBool(c, "override")
+	if err != nil {
+		log.Error("invalid override flag", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	taskID, err := h.taskSvc.TriggerManualTask(c.Request.Context(), repoInfo, override)
 	if  err != nil {
 		log.Error("failed to trigger task", zap.Error(err))
 		status, httpErr := errors.MapError(err)
@@ -42,9 +60,27 @@ func (h *Handler) TriggerTask(c *gin.Context) {
 
 func (h *Handler) ListTasks(c *gin.Context) {
 	log := h.log.With(zap.String("method", "ListTasks"))
+
+	filter, err := extractTaskFilter(c)
+	if err != nil {
+		log.Error("invalid task filters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	paginationRq, err := utils.ExtractPaginationReq(c)
+	if err != nil {
+		log.Error("invalid pagination parameters", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(
+		zap.Int("limit", paginationRq.Limit),
+		zap.String("cursor", paginationRq.Cursor))
+
 	log.Info("handling list tasks API request")
 
-	tasks, err := h.taskSvc.List(c.Request.Context())
+	tasks, err := h.taskSvc.List(c.Request.Context(), filter, paginationRq)
 	if err != nil {
 		log.Error("failed to list tasks", zap.Error(err))
 		status, httpErr := errors.MapError(err)
@@ -53,15 +89,74 @@ func (h *Handler) ListTasks(c *gin.Context) {
 	}
 
 	resp := models.APIResponse{
-		Status:  models.SuccessStatus,
-		Message: "Tasks retrieved successfully",
-		Data:    tasks,
+		Status:     models.SuccessStatus,
+		Message:    "Tasks retrieved successfully",
+		Pagination: models.NewPagination(tasks.Pagination),
+		Data:       tasks,
 	}
 
-	log.Info("tasks retrieved successfully")
+	log.Info("tasks retrieved successfully", zap.Int("count", len(tasks.Tasks)))
 	c.JSON(http.StatusOK, resp)
 }
 
+// extractTaskFilter reads the task filters from the query. Statuses and trigger
+// types take comma separated lists.
+func extractTaskFilter(c *gin.Context) (domainModels.TaskFilter, error) {
+	filter := domainModels.TaskFilter{
+		RepoOwner: c.Query("owner"),
+		RepoName:  c.Query("repo"),
+		SortOrder: c.DefaultQuery("order", domainModels.SortOrderDesc),
+	}
+
+	var err error
+	if filter.Statuses, err = extractList(c, "status", domainModels.TaskStatuses); err != nil {
+		return filter, err
+	}
+	if filter.TriggerTypes, err = extractList(c, "trigger_type", domainModels.TriggerTypes); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = utils.ExtractTime(c, "created_after"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = utils.ExtractTime(c, "created_before"); err != nil {
+		return filter, err
+	}
+
+	if filter.SortOrder != domainModels.SortOrderAsc && filter.SortOrder != domainModels.SortOrderDesc {
+		return filter, errors.ErrInputValidation("order must be asc or desc")
+	}
+
+	return filter, nil
+}
+
+func extractBool(c *gin.Context, key string) (bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.ErrInputValidation(fmt.Sprintf("%s must be true or false", key))
+	}
+	return parsed, nil
+}
+
+func extractList(c *gin.Context, key string, allowed []string) ([]string, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	values := strings.Split(value, ",")
+	for _, v := range values {
+		if !slices.Contains(allowed, v) {
+			return nil, errors.ErrInputValidation(fmt.Sprintf("%s must be one of %s", key, strings.Join(allowed, ", ")))
+		}
+	}
+	return values, nil
+}
+
 func (h *Handler) GetTask(c *gin.Context) {
 	log := h.log.With(zap.String("method", "GetTask"))
 
@@ -92,3 +187,161 @@ func (h *Handler) GetTask(c *gin.Context) {
 	log.Info("task retrieved successfully")
 	c.JSON(http.StatusOK, resp)
 }
+
+func (h *Handler) CancelTask(c *gin.Context) {
+	log := h.log.With(zap.String("method", "CancelTask"))
+
+	taskID := c.Param("id")
+	if taskID == "" {
+		err := errors.ErrInputValidation("task id is required")
+		log.Error("failed to cancel task", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(zap.String("task_id", taskID))
+	log.Info("handling cancel task API request")
+
+	if err := h.taskSvc.CancelTask(c.Request.Context(), taskID); err != nil {
+		log.Error("failed to cancel task", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:  models.SuccessStatus,
+		Message: "Task cancellation requested successfully",
+		Data:    models.TaskResponse{TaskID: taskID},
+	}
+
+	log.Info("task cancellation requested successfully")
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) RetryTask(c *gin.Context) {
+	log := h.log.With(zap.String("method", "RetryTask"))
+
+	taskID := c.Param("id")
+	if taskID == "" {
+		err := errors.ErrInputValidation("task id is required")
+		log.Error("failed to retry task", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(zap.String("task_id", taskID))
+	log.Info("handling retry task API request")
+
+	if err := h.taskSvc.RetryTask(c.Request.Context(), taskID); err != nil {
+		log.Error("failed to retry task", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		c.JSON(status, httpErr)
+		return
+	}
+
+	resp := models.APIResponse{
+		Status:  models.SuccessStatus,
+		Message: "Task retry started successfully",
+		Data:    models.TaskResponse{TaskID: taskID},
+	}
+
+	log.Info("task retry started successfully")
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// StreamTaskEvents streams the changes to a task as server-sent events: its
+// current state first, then its status changes and batches, until it finishes
+func (h *Handler) StreamTaskEvents(c *gin.Context) {
+	log := h.log.With(zap.String("method", "StreamTaskEvents"))
+
+	taskID := c.Param("id")
+	if taskID == "" {
+		err := errors.ErrInputValidation("task id is required")
+		log.Error("failed to stream task events", zap.Error(err))
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	log = log.With(zap.String("task_id", taskID))
+	log.Info("handling stream task events API request")
+
+	// subscribe before reading the task, so that no change in between is missed
+	events, unsubscribe := h.taskSvc.Subscribe(domainModels.TaskEventFilter{TaskID: taskID})
+	defer unsubscribe()
+
+	task, err := h.taskSvc.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		log.Error("failed to retrieve task", zap.Error(err))
+		status, httpErr := errors.MapError(err)
+		c.JSON(status, httpErr)
+		return
+	}
+
+	snapshot := domainModels.NewTaskEvent(task)
+	h.streamEvents(c, &snapshot, events, true)
+	log.Info("task event stream closed")
+}
+
+// StreamRepoTaskEvents streams the changes to every task of a repository as
+// server-sent events, until the client disconnects
+func (h *Handler) StreamRepoTaskEvents(c *gin.Context) {
+	log := h.log.With(zap.String("method", "StreamRepoTaskEvents"))
+	repoInfo, err := GetRepoInfo(c.Request.Context())
+	if err != nil {
+		log.Error("failed to retrieve repository info from context", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, errors.ErrInternalServer)
+		return
+	}
+	log = utils.WithRepoInfo(log, repoInfo)
+	log.Info("handling stream repository task events API request")
+
+	events, unsubscribe := h.taskSvc.Subscribe(domainModels.TaskEventFilter{
+		RepoOwner: repoInfo.Owner,
+		RepoName:  repoInfo.Name,
+	})
+	defer unsubscribe()
+
+	h.streamEvents(c, nil, events, false)
+	log.Info("repository task event stream closed")
+}
+
+// streamEvents writes the given events, then the ones received, as server-sent
+// events named after their type. It stops once the client disconnects or the
+// subscription is dropped for falling behind, and with untilDone after a done event.
+func (h *Handler) streamEvents(c *gin.Context, first *domainModels.TaskEvent, events <-chan domainModels.TaskEvent, untilDone bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var event domainModels.TaskEvent
+		if first != nil {
+			event, first = *first, nil
+		} else {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-h.streamsDone:
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(c.Writer, ": keep-alive\n\n")
+				c.Writer.Flush()
+				continue
+			case received, ok := <-events:
+				if !ok {
+					return
+				}
+				event = received
+			}
+		}
+
+		c.SSEvent(event.Type, event)
+		c.Writer.Flush()
+		if untilDone && event.Type == domainModels.TaskEventDone {
+			return
+		}
+	}
+}
@@ -23,6 +23,9 @@ type (
 	Pagination struct {
 		NextCursor     string `json:"next_cursor,omitempty"`
 		PreviousCursor string `json:"previous_cursor,omitempty"`
+		Limit          int    `json:"limit"`
+		// TotalCount counts the items of the whole list, when requested
+		TotalCount *int64 `json:"total_count,omitempty"`
 	}
 
 	ListTasksResponse struct {
@@ -47,3 +50,13 @@ type (
 	}
 		
 )
+
+// NewPagination returns the pagination of a page for a response
+func NewPagination(page models.Pagination) *Pagination {
+	return &Pagination{
+		NextCursor:     page.NextCursor,
+		PreviousCursor: page.PreviousCursor,
+		Limit:          page.Limit,
+		TotalCount:     page.TotalCount,
+	}
+}
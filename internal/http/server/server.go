@@ -35,8 +35,18 @@ func Run(log *zap.Logger, handler *handlers.Handler, port string) {
 	api := router.Group("/api/v1")
 	{
 
+		api.GET("/commits/search", handler.SearchAllCommits)
+
 		api.GET("/tasks", handler.ListTasks)
 		api.GET("/tasks/:id", handler.GetTask)
+		api.POST("/tasks/:id/cancel", handler.CancelTask)
+		api.POST("/tasks/:id/retry", handler.RetryTask)
+		api.GET("/tasks/:id/events", handler.StreamTaskEvents)
+
+		api.GET("/scheduler", handler.GetSchedulerStatus)
+		api.POST("/scheduler/pause", handler.PauseScheduler)
+		api.POST("/scheduler/resume", handler.ResumeScheduler)
+		api.POST("/scheduler/run", handler.RunScheduler)
 
 		repos := api.Group("/repos")
 		{
@@ -48,9 +58,12 @@ func Run(log *zap.Logger, handler *handlers.Handler, port string) {
 				repo.POST("", handler.AddTrackedRepository)
 				repo.GET("/top-authors", handler.GetTopCommitAuthors)
 				repo.GET("/commits", handler.ListCommits)
+				repo.GET("/commits/search", handler.SearchCommits)
 				repo.POST("/trigger", handler.TriggerTask)
 				repo.PATCH("/status", handler.UpdateRepoStatus)
+				repo.PATCH("/schedule", handler.UpdateRepoSchedule)
 				repo.POST("/reset", handler.ResetRepo)
+				repo.GET("/events", handler.StreamRepoTaskEvents)
 			}
 		}
 	}
@@ -59,6 +72,9 @@ func Run(log *zap.Logger, handler *handlers.Handler, port string) {
 		Addr:    ":" + port,
 		Handler: router,
 	}
+	// event streams only end when their client disconnects, which shutting down
+	// would otherwise wait for
+	srv.RegisterOnShutdown(handler.CloseStreams)
 
 	go func() {
 		log.Info("Starting server", zap.String("address", srv.Addr))
@@ -77,8 +93,10 @@ func Run(log *zap.Logger, handler *handlers.Handler, port string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// the caller still releases its resources when requests outlive the timeout
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown", zap.Error(err))
+		log.Error("Server forced to shutdown", zap.Error(err))
+		srv.Close()
 	}
 
 	log.Info("Server exiting")
@@ -38,11 +38,39 @@ func ExtractLimit(c *gin.Context) int {
 	return limit
 }
 
-func ExtractPaginationReq(c *gin.Context) models.PaginationReq {
-	return models.PaginationReq{
-		Limit:  ExtractLimit(c),
+const (
+	// DefaultPageLimit is the size of a page when no limit is given
+	DefaultPageLimit = 10
+	// MaxPageLimit is the largest page returned at once, larger limits are
+	// clamped to it
+	MaxPageLimit = 100
+)
+
+// ExtractPaginationReq reads the cursor, the limit and whether to count the
+// whole list from the query. The limit must be a positive integer.
+func ExtractPaginationReq(c *gin.Context) (models.PaginationReq, error) {
+	pagination := models.PaginationReq{
 		Cursor: c.Query("cursor"),
+		Limit:  DefaultPageLimit,
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return pagination, errors.ErrInputValidation("limit must be a positive integer")
+		}
+		pagination.Limit = min(limit, MaxPageLimit)
 	}
+
+	if totalStr := c.Query("total"); totalStr != "" {
+		total, err := strconv.ParseBool(totalStr)
+		if err != nil {
+			return pagination, errors.ErrInputValidation("total must be true or false")
+		}
+		pagination.IncludeTotal = total
+	}
+
+	return pagination, nil
 }
 
 func ExtractTime(c *gin.Context, key string) (*time.Time, error) {
@@ -0,0 +1,114 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	service struct {
+		log   *zap.Logger
+		store leaderStore
+		name  string
+		id    string
+		ttl   time.Duration
+	}
+
+	leaderStore interface {
+		Acquire(ctx context.Context, name, ownerID string, expiresAt time.Time) (bool, error)
+		Release(ctx context.Context, name, ownerID string) error
+	}
+)
+
+// New returns an elector making the instance identified by id the leader of the
+// named role while it holds the lease on it. The lease lasts ttl and is renewed
+// every third of it, so a leader has to miss a couple of renewals before another
+// instance takes over.
+func New(log *zap.Logger, store leaderStore, name, id string, ttl time.Duration) *service {
+	log = log.With(zap.String("service", "leader"), zap.String("role", name), zap.String("instance_id", id))
+
+	return &service{
+		log:   log,
+		store: store,
+		name:  name,
+		id:    id,
+		ttl:   ttl,
+	}
+}
+
+// Run competes for the lease until ctx is done, running lead while the instance
+// is the leader. The context passed to lead is cancelled when the instance loses
+// the lease, and Run waits for lead to return before competing again, so that
+// lead never runs on two instances at once. The lease is released on return.
+func (s *service) Run(ctx context.Context, lead func(ctx context.Context)) {
+	log := s.log.With(zap.String("method", "Run"))
+
+	var (
+		stop      context.CancelFunc
+		wg        sync.WaitGroup
+		expiresAt time.Time
+	)
+	stepDown := func() {
+		if stop == nil {
+			return
+		}
+		stop()
+		wg.Wait()
+		stop = nil
+	}
+
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		acquired, err := s.store.Acquire(ctx, s.name, s.id, now.Add(s.ttl))
+		switch {
+		case err != nil:
+			log.Error("error acquiring leader lease", zap.Error(err))
+			// keep leading while the lease held is sure to outlast the next
+			// renewal, as no other instance can take over before it runs out
+			if stop != nil && !time.Now().Add(s.ttl/3).Before(expiresAt) {
+				log.Warn("leader lease about to expire, stepping down")
+				stepDown()
+			}
+
+		case acquired:
+			expiresAt = now.Add(s.ttl)
+			if stop == nil {
+				log.Info("elected leader")
+				var leadCtx context.Context
+				leadCtx, stop = context.WithCancel(ctx)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					lead(leadCtx)
+				}()
+			}
+
+		case stop != nil:
+			log.Warn("leader lease lost, stepping down")
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stepDown()
+				// ctx is done, so the lease is released on a fresh one
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := s.store.Release(releaseCtx, s.name, s.id); err != nil {
+					log.Error("error releasing leader lease", zap.Error(err))
+				}
+				cancel()
+			}
+			log.Info("leader election stopped")
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory lease store for testing
+type memStore struct {
+	mu        sync.Mutex
+	owner     string
+	expiresAt time.Time
+	err       error
+}
+
+func (m *memStore) Acquire(ctx context.Context, name, ownerID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.owner != "" && m.owner != ownerID && time.Now().Before(m.expiresAt) {
+		return false, nil
+	}
+	m.owner, m.expiresAt = ownerID, expiresAt
+	return true, nil
+}
+
+func (m *memStore) Release(ctx context.Context, name, ownerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owner == ownerID {
+		m.owner = ""
+	}
+	return nil
+}
+
+func (m *memStore) setErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func TestRun_OneLeaderAtATime(t *testing.T) {
+	store := &memStore{}
+	ttl := 60 * time.Millisecond
+
+	var leaders, maxLeaders int32
+	lead := func(ctx context.Context) {
+		n := atomic.AddInt32(&leaders, 1)
+		for {
+			current := atomic.LoadInt32(&maxLeaders)
+			if n <= current || atomic.CompareAndSwapInt32(&maxLeaders, current, n) {
+				break
+			}
+		}
+		<-ctx.Done()
+		atomic.AddInt32(&leaders, -1)
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan struct{})
+	go func() {
+		defer close(done1)
+		New(zap.NewNop(), store, "scheduler", "instance-1", ttl).Run(ctx1, lead)
+	}()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&leaders) == 1 }, time.Second, 5*time.Millisecond)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	done2 := make(chan struct{})
+	go func() {
+		defer close(done2)
+		New(zap.NewNop(), store, "scheduler", "instance-2", ttl).Run(ctx2, lead)
+	}()
+
+	// the second instance waits while the first renews its lease
+	time.Sleep(3 * ttl)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxLeaders))
+
+	// and takes over once the first one stops and releases it
+	cancel1()
+	<-done1
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return store.owner == "instance-2"
+	}, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&leaders) == 1 }, time.Second, 5*time.Millisecond)
+
+	cancel2()
+	<-done2
+	assert.Equal(t, int32(0), atomic.LoadInt32(&leaders))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxLeaders))
+}
+
+func TestRun_StepsDownWhenLeaseExpires(t *testing.T) {
+	store := &memStore{}
+	ttl := 60 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leading atomic.Bool
+	go New(zap.NewNop(), store, "scheduler", "instance-1", ttl).Run(ctx, func(ctx context.Context) {
+		leading.Store(true)
+		<-ctx.Done()
+		leading.Store(false)
+	})
+
+	assert.Eventually(t, leading.Load, time.Second, 5*time.Millisecond)
+
+	// the leader can't renew its lease, so it steps down once it runs out
+	store.setErr(errors.New("database unavailable"))
+	assert.Eventually(t, func() bool { return !leading.Load() }, time.Second, 5*time.Millisecond)
+
+	// and is elected again once the store is back
+	store.setErr(nil)
+	assert.Eventually(t, leading.Load, time.Second, 5*time.Millisecond)
+}
+
+func TestRun_StepsDownBeforeLeaseExpires(t *testing.T) {
+	store := &memStore{}
+	ttl := 300 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leading atomic.Bool
+	stopped := make(chan time.Time, 1)
+	go New(zap.NewNop(), store, "scheduler", "instance-1", ttl).Run(ctx, func(ctx context.Context) {
+		leading.Store(true)
+		<-ctx.Done()
+		stopped <- time.Now()
+	})
+
+	assert.Eventually(t, leading.Load, time.Second, 5*time.Millisecond)
+	store.setErr(errors.New("database unavailable"))
+
+	// another instance may take over as soon as the lease expires, so the leader
+	// has stopped by then
+	stoppedAt := <-stopped
+	store.mu.Lock()
+	expiresAt := store.expiresAt
+	store.mu.Unlock()
+	assert.True(t, stoppedAt.Before(expiresAt), "stopped %s after the lease expired", stoppedAt.Sub(expiresAt))
+}
@@ -0,0 +1,77 @@
+package notifier
+
+import (
+	"sync"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+type (
+	// notifier fans task events out to the subscribers in this process, e.g. the
+	// clients streaming the progress of a task
+	notifier struct {
+		mu          sync.Mutex
+		subscribers map[*subscriber]struct{}
+		bufferSize  int
+	}
+
+	subscriber struct {
+		filter models.TaskEventFilter
+		events chan models.TaskEvent
+	}
+)
+
+func New(bufferSize int) *notifier {
+	return &notifier{
+		subscribers: make(map[*subscriber]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Publish sends an event to every subscriber whose filter matches it. It never
+// blocks the worker publishing: a subscriber too slow to keep up is dropped, and
+// its channel closed, rather than silently missing events.
+func (n *notifier) Publish(event models.TaskEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for sub := range n.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			n.remove(sub)
+		}
+	}
+}
+
+// Subscribe returns the events matching the filter, from now on. The returned
+// function unsubscribes and closes the channel, and must be called once the
+// events are no longer read.
+func (n *notifier) Subscribe(filter models.TaskEventFilter) (<-chan models.TaskEvent, func()) {
+	sub := &subscriber{
+		filter: filter,
+		events: make(chan models.TaskEvent, n.bufferSize),
+	}
+
+	n.mu.Lock()
+	n.subscribers[sub] = struct{}{}
+	n.mu.Unlock()
+
+	return sub.events, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.remove(sub)
+	}
+}
+
+// remove drops a subscriber that is still subscribed. It must be called with mu held.
+func (n *notifier) remove(sub *subscriber) {
+	if _, ok := n.subscribers[sub]; !ok {
+		return
+	}
+	delete(n.subscribers, sub)
+	close(sub.events)
+}
@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+func TestNotifier(t *testing.T) {
+	n := New(10)
+
+	task, unsubscribeTask := n.Subscribe(models.TaskEventFilter{TaskID: "task-1"})
+	repo, unsubscribeRepo := n.Subscribe(models.TaskEventFilter{RepoOwner: "owner", RepoName: "repo"})
+	defer unsubscribeRepo()
+
+	n.Publish(models.TaskEvent{Type: models.TaskEventStatus, TaskID: "task-1", RepoOwner: "owner", RepoName: "repo"})
+	n.Publish(models.TaskEvent{Type: models.TaskEventStatus, TaskID: "task-2", RepoOwner: "owner", RepoName: "repo"})
+	n.Publish(models.TaskEvent{Type: models.TaskEventStatus, TaskID: "task-3", RepoOwner: "owner", RepoName: "other"})
+
+	assert.Equal(t, "task-1", (<-task).TaskID)
+	assert.Empty(t, task)
+	assert.Equal(t, "task-1", (<-repo).TaskID)
+	assert.Equal(t, "task-2", (<-repo).TaskID)
+	assert.Empty(t, repo)
+
+	// unsubscribing closes the channel, and can be done more than once
+	unsubscribeTask()
+	unsubscribeTask()
+	_, ok := <-task
+	assert.False(t, ok)
+}
+
+func TestNotifier_SlowSubscriber(t *testing.T) {
+	n := New(1)
+
+	events, unsubscribe := n.Subscribe(models.TaskEventFilter{})
+	defer unsubscribe()
+
+	// a subscriber that doesn't keep up is dropped instead of blocking the publisher
+	n.Publish(models.TaskEvent{TaskID: "task-1"})
+	n.Publish(models.TaskEvent{TaskID: "task-2"})
+
+	assert.Equal(t, "task-1", (<-events).TaskID)
+	_, ok := <-events
+	assert.False(t, ok)
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// Status returns the state of the scheduler, the instance running it, the global
+// quiet window open now and the outcome of its last sweep
+func (s *service) Status(ctx context.Context) (models.SchedulerStatus, error) {
+	state, err := s.stateStore.Get(ctx)
+	if err != nil {
+		return models.SchedulerStatus{}, fmt.Errorf("error retrieving scheduler state %w", err)
+	}
+
+	lease, err := s.leaderStore.Get(ctx, LeaderRole)
+	if err != nil {
+		return models.SchedulerStatus{}, fmt.Errorf("error retrieving scheduler leader %w", err)
+	}
+
+	status := models.SchedulerStatus{
+		State:          models.SchedulerStateRunning,
+		SchedulerState: state,
+	}
+	now := time.Now()
+	if lease.OwnerID != "" && lease.ExpiresAt.After(now) {
+		status.Leader, status.LeaderExpiresAt = lease.OwnerID, &lease.ExpiresAt
+	}
+	if window, closesAt, quiet := models.QuietAt(now, s.dispatch.QuietWindows); quiet {
+		status.QuietWindow, status.QuietUntil = &window, &closesAt
+	}
+
+	switch {
+	case state.Paused:
+		status.State = models.SchedulerStatePaused
+	case status.Leader == "":
+		status.State = models.SchedulerStateStopped
+	}
+	return status, nil
+}
+
+// Pause stops the scheduler from sweeping the repositories until it is resumed,
+// across restarts. The tasks already started carry on.
+func (s *service) Pause(ctx context.Context) (models.SchedulerStatus, error) {
+	if err := s.stateStore.SetPaused(ctx, true); err != nil {
+		return models.SchedulerStatus{}, fmt.Errorf("error pausing scheduler %w", err)
+	}
+	return s.Status(ctx)
+}
+
+// Resume lets a paused scheduler sweep the repositories again, starting with the
+// ones that fell due while it was paused
+func (s *service) Resume(ctx context.Context) (models.SchedulerStatus, error) {
+	if err := s.stateStore.SetPaused(ctx, false); err != nil {
+		return models.SchedulerStatus{}, fmt.Errorf("error resuming scheduler %w", err)
+	}
+	return s.Status(ctx)
+}
+
+// RunNow asks the scheduler for a sweep starting the task of every active
+// repository with an enabled schedule, whether due or not and even while paused,
+// within the dispatch caps and quiet windows. The scheduler picks the request up within seconds.
+func (s *service) RunNow(ctx context.Context) (models.SchedulerStatus, error) {
+	if err := s.stateStore.RequestRun(ctx, time.Now()); err != nil {
+		return models.SchedulerStatus{}, fmt.Errorf("error requesting scheduler run %w", err)
+	}
+	return s.Status(ctx)
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+)
+
+// dispatchRetry is how long a due repository waits before the scheduler tries
+// again to start its task, when the dispatch caps were reached
+const dispatchRetry = 10 * time.Second
+
+// DispatchPolicy decides how the scheduler spreads the scheduled tasks, so that
+// repositories sharing a schedule don't all hit GitHub and the database at once
+type DispatchPolicy struct {
+	// Jitter is the longest random delay added to every run
+	Jitter time.Duration
+	// MaxConcurrent caps the tasks fetching at once. Due repositories over the
+	// cap wait for tasks to finish.
+	MaxConcurrent int
+	// MaxPerOwner caps the tasks fetching the repositories of an owner at once
+	MaxPerOwner int
+	// QuietWindows apply to every repository, on top of its own, skipping its
+	// scheduled tasks or capping the tasks fetching at once to their budget
+	QuietWindows []models.QuietWindow
+}
+
+// jitter returns a random delay of up to Jitter
+func (p DispatchPolicy) jitter() time.Duration {
+	if p.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(p.Jitter)))
+}
+
+// allows reports whether a task can be started for an owner, given the number of
+// tasks fetching in total and for the owner
+func (p DispatchPolicy) allows(total, owner int64) bool {
+	return total < int64(p.MaxConcurrent) && owner < int64(p.MaxPerOwner)
+}
+
+// quietAt returns the most restrictive of the global and repository quiet windows
+// open at the given time, and when it closes
+func (p DispatchPolicy) quietAt(t time.Time, repo models.Repository) (models.QuietWindow, time.Time, bool) {
+	return models.QuietAt(t, slices.Concat(p.QuietWindows, repo.Schedule.QuietWindows))
+}
+
+// slot returns the offset of a repository within the interval, which is stable
+// as it comes from a hash of the repository ID
+func slot(repoID string, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(repoID))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// stagger returns the first time after the given one at the slot of the
+// repository within the interval. Repositories sharing an interval are spread
+// across it, whenever they last ran.
+func stagger(repoID string, after time.Time, interval time.Duration) time.Time {
+	at := after.Truncate(interval).Add(slot(repoID, interval))
+	if !at.After(after) {
+		at = at.Add(interval)
+	}
+	return at
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStagger(t *testing.T) {
+	interval := time.Hour
+	now := time.Date(2025, 3, 17, 7, 30, 0, 0, time.UTC)
+
+	// a repository keeps its slot, whenever it last ran
+	first := stagger("repo-1", now, interval)
+	assert.True(t, first.After(now))
+	assert.LessOrEqual(t, first.Sub(now), interval)
+	for _, after := range []time.Time{first, first.Add(-time.Second), first.Add(time.Second)} {
+		next := stagger("repo-1", after, interval)
+		assert.True(t, next.After(after))
+		assert.Equal(t, slot("repo-1", interval), next.Sub(next.Truncate(interval)))
+	}
+	assert.Equal(t, first.Add(interval), stagger("repo-1", first, interval))
+
+	// and repositories running together are spread across the interval
+	buckets := make(map[int]int)
+	for i := 0; i < 600; i++ {
+		next := stagger(fmt.Sprintf("repo-%d", i), now, interval)
+		buckets[int(next.Sub(now)/(10*time.Minute))]++
+	}
+	assert.Len(t, buckets, 6)
+	for bucket, count := range buckets {
+		assert.Greater(t, count, 50, "bucket %d", bucket)
+	}
+}
+
+func TestDispatchPolicy(t *testing.T) {
+	policy := DispatchPolicy{Jitter: time.Second, MaxConcurrent: 5, MaxPerOwner: 2}
+
+	assert.True(t, policy.allows(0, 0))
+	assert.True(t, policy.allows(4, 1))
+	assert.False(t, policy.allows(5, 0), "over the total cap")
+	assert.False(t, policy.allows(3, 2), "over the owner cap")
+
+	for i := 0; i < 100; i++ {
+		jitter := policy.jitter()
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, time.Second)
+	}
+	assert.Zero(t, DispatchPolicy{}.jitter())
+}
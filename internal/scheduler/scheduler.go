@@ -2,30 +2,120 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"go.uber.org/zap"
 )
 
+// LeaderRole is the leader lease held by the instance running the scheduler
+const LeaderRole = "scheduler"
+
+// controlInterval is how often the scheduler checks whether it was paused,
+// resumed or asked for a sweep
+const controlInterval = 5 * time.Second
+
+// maxSweepErrors caps the errors recorded for a sweep
+const maxSweepErrors = 20
+
 type (
 	service struct {
-		log *zap.Logger
+		log          *zap.Logger
 		tasksService tasksService
-		interval time.Duration
+		repoStore    repoStore
+		commitStore  commitStore
+		taskStore    taskStore
+		stateStore   stateStore
+		leaderStore  leaderStore
+		interval     time.Duration
+		pollInterval time.Duration
+		bounds       models.AdaptiveBounds
+		dispatch     DispatchPolicy
 	}
 
 	tasksService interface {
-		StartTasks(ctx context.Context) error
+		StartScheduledTask(ctx context.Context, repo models.Repository) (string, error)
+	}
+
+	repoStore interface {
+		List(ctx context.Context) ([]models.Repository, error)
+		UpdateScheduleRun(ctx context.Context, repoID string, schedule models.RepoSchedule) error
+	}
+
+	commitStore interface {
+		CountSince(ctx context.Context, repoID string, since time.Time) (int64, error)
+	}
+
+	taskStore interface {
+		CountActiveByOwner(ctx context.Context) (map[string]int64, error)
+	}
+
+	stateStore interface {
+		Get(ctx context.Context) (models.SchedulerState, error)
+		SetPaused(ctx context.Context, paused bool) error
+		RequestRun(ctx context.Context, at time.Time) error
+		RecordRun(ctx context.Context, state models.SchedulerState) error
+	}
+
+	leaderStore interface {
+		Get(ctx context.Context, name string) (models.LeaderLease, error)
 	}
 )
 
-func New(log *zap.Logger, tasksService tasksService, interval time.Duration) *service {
+// sweep is the outcome of a pass of the scheduler over the repositories
+type sweep struct {
+	next       time.Time
+	dispatched []models.DispatchedRepo
+	deferred   int
+	skipped    int
+	errs       []string
+}
+
+// earliest moves the next run of the sweep to the given time when it is earlier
+func (w *sweep) earliest(at time.Time) {
+	if w.next.IsZero() || at.Before(w.next) {
+		w.next = at
+	}
+}
+
+// fail logs an error of the sweep and records it, prefixed with the repository
+// it happened on, if any
+func (w *sweep) fail(log *zap.Logger, repo *models.Repository, msg string, err error) {
+	log.Error(msg, zap.Error(err))
+
+	if len(w.errs) == maxSweepErrors {
+		return
+	}
+	if repo != nil {
+		msg = fmt.Sprintf("%s/%s: %s", repo.Owner, repo.Name, msg)
+	}
+	w.errs = append(w.errs, fmt.Sprintf("%s: %v", msg, err))
+}
+
+// New returns a scheduler fetching every repository on its own schedule, or every
+// interval when it has none. The scheduler sleeps until the next repository is
+// due, and at most pollInterval, so that new repositories and schedule changes
+// are picked up. Adaptive schedules are widened and narrowed within bounds, going
+// by the commits stored since their last run, and the tasks are spread following
+// the dispatch policy. The scheduler is paused, resumed and asked for a sweep
+// through the state it shares with the other instances, from any of them.
+func New(log *zap.Logger, tasksService tasksService, repoStore repoStore, commitStore commitStore, taskStore taskStore, stateStore stateStore, leaderStore leaderStore, interval, pollInterval time.Duration, bounds models.AdaptiveBounds, dispatch DispatchPolicy) *service {
 	log = log.With(zap.String("service", "scheduler"))
 
 	return &service{
-		log: 		log,
+		log:          log,
 		tasksService: tasksService,
-		interval: interval,
+		repoStore:    repoStore,
+		commitStore:  commitStore,
+		taskStore:    taskStore,
+		stateStore:   stateStore,
+		leaderStore:  leaderStore,
+		interval:     interval,
+		pollInterval: pollInterval,
+		bounds:       bounds,
+		dispatch:     dispatch,
 	}
 }
 
@@ -34,25 +124,269 @@ func (s *service) Start(ctx context.Context) {
 
 	log.Info("starting scheduler")
 
-	log.Info("starting tasks")
-	if err := s.tasksService.StartTasks(ctx); err != nil {
-		log.Error("error starting tasks", zap.Error(err))
-	}
-	
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
-
+	var next, lastSweep time.Time
 	for {
+		// taken before reading the state, so that a sweep requested while it is
+		// read isn't taken as done by this one
+		now := time.Now()
+
+		state, err := s.stateStore.Get(ctx)
+		if err != nil {
+			// without its state the scheduler can't tell whether it is paused,
+			// so it doesn't sweep until the state is read again
+			log.Error("error retrieving scheduler state", zap.Error(err))
+		} else {
+			requested := state.RunRequestedAt != nil &&
+				(state.LastRunStartedAt == nil || state.RunRequestedAt.After(*state.LastRunStartedAt))
+			due := (!next.IsZero() && !now.Before(next)) || !now.Before(lastSweep.Add(s.pollInterval))
+
+			if requested || (due && !state.Paused) {
+				if requested {
+					log.Info("running requested sweep", zap.Bool("paused", state.Paused))
+				}
+				w := s.runDue(ctx, now, requested)
+				next, lastSweep = w.next, now
+				s.record(ctx, now, w)
+			}
+		}
+
+		wait := controlInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = max(time.Until(next), 0)
+		}
+		timer := time.NewTimer(wait)
+
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			log.Info("scheduler stopped")
 			return
 
-		case <-ticker.C:
-			log.Info("starting tasks")
-			if err := s.tasksService.StartTasks(ctx); err != nil {
-				log.Error("error starting tasks", zap.Error(err))
+		case <-timer.C:
+		}
+	}
+}
+
+// runDue starts the scheduled task of every active repository due at now, or of
+// every active repository when forced, the most overdue first, as long as the
+// dispatch caps and the budget of any quiet window throttling it allow it. A
+// repository in a quiet window skipping its fetches is put off until the window
+// closes, forced or not. Once started, runDue adapts the interval of the repository and moves
+// its next run to when its schedule is next due. A repository the scheduler
+// hasn't seen yet is given its next run without being fetched, so that
+// repositories aren't all fetched at once, unless forced. The sweep holds the
+// earliest next run, zero when no repository is scheduled.
+func (s *service) runDue(ctx context.Context, now time.Time, force bool) sweep {
+	log := s.log.With(zap.String("method", "runDue"))
+
+	var w sweep
+
+	repos, err := s.repoStore.List(ctx)
+	if err != nil {
+		w.fail(log, nil, "error retrieving repositories", err)
+		return w
+	}
+
+	var due []models.Repository
+	for _, repo := range repos {
+		if !repo.IsActive || !repo.Schedule.Enabled {
+			continue
+		}
+
+		nextRunAt := repo.Schedule.NextRunAt
+		switch {
+		case force:
+			due = append(due, repo)
+
+		case nextRunAt == nil:
+			log := log.With(zap.String("repo_owner", repo.Owner), zap.String("repo_name", repo.Name))
+			schedule, err := s.schedule(repo.ID, repo.Schedule, now)
+			if err != nil {
+				w.fail(log, &repo, "error scheduling repository", err)
+				continue
+			}
+			if err := s.repoStore.UpdateScheduleRun(ctx, repo.ID, schedule); err != nil {
+				w.fail(log, &repo, "error saving schedule run", err)
+			}
+			w.earliest(*schedule.NextRunAt)
+
+		case nextRunAt.After(now):
+			w.earliest(*nextRunAt)
+
+		default:
+			due = append(due, repo)
+		}
+	}
+	if len(due) == 0 {
+		return w
+	}
+
+	active, err := s.taskStore.CountActiveByOwner(ctx)
+	if err != nil {
+		w.fail(log, nil, "error counting active tasks", err)
+		w.earliest(now.Add(dispatchRetry))
+		return w
+	}
+	var total int64
+	for _, count := range active {
+		total += count
+	}
+
+	// repositories the scheduler hasn't seen yet come first in a forced sweep
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i].Schedule.NextRunAt, due[j].Schedule.NextRunAt
+		return (a == nil && b != nil) || (a != nil && b != nil && a.Before(*b))
+	})
+
+	for _, repo := range due {
+		window, closesAt, quiet := s.dispatch.quietAt(now, repo)
+		if quiet && window.Mode == models.QuietModeSkip {
+			s.skip(ctx, repo, closesAt, &w)
+			continue
+		}
+
+		throttled := quiet && total >= int64(window.Budget)
+		if throttled || !s.dispatch.allows(total, active[repo.Owner]) {
+			// the repository stays due until enough tasks have finished
+			w.deferred++
+			w.earliest(now.Add(dispatchRetry))
+			if force && (repo.Schedule.NextRunAt == nil || repo.Schedule.NextRunAt.After(now)) {
+				schedule := repo.Schedule
+				schedule.NextRunAt = &now
+				if err := s.repoStore.UpdateScheduleRun(ctx, repo.ID, schedule); err != nil {
+					w.fail(log, &repo, "error saving schedule run", err)
+				}
 			}
+			continue
 		}
+		total++
+		active[repo.Owner]++
+
+		s.run(ctx, repo, now, &w)
+	}
+	if w.deferred > 0 {
+		log.Info("deferred due repositories over the dispatch caps", zap.Int("count", w.deferred), zap.Int64("active_tasks", total))
+	}
+	if w.skipped > 0 {
+		log.Info("skipped due repositories in quiet windows", zap.Int("count", w.skipped))
+	}
+
+	return w
+}
+
+// run starts the scheduled task of a due repository and records the run in the
+// repository and the sweep
+func (s *service) run(ctx context.Context, repo models.Repository, now time.Time, w *sweep) {
+	log := s.log.With(zap.String("method", "run"), zap.String("repo_owner", repo.Owner), zap.String("repo_name", repo.Name))
+
+	taskID, err := s.tasksService.StartScheduledTask(ctx, repo)
+	if err != nil {
+		w.fail(log, &repo, "error starting scheduled task", err)
+	} else {
+		log.Info("started scheduled task", zap.String("task_id", taskID))
+		w.dispatched = append(w.dispatched, models.DispatchedRepo{Owner: repo.Owner, Name: repo.Name, TaskID: taskID})
+	}
+
+	adapted, err := s.adapt(ctx, repo)
+	if err != nil {
+		w.fail(log, &repo, "error adapting schedule", err)
+		adapted = repo.Schedule
+	}
+
+	// a failed run waits for the next one, rather than being retried on every
+	// pass
+	schedule, err := s.schedule(repo.ID, adapted, now)
+	if err != nil {
+		w.fail(log, &repo, "error computing next run", err)
+		w.earliest(now.Add(s.pollInterval))
+		return
+	}
+	schedule.LastRunAt = &now
+	if err := s.repoStore.UpdateScheduleRun(ctx, repo.ID, schedule); err != nil {
+		w.fail(log, &repo, "error saving schedule run", err)
+	}
+	w.earliest(*schedule.NextRunAt)
+}
+
+// skip puts the run of a due repository in a quiet window off until the window
+// closes, plus a random jitter, without starting its task
+func (s *service) skip(ctx context.Context, repo models.Repository, closesAt time.Time, w *sweep) {
+	log := s.log.With(zap.String("method", "skip"), zap.String("repo_owner", repo.Owner), zap.String("repo_name", repo.Name))
+
+	next := closesAt.Add(s.dispatch.jitter())
+	schedule := repo.Schedule
+	schedule.NextRunAt = &next
+	if err := s.repoStore.UpdateScheduleRun(ctx, repo.ID, schedule); err != nil {
+		w.fail(log, &repo, "error saving schedule run", err)
+	}
+	w.skipped++
+	w.earliest(next)
+}
+
+// record saves the outcome of a sweep started at the given time in the state of
+// the scheduler
+func (s *service) record(ctx context.Context, startedAt time.Time, w sweep) {
+	finishedAt := time.Now()
+	state := models.SchedulerState{
+		LastRunStartedAt:  &startedAt,
+		LastRunFinishedAt: &finishedAt,
+		LastDispatched:    w.dispatched,
+		LastDeferred:      w.deferred,
+		LastSkipped:       w.skipped,
+		LastErrors:        w.errs,
+	}
+	if !w.next.IsZero() {
+		state.NextRunAt = &w.next
+	}
+	if state.LastDispatched == nil {
+		state.LastDispatched = []models.DispatchedRepo{}
+	}
+	if state.LastErrors == nil {
+		state.LastErrors = []string{}
+	}
+
+	if err := s.stateStore.RecordRun(ctx, state); err != nil {
+		s.log.Error("error recording sweep", zap.String("method", "record"), zap.Error(err))
+	}
+}
+
+// schedule returns the schedule of a repository with its next run after now: the
+// next time its cron expression is due, or the slot of the repository within its
+// interval, plus a random jitter
+func (s *service) schedule(repoID string, schedule models.RepoSchedule, now time.Time) (models.RepoSchedule, error) {
+	next, err := schedule.Next(now, s.interval)
+	if err != nil {
+		return models.RepoSchedule{}, err
+	}
+	if schedule.Cron == "" {
+		next = stagger(repoID, now, next.Sub(now))
+	}
+	next = next.Add(s.dispatch.jitter())
+
+	schedule.NextRunAt = &next
+	return schedule, nil
+}
+
+// adapt returns the schedule of the repository with the interval of its next run,
+// going by the commits stored since its last run
+func (s *service) adapt(ctx context.Context, repo models.Repository) (models.RepoSchedule, error) {
+	var newCommits int64
+	if repo.Schedule.Adaptive && repo.Schedule.LastRunAt != nil {
+		var err error
+		newCommits, err = s.commitStore.CountSince(ctx, repo.ID, *repo.Schedule.LastRunAt)
+		if err != nil {
+			return models.RepoSchedule{}, err
+		}
+	}
+
+	schedule, err := repo.Schedule.Adapt(newCommits, s.interval, s.bounds)
+	if err != nil {
+		return models.RepoSchedule{}, err
+	}
+	if schedule.Adaptive && schedule.EffectiveInterval != repo.Schedule.EffectiveInterval {
+		s.log.Info("adapted repository interval",
+			zap.String("repo_owner", repo.Owner), zap.String("repo_name", repo.Name),
+			zap.String("interval", schedule.EffectiveInterval), zap.String("reason", schedule.IntervalReason))
 	}
+	return schedule, nil
 }
@@ -0,0 +1,211 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"go.uber.org/zap"
+)
+
+type fakeTasks struct {
+	started []string
+}
+
+func (f *fakeTasks) StartScheduledTask(ctx context.Context, repo models.Repository) (string, error) {
+	f.started = append(f.started, repo.ID)
+	return "task-" + repo.ID, nil
+}
+
+type fakeRepos struct {
+	repos []models.Repository
+	runs  map[string]models.RepoSchedule
+}
+
+func (f *fakeRepos) List(ctx context.Context) ([]models.Repository, error) { return f.repos, nil }
+
+func (f *fakeRepos) UpdateScheduleRun(ctx context.Context, repoID string, schedule models.RepoSchedule) error {
+	f.runs[repoID] = schedule
+	return nil
+}
+
+type fakeCommits struct{}
+
+func (fakeCommits) CountSince(ctx context.Context, repoID string, since time.Time) (int64, error) {
+	return 0, nil
+}
+
+type fakeActive map[string]int64
+
+func (f fakeActive) CountActiveByOwner(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64, len(f))
+	for owner, count := range f {
+		counts[owner] = count
+	}
+	return counts, nil
+}
+
+func TestRunDue(t *testing.T) {
+	now := time.Date(2025, 3, 17, 7, 30, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	repo := func(id, owner string, nextRunAt *time.Time) models.Repository {
+		return models.Repository{ID: id, Owner: owner, IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: nextRunAt}}
+	}
+
+	repos := &fakeRepos{
+		repos: []models.Repository{
+			repo("a-1", "a", at(-time.Minute)),
+			repo("a-2", "a", at(-3*time.Minute)),
+			repo("a-3", "a", at(-2*time.Minute)),
+			repo("b-1", "b", at(-time.Minute)),
+			repo("c-1", "c", at(-time.Minute)),
+			repo("d-1", "d", at(time.Hour)),
+			repo("e-1", "e", nil),
+		},
+		runs: make(map[string]models.RepoSchedule),
+	}
+	tasks := &fakeTasks{}
+	policy := DispatchPolicy{Jitter: time.Second, MaxConcurrent: 5, MaxPerOwner: 2}
+	s := New(zap.NewNop(), tasks, repos, fakeCommits{}, fakeActive{"b": 2}, nil, nil, time.Hour, time.Minute, models.AdaptiveBounds{}, policy)
+
+	w := s.runDue(context.Background(), now, false)
+
+	// owner a is capped at two tasks, the most overdue first, owner b already has
+	// two, counting towards the cap of five, and c gets the last one
+	assert.Equal(t, []string{"a-2", "a-3", "c-1"}, tasks.started)
+	assert.Equal(t, now.Add(dispatchRetry), w.next, "the deferred repositories are retried")
+	assert.Equal(t, 2, w.deferred)
+	assert.Empty(t, w.errs)
+	assert.Equal(t, []models.DispatchedRepo{
+		{Owner: "a", TaskID: "task-a-2"},
+		{Owner: "a", TaskID: "task-a-3"},
+		{Owner: "c", TaskID: "task-c-1"},
+	}, w.dispatched)
+
+	for _, id := range []string{"a-2", "a-3", "c-1"} {
+		run := repos.runs[id]
+		if assert.NotNil(t, run.LastRunAt, id) && assert.NotNil(t, run.NextRunAt, id) {
+			assert.True(t, now.Equal(*run.LastRunAt))
+			assert.True(t, run.NextRunAt.After(now))
+			assert.LessOrEqual(t, run.NextRunAt.Sub(now), time.Hour+policy.Jitter)
+		}
+	}
+	assert.NotContains(t, repos.runs, "a-1")
+	assert.NotContains(t, repos.runs, "b-1")
+	assert.NotContains(t, repos.runs, "d-1")
+
+	// a repository the scheduler hasn't seen is given its slot instead of running
+	if run, ok := repos.runs["e-1"]; assert.True(t, ok) && assert.NotNil(t, run.NextRunAt) {
+		assert.Nil(t, run.LastRunAt)
+		assert.True(t, run.NextRunAt.After(now))
+	}
+}
+
+func TestRunDue_Forced(t *testing.T) {
+	now := time.Date(2025, 3, 17, 7, 30, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+
+	repos := &fakeRepos{
+		repos: []models.Repository{
+			{ID: "a-1", Owner: "a", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &later}},
+			{ID: "a-2", Owner: "a", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &later}},
+			{ID: "b-1", Owner: "b", IsActive: true, Schedule: models.RepoSchedule{Enabled: true}},
+			{ID: "c-1", Owner: "c", IsActive: false, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &later}},
+			{ID: "d-1", Owner: "d", IsActive: true, Schedule: models.RepoSchedule{Enabled: false}},
+		},
+		runs: make(map[string]models.RepoSchedule),
+	}
+	tasks := &fakeTasks{}
+	policy := DispatchPolicy{MaxConcurrent: 10, MaxPerOwner: 1}
+	s := New(zap.NewNop(), tasks, repos, fakeCommits{}, fakeActive{}, nil, nil, time.Hour, time.Minute, models.AdaptiveBounds{}, policy)
+
+	w := s.runDue(context.Background(), now, true)
+
+	// every active repository with an enabled schedule runs, whether due or not
+	assert.Equal(t, []string{"b-1", "a-1"}, tasks.started)
+	assert.Equal(t, 1, w.deferred)
+
+	// and the one held back over the caps is left due
+	if run, ok := repos.runs["a-2"]; assert.True(t, ok) && assert.NotNil(t, run.NextRunAt) {
+		assert.True(t, now.Equal(*run.NextRunAt))
+	}
+}
+
+func TestRunDue_QuietWindows(t *testing.T) {
+	now := time.Date(2025, 3, 17, 10, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	// business hours throttle every repository to a single task at once, and one
+	// of them isn't fetched at all until noon
+	throttle := models.QuietWindow{Cron: "CRON_TZ=UTC 0 9 * * 1-5", Duration: "8h", Mode: models.QuietModeThrottle, Budget: 1}
+	skip := models.QuietWindow{Cron: "CRON_TZ=UTC 0 8 * * *", Duration: "4h", Mode: models.QuietModeSkip}
+
+	repos := &fakeRepos{
+		repos: []models.Repository{
+			{ID: "a-1", Owner: "a", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &due, QuietWindows: []models.QuietWindow{skip}}},
+			{ID: "b-1", Owner: "b", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &due}},
+			{ID: "c-1", Owner: "c", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &due}},
+		},
+		runs: make(map[string]models.RepoSchedule),
+	}
+	tasks := &fakeTasks{}
+	policy := DispatchPolicy{Jitter: time.Second, MaxConcurrent: 10, MaxPerOwner: 2, QuietWindows: []models.QuietWindow{throttle}}
+	s := New(zap.NewNop(), tasks, repos, fakeCommits{}, fakeActive{}, nil, nil, time.Hour, time.Minute, models.AdaptiveBounds{}, policy)
+
+	w := s.runDue(context.Background(), now, false)
+
+	assert.Equal(t, []string{"b-1"}, tasks.started)
+	assert.Equal(t, 1, w.deferred, "c-1 is over the budget of the throttle window")
+	assert.Equal(t, 1, w.skipped)
+	assert.NotContains(t, repos.runs, "c-1")
+
+	noon := time.Date(2025, 3, 17, 12, 0, 0, 0, time.UTC)
+	if run, ok := repos.runs["a-1"]; assert.True(t, ok) && assert.NotNil(t, run.NextRunAt) {
+		assert.Nil(t, run.LastRunAt, "a skipped repository isn't fetched")
+		assert.False(t, run.NextRunAt.Before(noon), "and waits for the window to close")
+		assert.Less(t, run.NextRunAt.Sub(noon), policy.Jitter)
+	}
+}
+
+// failingState fails to read the state of the scheduler, and records the reads
+type failingState struct {
+	stateStore
+	reads chan struct{}
+}
+
+func (f *failingState) Get(ctx context.Context) (models.SchedulerState, error) {
+	select {
+	case f.reads <- struct{}{}:
+	default:
+	}
+	return models.SchedulerState{}, errors.New("database is locked")
+}
+
+func TestStart_SkipsSweepWhenStateUnreadable(t *testing.T) {
+	repos := &fakeRepos{
+		repos: []models.Repository{{ID: "a-1", Owner: "a", IsActive: true, Schedule: models.RepoSchedule{Enabled: true, NextRunAt: &time.Time{}}}},
+		runs:  make(map[string]models.RepoSchedule),
+	}
+	tasks := &fakeTasks{}
+	state := &failingState{reads: make(chan struct{})}
+	s := New(zap.NewNop(), tasks, repos, fakeCommits{}, fakeActive{}, state, nil, time.Hour, time.Minute, models.AdaptiveBounds{}, DispatchPolicy{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx)
+	}()
+
+	// the scheduler may be paused, so the overdue repository isn't fetched
+	<-state.reads
+	cancel()
+	<-done
+	assert.Empty(t, tasks.started)
+}
@@ -0,0 +1,62 @@
+package watchdog
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	service struct {
+		log          *zap.Logger
+		tasksService tasksService
+		interval     time.Duration
+		timeout      time.Duration
+		requeue      bool
+	}
+
+	tasksService interface {
+		ReapStaleTasks(ctx context.Context, timeout time.Duration, requeue bool) (int, error)
+	}
+)
+
+// New creates a watchdog that checks for stale tasks every interval. Tasks with no
+// heartbeat within timeout are finished, and requeued when requeue is set.
+func New(log *zap.Logger, tasksService tasksService, interval, timeout time.Duration, requeue bool) *service {
+	log = log.With(zap.String("service", "watchdog"))
+
+	return &service{
+		log:          log,
+		tasksService: tasksService,
+		interval:     interval,
+		timeout:      timeout,
+		requeue:      requeue,
+	}
+}
+
+func (s *service) Start(ctx context.Context) {
+	log := s.log.With(zap.String("method", "Start"))
+
+	log.Info("starting watchdog", zap.Duration("interval", s.interval), zap.Duration("timeout", s.timeout))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("watchdog stopped")
+			return
+
+		case <-ticker.C:
+			reaped, err := s.tasksService.ReapStaleTasks(ctx, s.timeout, s.requeue)
+			if err != nil {
+				log.Error("error reaping stale tasks", zap.Error(err))
+			}
+			if reaped > 0 {
+				log.Warn("reaped stale tasks", zap.Int("count", reaped), zap.Bool("requeued", s.requeue))
+			}
+		}
+	}
+}
@@ -2,21 +2,29 @@ package fetcher
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/events"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
 	"github.com/victor-nach/git-monitor/internal/http/utils"
+	"github.com/victor-nach/git-monitor/internal/worker/idempotency"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
 	"go.uber.org/zap"
 )
 
+// consumerName identifies the worker in the processed messages ledger
+const consumerName = "fetcher"
+
 type (
 	worker struct {
 		log           *zap.Logger
 		githubService githubService
 		taskService   taskService
 		eventBus      eventBus
+		dedup         dedup
 		workerCount   int
 	}
 
@@ -25,22 +33,37 @@ type (
 	}
 
 	taskService interface {
-		UpdateStatus(ctx context.Context, taskID string, status string, errMsg *string) error
+		MarkStarted(ctx context.Context, taskID string) error
+		MarkFailed(ctx context.Context, taskID string, errMsg string) error
+		RetryOrFail(ctx context.Context, taskID string, cause error) error
+		FinishCancel(ctx context.Context, taskID string) error
+		IsCancelled(ctx context.Context, taskID string) (bool, error)
+		WithCancellation(ctx context.Context, taskID string) (context.Context, context.CancelFunc)
+		GetCheckpoint(ctx context.Context, taskID string) (*models.TaskCheckpoint, error)
+		Heartbeat(ctx context.Context, taskID string, at time.Time) error
+		RecordBatchFetched(ctx context.Context, taskID string, batchID int, commits []models.Commit) error
+		RecordBatchFailed(ctx context.Context, taskID string, batchID int, errMsg string) error
+		FinishFetch(ctx context.Context, taskID string, totalBatches int) error
 	}
 
 	eventBus interface {
-		Publish(ctx context.Context, topic string, message interface{}) error
-		Subscribe(ctx context.Context, topic string, handler func(message []byte) error) error
+		Publish(ctx context.Context, topic string, message interface{}, opts ...eventbus.PublishOption) error
+		Subscribe(ctx context.Context, topic string, handler eventbus.Handler) error
+	}
+
+	dedup interface {
+		Wrap(consumer string, handler eventbus.Handler, opts ...idempotency.Option) eventbus.Handler
 	}
 )
 
-func New(log *zap.Logger, githubService githubService, taskService taskService, eventBus eventBus, workerCount int) *worker {
+func New(log *zap.Logger, githubService githubService, taskService taskService, eventBus eventBus, dedup dedup, workerCount int) *worker {
 	log = log.With(zap.String("worker", "fetcher"))
 
 	return &worker{
 		log:           log,
 		githubService: githubService,
 		eventBus:      eventBus,
+		dedup:         dedup,
 		taskService:   taskService,
 		workerCount:   workerCount,
 	}
@@ -51,12 +74,14 @@ func (w *worker) Subscribe(ctx context.Context) error {
 
 	log.Info("subscribing to fetch commit events")
 
+	handler := w.dedup.Wrap(consumerName, w.handleEvent, idempotency.WithoutTransaction())
+
 	for i := 0; i < w.workerCount; i++ {
 		go func(workerID int) {
 			log := log.With(zap.Int("worker_id", workerID))
 			log.Info("fetcher worker subscribing to fetch commit events")
 
-			err := w.eventBus.Subscribe(ctx, events.FetchCommitEventTopic, w.handleEvent)
+			err := w.eventBus.Subscribe(ctx, events.FetchCommitEventTopic, handler)
 			if err != nil {
 				log.Error("subscription error", zap.Error(err))
 			}
@@ -65,12 +90,16 @@ func (w *worker) Subscribe(ctx context.Context) error {
 	return nil
 }
 
-func (w *worker) handleEvent(msg []byte) error {
+func (w *worker) handleEvent(ctx context.Context, env eventbus.Envelope) error {
+	if env.SchemaVersion != events.FetchCommitEventVersion {
+		return w.failTask(ctx, env.CorrelationID, fmt.Errorf("unsupported fetch commit event schema version: %d", env.SchemaVersion))
+	}
+
 	var event events.FetchCommitEvent
-	if err := json.Unmarshal(msg, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal fetch commit event: %w", err)
+	if err := env.Decode(&event); err != nil {
+		return w.failTask(ctx, env.CorrelationID, fmt.Errorf("failed to unmarshal fetch commit event: %w", err))
 	}
-	return w.handleFetchCommitEvent(context.Background(), event)
+	return w.handleFetchCommitEvent(ctx, event)
 }
 
 func (w *worker) handleFetchCommitEvent(ctx context.Context, event events.FetchCommitEvent) error {
@@ -82,13 +111,54 @@ func (w *worker) handleFetchCommitEvent(ctx context.Context, event events.FetchC
 
 	log.Info("received fetch commit event")
 
+	if err := w.taskService.MarkStarted(ctx, event.TaskID); err != nil {
+		if errors.Is(err, dErrors.ErrInvalidTaskTransition) {
+			// a task cancelled while its fetch was waiting for redelivery is
+			// only marked cancelled now, while a task in any other status,
+			// e.g. finished or queued again, is left as it is
+			log.Info("task can't be started, skipping fetch commit event")
+			return w.finishCancel(ctx, log, event.TaskID)
+		}
+		log.Error("failed to mark task started", zap.Error(err))
+		return fmt.Errorf("failed to mark task started: %w", err)
+	}
+
+	if err := w.taskService.Heartbeat(ctx, event.TaskID, time.Now()); err != nil {
+		return w.heartbeatError(ctx, log, event.TaskID, err)
+	}
+
 	req := models.GetCommitsStreamRequest{
 		RepoID:   event.RepoID,
 		RepoInfo: event.RepoInfo,
 		Since:    &event.Since,
 	}
+	if !event.Until.IsZero() {
+		req.Until = &event.Until
+	}
 
-	resp := w.githubService.GetCommitsStream(ctx, req)
+	// batches are numbered after the page they hold, from 1, so that a
+	// redelivered or resumed fetch records the same batches again
+	batchID := 0
+
+	// a task interrupted part way resumes after the pages it has already saved
+	checkpoint, err := w.taskService.GetCheckpoint(ctx, event.TaskID)
+	if err != nil {
+		log.Error("failed to get task checkpoint", zap.Error(err))
+		return fmt.Errorf("failed to get task checkpoint: %w", err)
+	}
+	if checkpoint != nil {
+		log.Info("resuming fetch from checkpoint", zap.Int("page", checkpoint.Page), zap.Time("oldestCommitTime", checkpoint.OldestCommitTime))
+		req.Until = &checkpoint.Until
+		req.Page = checkpoint.Page + 1
+		batchID = checkpoint.Page
+	}
+
+	// the stream runs with a context cancelled when the task is, while the task
+	// and event bus updates use ctx so they still go through after cancellation
+	fetchCtx, release := w.taskService.WithCancellation(ctx, event.TaskID)
+	defer release()
+
+	resp := w.githubService.GetCommitsStream(fetchCtx, req)
 
 	for {
 		select {
@@ -98,16 +168,45 @@ func (w *worker) handleFetchCommitEvent(ctx context.Context, event events.FetchC
 				goto COMPLETE
 			}
 
-			log.Info("fetched a batch of commits", zap.Int("commitCount", len(commits)))
+			// fetches running in another process than the cancel request
+			// only learn about it from the task status
+			cancelled, err := w.taskService.IsCancelled(ctx, event.TaskID)
+			if err != nil {
+				log.Error("failed to check task cancellation", zap.Error(err))
+				return fmt.Errorf("failed to check task cancellation: %w", err)
+			}
+			if cancelled {
+				return w.finishCancel(ctx, log, event.TaskID)
+			}
+
+			if err := w.taskService.Heartbeat(ctx, event.TaskID, time.Now()); err != nil {
+				return w.heartbeatError(ctx, log, event.TaskID, err)
+			}
+
+			batchID++
+			log.Info("fetched a batch of commits", zap.Int("batchID", batchID), zap.Int("commitCount", len(commits)))
+
+			if err := w.taskService.RecordBatchFetched(ctx, event.TaskID, batchID, commits); err != nil {
+				log.Error("failed to record batch fetched", zap.Error(err))
+				return fmt.Errorf("failed to record batch fetched: %w", err)
+			}
 
 			// Publish the save commit event
 			saveEvent := events.SaveCommitEvent{
 				RepoInfo: event.RepoInfo,
-				TaskID:  event.TaskID,
-				Commits: commits,
+				TaskID:   event.TaskID,
+				BatchID:  batchID,
+				Commits:  commits,
 			}
-			if err := w.eventBus.Publish(ctx, events.SaveCommitEventTopic, saveEvent); err != nil {
+			err = w.eventBus.Publish(ctx, events.SaveCommitEventTopic, saveEvent,
+				eventbus.WithCorrelationID(event.TaskID),
+				eventbus.WithSchemaVersion(events.SaveCommitEventVersion),
+			)
+			if err != nil {
 				log.Error("failed to publish save commit event", zap.Error(err))
+				if rerr := w.taskService.RecordBatchFailed(ctx, event.TaskID, batchID, err.Error()); rerr != nil {
+					log.Error("failed to record batch failure", zap.Error(rerr))
+				}
 				return fmt.Errorf("failed to publish save commit event: %w", err)
 			}
 
@@ -116,25 +215,105 @@ func (w *worker) handleFetchCommitEvent(ctx context.Context, event events.FetchC
 				log.Info("error channel closed")
 				goto COMPLETE
 			}
-			log.Error("error fetching commit batch", zap.Error(err))
-			return fmt.Errorf("error fetching commit batch: %w", err)
+			if fetchCtx.Err() != nil {
+				// the request failed because the fetch was stopped
+				return w.stopFetch(ctx, log, fetchCtx, event.TaskID)
+			}
+			return w.retryOrFail(ctx, log, event.TaskID, fmt.Errorf("error fetching commit batch: %w", err))
 
 		case <-resp.DoneChan:
 			log.Info("commit streaming completed")
 			goto COMPLETE
 
-		case <-ctx.Done():
-			log.Info("context cancelled, aborting fetch commit event", zap.Error(ctx.Err()))
-			return fmt.Errorf("context cancelled: %w", ctx.Err())
+		case <-fetchCtx.Done():
+			return w.stopFetch(ctx, log, fetchCtx, event.TaskID)
 		}
 	}
 
 COMPLETE:
-	if err := w.taskService.UpdateStatus(ctx, event.TaskID, models.TaskStatusCompleted, nil); err != nil {
-		log.Error("failed to update job status", zap.Error(err))
-		return fmt.Errorf("failed to update job status: %w", err)
+	// the stream also ends when it is stopped, without having fetched everything
+	if fetchCtx.Err() != nil {
+		return w.stopFetch(ctx, log, fetchCtx, event.TaskID)
+	}
+
+	// the task is completed once the saver has saved every batch
+	if err := w.taskService.FinishFetch(ctx, event.TaskID, batchID); err != nil {
+		log.Error("failed to finish fetch", zap.Error(err))
+		return fmt.Errorf("failed to finish fetch: %w", err)
 	}
 
 	log.Info("fetch commit event completed successfully")
 	return nil
 }
+
+// retryOrFail hands a failed fetch over to the retry policy of the task service,
+// which reschedules rate limited fetches, retries those failing with another
+// transient error and fails the task otherwise. The event is then handled, the
+// retry being a new fetch commit event.
+func (w *worker) retryOrFail(ctx context.Context, log *zap.Logger, taskID string, err error) error {
+	log.Warn("fetch commit event failed", zap.Error(err), zap.Bool("transient", dErrors.IsTransient(err)))
+
+	if rerr := w.taskService.RetryOrFail(ctx, taskID, err); rerr != nil && !errors.Is(rerr, dErrors.ErrInvalidTaskTransition) {
+		log.Error("failed to retry or fail task", zap.Error(rerr))
+		return fmt.Errorf("failed to retry or fail task: %w", rerr)
+	}
+
+	return nil
+}
+
+// heartbeatError handles an error recording the heartbeat of a task. A fetch whose
+// repository lease has been taken over, after its heartbeat stopped for too long,
+// fails its task so that only the task holding the lease goes on.
+func (w *worker) heartbeatError(ctx context.Context, log *zap.Logger, taskID string, err error) error {
+	if errors.Is(err, dErrors.ErrLeaseLost) {
+		return w.failTask(ctx, taskID, err)
+	}
+
+	log.Error("failed to record task heartbeat", zap.Error(err))
+	return fmt.Errorf("failed to record task heartbeat: %w", err)
+}
+
+// stopFetch handles a fetch whose context is done. A cancelled task is marked
+// cancelled, while a fetch stopped by the worker shutting down returns an error
+// so that the event bus redelivers it.
+func (w *worker) stopFetch(ctx context.Context, log *zap.Logger, fetchCtx context.Context, taskID string) error {
+	if errors.Is(context.Cause(fetchCtx), dErrors.ErrTaskCancelled) {
+		return w.finishCancel(ctx, log, taskID)
+	}
+
+	log.Info("context cancelled, aborting fetch commit event", zap.Error(fetchCtx.Err()))
+	return fmt.Errorf("context cancelled: %w", fetchCtx.Err())
+}
+
+// finishCancel marks a task that is cancelling as cancelled once its fetch has stopped
+func (w *worker) finishCancel(ctx context.Context, log *zap.Logger, taskID string) error {
+	if err := w.taskService.FinishCancel(ctx, taskID); err != nil {
+		if errors.Is(err, dErrors.ErrInvalidTaskTransition) {
+			// the task isn't cancelling
+			return nil
+		}
+		log.Error("failed to mark task cancelled", zap.Error(err))
+		return fmt.Errorf("failed to mark task cancelled: %w", err)
+	}
+
+	log.Info("task cancelled, fetch commit event stopped")
+	return nil
+}
+
+// failTask marks the task failed with the given error. The event is then treated
+// as handled, since delivering it again would fail the same way.
+func (w *worker) failTask(ctx context.Context, taskID string, err error) error {
+	log := w.log.With(zap.String("method", "failTask"), zap.String("taskID", taskID))
+	log.Error("failed to handle fetch commit event, failing task", zap.Error(err))
+
+	if taskID == "" {
+		return nil
+	}
+
+	if ferr := w.taskService.MarkFailed(ctx, taskID, err.Error()); ferr != nil && !errors.Is(ferr, dErrors.ErrInvalidTaskTransition) {
+		log.Error("failed to mark task failed", zap.Error(ferr))
+		return fmt.Errorf("failed to mark task failed: %w", ferr)
+	}
+
+	return nil
+}
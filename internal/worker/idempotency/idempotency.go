@@ -0,0 +1,127 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/pkg/aftercommit"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+	"go.uber.org/zap"
+)
+
+type (
+	middleware struct {
+		log        *zap.Logger
+		ledger     ledger
+		transactor transactor
+	}
+
+	ledger interface {
+		IsProcessed(ctx context.Context, messageID, consumer string) (bool, error)
+		MarkProcessed(ctx context.Context, msg models.ProcessedMessage) error
+	}
+
+	transactor interface {
+		Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	options struct {
+		transactional bool
+	}
+
+	// Option customises how a handler is wrapped
+	Option func(*options)
+)
+
+// WithoutTransaction records the message after the handler succeeds instead of
+// inside a transaction shared with the handler. It is meant for long running
+// handlers, like the fetcher streaming from GitHub, which must not hold a database
+// transaction open. A crash between the handler and the record leads to the
+// message being handled again, so such handlers must be safe to re-run.
+func WithoutTransaction() Option {
+	return func(o *options) {
+		o.transactional = false
+	}
+}
+
+func New(log *zap.Logger, ledger ledger, transactor transactor) *middleware {
+	return &middleware{
+		log:        log.With(zap.String("middleware", "idempotency")),
+		ledger:     ledger,
+		transactor: transactor,
+	}
+}
+
+// Wrap returns a handler that skips messages already processed by the consumer.
+// By default the handler runs in a transaction together with the record of the
+// message, so its database writes and the record commit or roll back as one. The
+// side effects it defers with aftercommit, such as publishing events, only run
+// once the transaction has committed.
+func (m *middleware) Wrap(consumer string, handler eventbus.Handler, opts ...Option) eventbus.Handler {
+	o := options{transactional: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(ctx context.Context, env eventbus.Envelope) error {
+		log := m.log.With(
+			zap.String("consumer", consumer),
+			zap.String("topic", env.Topic),
+			zap.String("message_id", env.ID),
+		)
+
+		processed, err := m.ledger.IsProcessed(ctx, env.ID, consumer)
+		if err != nil {
+			return fmt.Errorf("failed to check processed message: %w", err)
+		}
+		if processed {
+			log.Info("skipping duplicate message")
+			return nil
+		}
+
+		record := models.ProcessedMessage{
+			MessageID:   env.ID,
+			Consumer:    consumer,
+			Topic:       env.Topic,
+			ProcessedAt: time.Now(),
+		}
+
+		if !o.transactional {
+			if err := handler(ctx, env); err != nil {
+				return err
+			}
+			if err := m.ledger.MarkProcessed(ctx, record); err != nil && !errors.Is(err, dErrors.ErrMessageAlreadyProcessed) {
+				return fmt.Errorf("failed to record processed message: %w", err)
+			}
+			return nil
+		}
+
+		txCtx, hooks := aftercommit.WithHooks(ctx)
+		err = m.transactor.Transaction(txCtx, func(ctx context.Context) error {
+			// Claim the message first so that a concurrent duplicate blocks on the
+			// write lock and then rolls back instead of repeating the writes.
+			if err := m.ledger.MarkProcessed(ctx, record); err != nil {
+				return err
+			}
+			return handler(ctx, env)
+		})
+		if errors.Is(err, dErrors.ErrMessageAlreadyProcessed) {
+			log.Info("skipping duplicate message processed concurrently")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the message is recorded, so a failed side effect can't be retried by
+		// redelivering it; tasks left without their fetch are caught by the watchdog
+		if err := hooks.Run(ctx); err != nil {
+			log.Error("failed to run side effects after commit", zap.Error(err))
+		}
+		return nil
+	}
+}
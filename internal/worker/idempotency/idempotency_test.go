@@ -0,0 +1,165 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
+	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/pkg/aftercommit"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+	"go.uber.org/zap"
+)
+
+// fakeLedger keeps records in memory and supports a single level of transaction
+type fakeLedger struct {
+	mu        sync.Mutex
+	committed map[string]bool
+	pending   map[string]bool
+	inTx      bool
+}
+
+func newFakeLedger() *fakeLedger {
+	return &fakeLedger{committed: make(map[string]bool), pending: make(map[string]bool)}
+}
+
+func (l *fakeLedger) IsProcessed(ctx context.Context, messageID, consumer string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.committed[messageID+consumer], nil
+}
+
+func (l *fakeLedger) MarkProcessed(ctx context.Context, msg models.ProcessedMessage) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := msg.MessageID + msg.Consumer
+	if l.committed[key] || l.pending[key] {
+		return dErrors.ErrMessageAlreadyProcessed
+	}
+	if l.inTx {
+		l.pending[key] = true
+	} else {
+		l.committed[key] = true
+	}
+	return nil
+}
+
+func (l *fakeLedger) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	l.mu.Lock()
+	l.inTx = true
+	l.mu.Unlock()
+
+	err := fn(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		for k := range l.pending {
+			l.committed[k] = true
+		}
+	}
+	l.pending = make(map[string]bool)
+	l.inTx = false
+	return err
+}
+
+func TestWrap_SkipsDuplicates(t *testing.T) {
+	ledger := newFakeLedger()
+	m := New(zap.NewNop(), ledger, ledger)
+
+	calls := 0
+	handler := m.Wrap("saver", func(ctx context.Context, env eventbus.Envelope) error {
+		calls++
+		return nil
+	})
+
+	env := eventbus.Envelope{ID: "msg-1", Topic: "save_commit_event"}
+
+	assert.NoError(t, handler(context.Background(), env))
+	assert.NoError(t, handler(context.Background(), env))
+	assert.Equal(t, 1, calls, "duplicate message should be skipped")
+
+	// a different consumer still processes the same message
+	other := m.Wrap("fetcher", func(ctx context.Context, env eventbus.Envelope) error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, other(context.Background(), env))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrap_FailedHandlerIsNotRecorded(t *testing.T) {
+	ledger := newFakeLedger()
+	m := New(zap.NewNop(), ledger, ledger)
+
+	fail := true
+	calls := 0
+	handler := m.Wrap("saver", func(ctx context.Context, env eventbus.Envelope) error {
+		calls++
+		if fail {
+			return errors.New("db unavailable")
+		}
+		return nil
+	})
+
+	env := eventbus.Envelope{ID: "msg-1", Topic: "save_commit_event"}
+
+	assert.Error(t, handler(context.Background(), env))
+
+	fail = false
+	assert.NoError(t, handler(context.Background(), env), "redelivery should be processed")
+	assert.Equal(t, 2, calls)
+
+	processed, _ := ledger.IsProcessed(context.Background(), "msg-1", "saver")
+	assert.True(t, processed)
+}
+
+func TestWrap_WithoutTransaction(t *testing.T) {
+	ledger := newFakeLedger()
+	m := New(zap.NewNop(), ledger, ledger)
+
+	calls := 0
+	handler := m.Wrap("fetcher", func(ctx context.Context, env eventbus.Envelope) error {
+		calls++
+		assert.False(t, ledger.inTx, "handler should not run inside a transaction")
+		return nil
+	}, WithoutTransaction())
+
+	env := eventbus.Envelope{ID: "msg-1", Topic: "fetch_commit_event"}
+
+	assert.NoError(t, handler(context.Background(), env))
+	assert.NoError(t, handler(context.Background(), env))
+	assert.Equal(t, 1, calls)
+}
+
+func TestWrap_SideEffectsRunAfterCommit(t *testing.T) {
+	ledger := newFakeLedger()
+	m := New(zap.NewNop(), ledger, ledger)
+
+	var published []string
+	fail := true
+	handler := m.Wrap("saver", func(ctx context.Context, env eventbus.Envelope) error {
+		aftercommit.Do(ctx, func(context.Context) error {
+			assert.False(t, ledger.inTx, "side effect should run after the transaction")
+			published = append(published, env.ID)
+			return nil
+		})
+		if fail {
+			return errors.New("db unavailable")
+		}
+		return nil
+	})
+
+	env := eventbus.Envelope{ID: "msg-1", Topic: "save_commit_event"}
+
+	// the side effects of a rolled back transaction are dropped
+	assert.Error(t, handler(context.Background(), env))
+	assert.Empty(t, published)
+
+	fail = false
+	assert.NoError(t, handler(context.Background(), env))
+	assert.Equal(t, []string{"msg-1"}, published)
+}
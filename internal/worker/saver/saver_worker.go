@@ -2,21 +2,29 @@ package saver
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	dErrors "github.com/victor-nach/git-monitor/internal/domain/errors"
 	"github.com/victor-nach/git-monitor/internal/domain/events"
 	"github.com/victor-nach/git-monitor/internal/domain/models"
+	"github.com/victor-nach/git-monitor/internal/worker/idempotency"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
 	"go.uber.org/zap"
 )
 
+// consumerName identifies the worker in the processed messages ledger
+const consumerName = "saver"
+
 type (
 	worker struct {
 		log         *zap.Logger
 		commitSvc   commitService
 		repoSvc     repoService
+		taskSvc     taskService
 		eventBus    eventBus
+		dedup       dedup
 		workerCount int
 	}
 
@@ -28,21 +36,34 @@ type (
 		UpdateTrackingInfo(ctx context.Context, repoInfo models.RepoInfo, lastFetchedCommitTime time.Time) error
 	}
 
+	taskService interface {
+		MarkFailed(ctx context.Context, taskID string, errMsg string) error
+		IsCancelled(ctx context.Context, taskID string) (bool, error)
+		RecordBatchSaved(ctx context.Context, taskID string, batchID int) error
+		RecordBatchFailed(ctx context.Context, taskID string, batchID int, errMsg string) error
+	}
+
 	eventBus interface {
-		Publish(ctx context.Context, topic string, message interface{}) error
-		Subscribe(ctx context.Context, topic string, handler func(message []byte) error) error
+		Publish(ctx context.Context, topic string, message interface{}, opts ...eventbus.PublishOption) error
+		Subscribe(ctx context.Context, topic string, handler eventbus.Handler) error
+	}
+
+	dedup interface {
+		Wrap(consumer string, handler eventbus.Handler, opts ...idempotency.Option) eventbus.Handler
 	}
 )
 
-func New(log *zap.Logger, commitSvc commitService, repoSvc repoService, eventBus eventBus, workerCount int) *worker {
+func New(log *zap.Logger, commitSvc commitService, repoSvc repoService, taskSvc taskService, eventBus eventBus, dedup dedup, workerCount int) *worker {
 	log = log.With(zap.String("worker", "saver"))
 
 	return &worker{
 		log:         log,
 		commitSvc:   commitSvc,
 		eventBus:    eventBus,
+		dedup:       dedup,
 		workerCount: workerCount,
 		repoSvc:     repoSvc,
+		taskSvc:     taskSvc,
 	}
 }
 
@@ -51,12 +72,16 @@ func (w *worker) Subscribe(ctx context.Context) error {
 
 	log.Info("subscribing to save commit events")
 
+	// batch failures are recorded outside of the idempotent handler, whose
+	// transaction is rolled back when it fails
+	handler := w.recordBatchFailure(w.dedup.Wrap(consumerName, w.handleEvent))
+
 	for i := 0; i < w.workerCount; i++ {
 		go func(workerID int) {
 			log := log.With(zap.Int("worker_id", workerID))
 			log.Info("saver worker subscribing to save commit events")
 
-			err := w.eventBus.Subscribe(ctx, events.SaveCommitEventTopic, w.handleEvent)
+			err := w.eventBus.Subscribe(ctx, events.SaveCommitEventTopic, handler)
 			if err != nil {
 				log.Error("subscription error", zap.Error(err))
 			}
@@ -65,12 +90,16 @@ func (w *worker) Subscribe(ctx context.Context) error {
 	return nil
 }
 
-func (w *worker) handleEvent(msg []byte) error {
+func (w *worker) handleEvent(ctx context.Context, env eventbus.Envelope) error {
+	if env.SchemaVersion != events.SaveCommitEventVersion {
+		return w.failTask(ctx, env.CorrelationID, fmt.Errorf("unsupported save commit event schema version: %d", env.SchemaVersion))
+	}
+
 	var event events.SaveCommitEvent
-	if err := json.Unmarshal(msg, &event); err != nil {
-		return fmt.Errorf("failed to unmarshal save commit event: %w", err)
+	if err := env.Decode(&event); err != nil {
+		return w.failTask(ctx, env.CorrelationID, fmt.Errorf("failed to unmarshal save commit event: %w", err))
 	}
-	return w.handleSaveCommitEvent(context.Background(), event)
+	return w.handleSaveCommitEvent(ctx, event)
 }
 
 func (w *worker) handleSaveCommitEvent(ctx context.Context, event events.SaveCommitEvent) error {
@@ -82,9 +111,19 @@ func (w *worker) handleSaveCommitEvent(ctx context.Context, event events.SaveCom
 
 	log.Info("received save commit event")
 
+	cancelled, err := w.taskSvc.IsCancelled(ctx, event.TaskID)
+	if err != nil {
+		log.Error("failed to check task cancellation", zap.Error(err))
+		return fmt.Errorf("failed to check task cancellation: %w", err)
+	}
+	if cancelled {
+		log.Info("task has been cancelled, discarding save commit event")
+		return nil
+	}
+
 	if len(event.Commits) == 0 {
 		log.Info("no commits to save")
-		return nil
+		return w.recordBatchSaved(ctx, log, event)
 	}
 
 	batchLatestCommitTime := event.Commits[0].Date
@@ -102,6 +141,69 @@ func (w *worker) handleSaveCommitEvent(ctx context.Context, event events.SaveCom
 		return fmt.Errorf("failed to save commits: %w", err)
 	}
 
+	if err := w.recordBatchSaved(ctx, log, event); err != nil {
+		return err
+	}
+
 	log.Info("commits saved successfully")
 	return nil
 }
+
+// recordBatchSaved records the batch of the event as saved, which completes the
+// task once it is the last one
+func (w *worker) recordBatchSaved(ctx context.Context, log *zap.Logger, event events.SaveCommitEvent) error {
+	// events published before batches were tracked have no batch ID
+	if event.BatchID == 0 {
+		return nil
+	}
+
+	if err := w.taskSvc.RecordBatchSaved(ctx, event.TaskID, event.BatchID); err != nil {
+		log.Error("failed to record batch saved", zap.Int("batchID", event.BatchID), zap.Error(err))
+		return fmt.Errorf("failed to record batch saved: %w", err)
+	}
+	return nil
+}
+
+// recordBatchFailure records the error on the batch of a save commit event that
+// couldn't be saved. The event is still redelivered, and the batch is marked saved
+// if a later delivery succeeds.
+func (w *worker) recordBatchFailure(handler eventbus.Handler) eventbus.Handler {
+	return func(ctx context.Context, env eventbus.Envelope) error {
+		err := handler(ctx, env)
+		if err == nil {
+			return nil
+		}
+
+		var event events.SaveCommitEvent
+		if derr := env.Decode(&event); derr != nil || event.BatchID == 0 {
+			return err
+		}
+
+		if rerr := w.taskSvc.RecordBatchFailed(ctx, event.TaskID, event.BatchID, err.Error()); rerr != nil {
+			w.log.Error("failed to record batch failure",
+				zap.String("taskID", event.TaskID),
+				zap.Int("batchID", event.BatchID),
+				zap.Error(rerr),
+			)
+		}
+		return err
+	}
+}
+
+// failTask marks the task failed with the given error. The event is then treated
+// as handled, since delivering it again would fail the same way.
+func (w *worker) failTask(ctx context.Context, taskID string, err error) error {
+	log := w.log.With(zap.String("method", "failTask"), zap.String("taskID", taskID))
+	log.Error("failed to handle save commit event, failing task", zap.Error(err))
+
+	if taskID == "" {
+		return nil
+	}
+
+	if ferr := w.taskSvc.MarkFailed(ctx, taskID, err.Error()); ferr != nil && !errors.Is(ferr, dErrors.ErrInvalidTaskTransition) {
+		log.Error("failed to mark task failed", zap.Error(ferr))
+		return fmt.Errorf("failed to mark task failed: %w", ferr)
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS scheduler_states;
+DROP TABLE IF EXISTS leader_leases;
+DROP TABLE IF EXISTS repo_leases;
+DROP TABLE IF EXISTS processed_messages;
+DROP TABLE IF EXISTS task_attempts;
+DROP TABLE IF EXISTS task_checkpoints;
+DROP TABLE IF EXISTS batch_details;
+DROP TABLE IF EXISTS tasks;
+DROP TABLE IF EXISTS commits;
+DROP TABLE IF EXISTS repositories;
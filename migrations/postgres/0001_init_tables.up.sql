@@ -0,0 +1,159 @@
+-- the schema of the sqlite migrations up to 0015, as one migration
+CREATE TABLE IF NOT EXISTS repositories (
+    id TEXT PRIMARY KEY,
+    repo_id BIGINT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    description TEXT,
+    url TEXT NOT NULL,
+    language TEXT,
+    forks_count INTEGER NOT NULL,
+    stars_count INTEGER NOT NULL,
+    open_issues INTEGER NOT NULL,
+    watchers_count INTEGER NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    commit_tracking_start_time TIMESTAMPTZ,
+    last_fetched_at TIMESTAMPTZ,
+    last_fetched_commit_time TIMESTAMPTZ,
+    repo_created_at TIMESTAMPTZ NOT NULL,
+    repo_updated_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ,
+    schedule_cron TEXT NOT NULL DEFAULT '',
+    schedule_interval TEXT NOT NULL DEFAULT '',
+    schedule_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    schedule_adaptive BOOLEAN NOT NULL DEFAULT FALSE,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    effective_interval TEXT NOT NULL DEFAULT '',
+    interval_reason TEXT NOT NULL DEFAULT '',
+    idle_runs INTEGER NOT NULL DEFAULT 0,
+    quiet_windows JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_repositories_name ON repositories (name);
+CREATE INDEX IF NOT EXISTS idx_repositories_owner ON repositories (owner);
+
+
+CREATE TABLE IF NOT EXISTS commits (
+    id TEXT PRIMARY KEY,
+    sha TEXT UNIQUE NOT NULL,
+    repository_id TEXT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    repo_name TEXT NOT NULL,
+    repo_owner TEXT NOT NULL,
+    message TEXT NOT NULL,
+    author TEXT NOT NULL,
+    author_email TEXT NOT NULL,
+    date TIMESTAMPTZ NOT NULL,
+    url TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_commits_repo_name ON commits (repo_name);
+CREATE INDEX IF NOT EXISTS idx_repo_owner ON commits (repo_owner);
+CREATE INDEX IF NOT EXISTS idx_commits_date ON commits (date);
+CREATE INDEX IF NOT EXISTS idx_commits_repository_created_at ON commits (repository_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id TEXT PRIMARY KEY,
+    repository_id TEXT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    repo_name TEXT NOT NULL,
+    repo_owner TEXT NOT NULL,
+    status TEXT NOT NULL,
+    trigger_type TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    since TIMESTAMPTZ,
+    until TIMESTAMPTZ,
+    total_batches INTEGER,
+    attempt_count INTEGER NOT NULL DEFAULT 0,
+    retries INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ,
+    heartbeat_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    error_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks (status);
+CREATE INDEX IF NOT EXISTS idx_tasks_repository_status ON tasks (repository_id, status);
+CREATE INDEX IF NOT EXISTS idx_tasks_created_at ON tasks (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created_at ON tasks (status, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_repo_created_at ON tasks (repo_owner, repo_name, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_trigger_type_created_at ON tasks (trigger_type, created_at, id);
+
+
+CREATE TABLE IF NOT EXISTS batch_details (
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    batch_id INTEGER NOT NULL,
+    commit_count INTEGER NOT NULL,
+    oldest_commit_time TIMESTAMPTZ,
+    newest_commit_time TIMESTAMPTZ,
+    status TEXT NOT NULL,
+    error_message TEXT,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    saved_at TIMESTAMPTZ,
+    PRIMARY KEY (task_id, batch_id)
+);
+
+CREATE TABLE IF NOT EXISTS task_checkpoints (
+    task_id TEXT PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    page INTEGER NOT NULL,
+    until TIMESTAMPTZ NOT NULL,
+    oldest_commit_time TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_attempts (
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ,
+    retry_at TIMESTAMPTZ,
+    PRIMARY KEY (task_id, attempt)
+);
+
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_id TEXT NOT NULL,
+    consumer TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, consumer)
+);
+
+
+CREATE TABLE IF NOT EXISTS repo_leases (
+    repository_id TEXT PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    task_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS leader_leases (
+    name TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+
+CREATE TABLE IF NOT EXISTS scheduler_states (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    paused_at TIMESTAMPTZ,
+    run_requested_at TIMESTAMPTZ,
+    last_run_started_at TIMESTAMPTZ,
+    last_run_finished_at TIMESTAMPTZ,
+    next_run_at TIMESTAMPTZ,
+    last_dispatched JSONB NOT NULL DEFAULT '[]',
+    last_deferred INTEGER NOT NULL DEFAULT 0,
+    last_skipped INTEGER NOT NULL DEFAULT 0,
+    last_errors JSONB NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMPTZ
+);
+
+INSERT INTO scheduler_states (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
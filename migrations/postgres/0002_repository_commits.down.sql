@@ -0,0 +1,31 @@
+-- a commit shared by several repositories is kept for the first one it was
+-- linked to
+ALTER TABLE commits
+    ADD COLUMN repository_id TEXT REFERENCES repositories(id) ON DELETE CASCADE,
+    ADD COLUMN repo_name TEXT,
+    ADD COLUMN repo_owner TEXT,
+    ADD COLUMN url TEXT;
+
+UPDATE commits c
+SET repository_id = l.repository_id, repo_name = l.name, repo_owner = l.owner, url = l.url
+FROM (
+    SELECT DISTINCT ON (rc.sha) rc.sha, rc.repository_id, r.name, r.owner, rc.url
+    FROM repository_commits rc
+    JOIN repositories r ON r.id = rc.repository_id
+    ORDER BY rc.sha, rc.created_at
+) l
+WHERE l.sha = c.sha;
+
+DELETE FROM commits WHERE repository_id IS NULL;
+
+ALTER TABLE commits
+    ALTER COLUMN repository_id SET NOT NULL,
+    ALTER COLUMN repo_name SET NOT NULL,
+    ALTER COLUMN repo_owner SET NOT NULL,
+    ALTER COLUMN url SET NOT NULL;
+
+DROP TABLE IF EXISTS repository_commits;
+
+CREATE INDEX IF NOT EXISTS idx_commits_repo_name ON commits (repo_name);
+CREATE INDEX IF NOT EXISTS idx_repo_owner ON commits (repo_owner);
+CREATE INDEX IF NOT EXISTS idx_commits_repository_created_at ON commits (repository_id, created_at);
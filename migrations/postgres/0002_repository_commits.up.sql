@@ -0,0 +1,21 @@
+-- commits are stored once and linked to every repository they were fetched for,
+-- e.g. a fork and its upstream
+CREATE TABLE IF NOT EXISTS repository_commits (
+    repository_id TEXT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    sha TEXT NOT NULL REFERENCES commits(sha) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (repository_id, sha)
+);
+
+INSERT INTO repository_commits (repository_id, sha, url, created_at)
+SELECT repository_id, sha, url, created_at FROM commits;
+
+CREATE INDEX IF NOT EXISTS idx_repository_commits_sha ON repository_commits (sha);
+CREATE INDEX IF NOT EXISTS idx_repository_commits_created_at ON repository_commits (repository_id, created_at);
+
+ALTER TABLE commits
+    DROP COLUMN repository_id,
+    DROP COLUMN repo_name,
+    DROP COLUMN repo_owner,
+    DROP COLUMN url;
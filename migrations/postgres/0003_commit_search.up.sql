@@ -0,0 +1,4 @@
+-- full-text index of commit messages, stemmed like the SQLite index
+ALTER TABLE commits ADD COLUMN message_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', message)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_commits_message_tsv ON commits USING GIN (message_tsv);
@@ -0,0 +1,4 @@
+-- commits and repositories are paged by a time and their id, which breaks ties
+DROP INDEX IF EXISTS idx_commits_date;
+CREATE INDEX IF NOT EXISTS idx_commits_date ON commits (date, id);
+CREATE INDEX IF NOT EXISTS idx_repositories_created_at ON repositories (created_at, id);
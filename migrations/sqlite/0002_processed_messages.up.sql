@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_id TEXT NOT NULL,
+    consumer TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, consumer)
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_status;
+
+ALTER TABLE tasks DROP COLUMN attempt_count;
+ALTER TABLE tasks DROP COLUMN finished_at;
+ALTER TABLE tasks DROP COLUMN started_at;
@@ -0,0 +1,5 @@
+ALTER TABLE tasks ADD COLUMN started_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN finished_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN attempt_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks (status);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS batch_details;
+
+ALTER TABLE tasks DROP COLUMN total_batches;
+ALTER TABLE tasks DROP COLUMN until;
+ALTER TABLE tasks DROP COLUMN since;
@@ -0,0 +1,16 @@
+ALTER TABLE tasks ADD COLUMN since TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN until TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN total_batches INTEGER;
+
+CREATE TABLE IF NOT EXISTS batch_details (
+    task_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    batch_id INTEGER NOT NULL,
+    commit_count INTEGER NOT NULL,
+    oldest_commit_time TIMESTAMP,
+    newest_commit_time TIMESTAMP,
+    status TEXT NOT NULL,
+    error_message TEXT,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    saved_at TIMESTAMP,
+    PRIMARY KEY (task_id, batch_id)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS task_checkpoints (
+    task_id TEXT PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    page INTEGER NOT NULL,
+    until TIMESTAMP NOT NULL,
+    oldest_commit_time TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
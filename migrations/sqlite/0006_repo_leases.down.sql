@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tasks_repository_status;
+
+DROP TABLE IF EXISTS repo_leases;
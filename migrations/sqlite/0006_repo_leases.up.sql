@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS repo_leases (
+    repository_id TEXT PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    task_id TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_repository_status ON tasks (repository_id, status);
@@ -0,0 +1 @@
+ALTER TABLE tasks ADD COLUMN heartbeat_at TIMESTAMP;
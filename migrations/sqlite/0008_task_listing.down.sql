@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_tasks_trigger_type_created_at;
+DROP INDEX IF EXISTS idx_tasks_repo_created_at;
+DROP INDEX IF EXISTS idx_tasks_status_created_at;
+DROP INDEX IF EXISTS idx_tasks_created_at;
+
+ALTER TABLE tasks DROP COLUMN trigger_type;
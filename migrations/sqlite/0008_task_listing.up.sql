@@ -0,0 +1,6 @@
+ALTER TABLE tasks ADD COLUMN trigger_type TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created_at ON tasks (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created_at ON tasks (status, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_repo_created_at ON tasks (repo_owner, repo_name, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_trigger_type_created_at ON tasks (trigger_type, created_at, id);
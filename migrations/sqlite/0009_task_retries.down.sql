@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS task_attempts;
+
+ALTER TABLE tasks DROP COLUMN retries;
@@ -0,0 +1,4 @@
+ALTER TABLE repositories DROP COLUMN next_run_at;
+ALTER TABLE repositories DROP COLUMN schedule_enabled;
+ALTER TABLE repositories DROP COLUMN schedule_interval;
+ALTER TABLE repositories DROP COLUMN schedule_cron;
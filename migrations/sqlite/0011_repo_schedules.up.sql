@@ -0,0 +1,4 @@
+ALTER TABLE repositories ADD COLUMN schedule_cron TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN schedule_interval TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN schedule_enabled INTEGER NOT NULL DEFAULT 1; -- 0 = false, 1 = true
+ALTER TABLE repositories ADD COLUMN next_run_at TIMESTAMP;
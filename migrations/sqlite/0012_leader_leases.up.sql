@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS leader_leases (
+    name TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_commits_repository_created_at;
+
+ALTER TABLE repositories DROP COLUMN idle_runs;
+ALTER TABLE repositories DROP COLUMN interval_reason;
+ALTER TABLE repositories DROP COLUMN effective_interval;
+ALTER TABLE repositories DROP COLUMN last_run_at;
+ALTER TABLE repositories DROP COLUMN schedule_adaptive;
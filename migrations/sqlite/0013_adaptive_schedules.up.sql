@@ -0,0 +1,7 @@
+ALTER TABLE repositories ADD COLUMN schedule_adaptive INTEGER NOT NULL DEFAULT 0; -- 0 = false, 1 = true
+ALTER TABLE repositories ADD COLUMN last_run_at TIMESTAMP;
+ALTER TABLE repositories ADD COLUMN effective_interval TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN interval_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN idle_runs INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_commits_repository_created_at ON commits (repository_id, created_at);
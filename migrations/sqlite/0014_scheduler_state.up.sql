@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS scheduler_states (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    paused INTEGER NOT NULL DEFAULT 0, -- 0 = false, 1 = true
+    paused_at TIMESTAMP,
+    run_requested_at TIMESTAMP,
+    last_run_started_at TIMESTAMP,
+    last_run_finished_at TIMESTAMP,
+    next_run_at TIMESTAMP,
+    last_dispatched TEXT NOT NULL DEFAULT '[]',
+    last_deferred INTEGER NOT NULL DEFAULT 0,
+    last_errors TEXT NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP
+);
+
+INSERT INTO scheduler_states (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE scheduler_states DROP COLUMN last_skipped;
+ALTER TABLE repositories DROP COLUMN quiet_windows;
@@ -0,0 +1,2 @@
+ALTER TABLE repositories ADD COLUMN quiet_windows TEXT; -- json list, null when the repository has none
+ALTER TABLE scheduler_states ADD COLUMN last_skipped INTEGER NOT NULL DEFAULT 0;
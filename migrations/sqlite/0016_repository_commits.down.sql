@@ -0,0 +1,32 @@
+-- a commit shared by several repositories is kept for the first one it was
+-- linked to
+CREATE TABLE commits_old (
+    id TEXT PRIMARY KEY,
+    sha TEXT UNIQUE NOT NULL,
+    repository_id TEXT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    repo_name TEXT NOT NULL,
+    repo_owner TEXT NOT NULL,
+    message TEXT NOT NULL,
+    author TEXT NOT NULL,
+    author_email TEXT NOT NULL,
+    date TIMESTAMP NOT NULL,
+    url TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+INSERT INTO commits_old (id, sha, repository_id, repo_name, repo_owner, message, author, author_email, date, url, created_at, updated_at)
+SELECT c.id, c.sha, rc.repository_id, r.name, r.owner, c.message, c.author, c.author_email, c.date, rc.url, rc.created_at, c.updated_at
+FROM commits c
+JOIN repository_commits rc ON rc.sha = c.sha
+JOIN repositories r ON r.id = rc.repository_id
+WHERE rc.rowid = (SELECT MIN(rowid) FROM repository_commits WHERE sha = c.sha);
+
+DROP TABLE repository_commits;
+DROP TABLE commits;
+ALTER TABLE commits_old RENAME TO commits;
+
+CREATE INDEX IF NOT EXISTS idx_commits_repo_name ON commits (repo_name);
+CREATE INDEX IF NOT EXISTS idx_repo_owner ON commits (repo_owner);
+CREATE INDEX IF NOT EXISTS idx_commits_date ON commits (date);
+CREATE INDEX IF NOT EXISTS idx_commits_repository_created_at ON commits (repository_id, created_at);
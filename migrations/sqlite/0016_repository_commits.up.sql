@@ -0,0 +1,35 @@
+-- commits are stored once and linked to every repository they were fetched for,
+-- e.g. a fork and its upstream. SQLite can't drop columns referencing another
+-- table, so the table is rebuilt.
+ALTER TABLE commits RENAME TO commits_old;
+
+CREATE TABLE commits (
+    id TEXT PRIMARY KEY,
+    sha TEXT UNIQUE NOT NULL,
+    message TEXT NOT NULL,
+    author TEXT NOT NULL,
+    author_email TEXT NOT NULL,
+    date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+INSERT INTO commits (id, sha, message, author, author_email, date, created_at, updated_at)
+SELECT id, sha, message, author, author_email, date, created_at, updated_at FROM commits_old;
+
+CREATE TABLE IF NOT EXISTS repository_commits (
+    repository_id TEXT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    sha TEXT NOT NULL REFERENCES commits(sha) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (repository_id, sha)
+);
+
+INSERT INTO repository_commits (repository_id, sha, url, created_at)
+SELECT repository_id, sha, url, created_at FROM commits_old;
+
+DROP TABLE commits_old;
+
+CREATE INDEX IF NOT EXISTS idx_commits_date ON commits (date);
+CREATE INDEX IF NOT EXISTS idx_repository_commits_sha ON repository_commits (sha);
+CREATE INDEX IF NOT EXISTS idx_repository_commits_created_at ON repository_commits (repository_id, created_at);
@@ -0,0 +1,24 @@
+-- full-text index of commit messages. It reads the messages from the commits
+-- table by rowid, so a migration rebuilding the commits table must rebuild it
+-- too, with INSERT INTO commits_fts(commits_fts) VALUES ('rebuild').
+CREATE VIRTUAL TABLE IF NOT EXISTS commits_fts USING fts5(
+    message,
+    content = 'commits',
+    content_rowid = 'rowid',
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_insert AFTER INSERT ON commits BEGIN
+    INSERT INTO commits_fts (rowid, message) VALUES (new.rowid, new.message);
+END;
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_delete AFTER DELETE ON commits BEGIN
+    INSERT INTO commits_fts (commits_fts, rowid, message) VALUES ('delete', old.rowid, old.message);
+END;
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_update AFTER UPDATE OF message ON commits BEGIN
+    INSERT INTO commits_fts (commits_fts, rowid, message) VALUES ('delete', old.rowid, old.message);
+    INSERT INTO commits_fts (rowid, message) VALUES (new.rowid, new.message);
+END;
+
+INSERT INTO commits_fts (commits_fts) VALUES ('rebuild');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_repositories_created_at;
+DROP INDEX IF EXISTS idx_commits_date;
+CREATE INDEX IF NOT EXISTS idx_commits_date ON commits (date);
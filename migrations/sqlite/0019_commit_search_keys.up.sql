@@ -0,0 +1,39 @@
+-- the full-text index of commit messages read the messages from the commits
+-- table by its implicit rowid, which VACUUM and rebuilding the table renumber.
+-- The index now keeps its own copy of the messages, keyed by a stable integer
+-- id given to every commit.
+DROP TRIGGER IF EXISTS commits_fts_update;
+DROP TRIGGER IF EXISTS commits_fts_delete;
+DROP TRIGGER IF EXISTS commits_fts_insert;
+DROP TABLE IF EXISTS commits_fts;
+
+CREATE TABLE IF NOT EXISTS commit_search_keys (
+    id INTEGER PRIMARY KEY,
+    commit_id TEXT NOT NULL UNIQUE
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS commits_fts USING fts5(
+    message,
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_insert AFTER INSERT ON commits BEGIN
+    INSERT INTO commit_search_keys (commit_id) VALUES (new.id);
+    INSERT INTO commits_fts (rowid, message)
+    SELECT id, new.message FROM commit_search_keys WHERE commit_id = new.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_delete AFTER DELETE ON commits BEGIN
+    DELETE FROM commits_fts WHERE rowid = (SELECT id FROM commit_search_keys WHERE commit_id = old.id);
+    DELETE FROM commit_search_keys WHERE commit_id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS commits_fts_update AFTER UPDATE OF message ON commits BEGIN
+    UPDATE commits_fts SET message = new.message
+    WHERE rowid = (SELECT id FROM commit_search_keys WHERE commit_id = new.id);
+END;
+
+INSERT INTO commit_search_keys (commit_id) SELECT id FROM commits;
+INSERT INTO commits_fts (rowid, message)
+SELECT commit_search_keys.id, commits.message
+FROM commit_search_keys JOIN commits ON commits.id = commit_search_keys.commit_id;
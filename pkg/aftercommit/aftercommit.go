@@ -0,0 +1,63 @@
+// Package aftercommit holds side effects back, such as publishing an event,
+// until the database transaction they follow from has committed, since rolling
+// the transaction back can't undo them.
+package aftercommit
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type (
+	// Func is a side effect, run with the context given to Hooks.Run
+	Func func(ctx context.Context) error
+
+	// Hooks collects the side effects deferred within a transaction
+	Hooks struct {
+		mu  sync.Mutex
+		fns []Func
+	}
+
+	hooksKey struct{}
+)
+
+// WithHooks returns a context collecting the side effects deferred with Do, to
+// be run once the transaction using it has committed, or dropped if it rolls back
+func WithHooks(ctx context.Context) (context.Context, *Hooks) {
+	hooks := &Hooks{}
+	return context.WithValue(ctx, hooksKey{}, hooks), hooks
+}
+
+// Do defers fn to the hooks collected by ctx, or runs it straight away, with
+// ctx, when ctx collects none. The error of a deferred fn is returned by Run
+// instead.
+func Do(ctx context.Context, fn Func) error {
+	hooks, ok := ctx.Value(hooksKey{}).(*Hooks)
+	if !ok {
+		return fn(ctx)
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+	return nil
+}
+
+// Run runs the deferred side effects in the order they were deferred, each of
+// them even if an earlier one failed. ctx must not carry the committed
+// transaction, as the side effects may read from the database.
+func (h *Hooks) Run(ctx context.Context) error {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	var errs []error
+	for _, fn := range fns {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
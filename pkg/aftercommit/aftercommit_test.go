@@ -0,0 +1,46 @@
+package aftercommit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/victor-nach/git-monitor/pkg/aftercommit"
+)
+
+func TestDo_RunsStraightAwayWithoutHooks(t *testing.T) {
+	ran := false
+	err := aftercommit.Do(context.Background(), func(context.Context) error {
+		ran = true
+		return errors.New("publish failed")
+	})
+
+	assert.True(t, ran)
+	assert.EqualError(t, err, "publish failed")
+}
+
+func TestHooks_Run(t *testing.T) {
+	ctx, hooks := aftercommit.WithHooks(context.Background())
+
+	var order []int
+	for i := 1; i <= 3; i++ {
+		err := aftercommit.Do(ctx, func(context.Context) error {
+			order = append(order, i)
+			if i == 2 {
+				return errors.New("publish failed")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, order, "side effects should wait for the hooks to run")
+
+	// a failed side effect doesn't stop the next ones
+	assert.EqualError(t, hooks.Run(context.Background()), "publish failed")
+	assert.Equal(t, []int{1, 2, 3}, order)
+
+	// side effects run once
+	assert.NoError(t, hooks.Run(context.Background()))
+	assert.Equal(t, []int{1, 2, 3}, order)
+}
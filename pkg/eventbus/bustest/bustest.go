@@ -0,0 +1,439 @@
+// Package bustest is a conformance suite for eventbus.EventBus implementations.
+//
+// Every adapter must pass Run before it can be used by the app, e.g.
+//
+//	func TestMyEventBus(t *testing.T) {
+//		bustest.Run(t, func(t *testing.T) eventbus.EventBus {
+//			return newMyEventBus(t)
+//		})
+//	}
+//
+// The bus returned by the factory must redeliver a failed message at least
+// three times, with a backoff short enough to fit in the suite timeout.
+package bustest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+)
+
+const (
+	// timeout bounds the wait for any expected delivery
+	timeout = 10 * time.Second
+	// settle is how long the suite waits to make sure nothing else is delivered
+	settle = 300 * time.Millisecond
+)
+
+// Factory returns a new, connected bus. The suite closes it when the test ends.
+type Factory func(t *testing.T) eventbus.EventBus
+
+// Run runs the conformance suite against the buses created by newBus
+func Run(t *testing.T, newBus Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, bus eventbus.EventBus)
+	}{
+		{"PublishSubscribe", testPublishSubscribe},
+		{"NilHandler", testNilHandler},
+		{"CompetingConsumers", testCompetingConsumers},
+		{"RedeliveryOnError", testRedeliveryOnError},
+		{"Ordering", testOrdering},
+		{"Priority", testPriority},
+		{"DelayedDelivery", testDelayedDelivery},
+		{"PublishAtPast", testPublishAtPast},
+		{"ShutdownDraining", testShutdownDraining},
+		{"PublishContextCancelled", testPublishContextCancelled},
+		{"SubscribeContextCancelled", testSubscribeContextCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := newBus(t)
+			t.Cleanup(func() { bus.Close() })
+
+			tt.fn(t, bus)
+		})
+	}
+}
+
+// testPublishSubscribe checks that a published message reaches a subscriber with its envelope intact
+func testPublishSubscribe(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	received := make(chan eventbus.Envelope, 1)
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		received <- env
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = bus.Publish(ctx, topic, map[string]string{"hello": "world"},
+		eventbus.WithCorrelationID("task-1"),
+		eventbus.WithSchemaVersion(2),
+		eventbus.WithHeader("traceparent", "00-abc-def-01"),
+	)
+	require.NoError(t, err)
+
+	select {
+	case env := <-received:
+		assert.NotEmpty(t, env.ID)
+		assert.Equal(t, topic, env.Topic)
+		assert.Equal(t, 2, env.SchemaVersion)
+		assert.Equal(t, "task-1", env.CorrelationID)
+		assert.Equal(t, "00-abc-def-01", env.Header("traceparent"))
+		assert.False(t, env.ProducedAt.IsZero())
+		assert.JSONEq(t, `{"hello":"world"}`, string(env.Payload))
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func testNilHandler(t *testing.T, bus eventbus.EventBus) {
+	assert.Error(t, bus.Subscribe(context.Background(), newTopic(t), nil))
+}
+
+// testCompetingConsumers checks that subscribers of a topic share its messages,
+// each message being handled by exactly one of them
+func testCompetingConsumers(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const (
+		subscribers = 3
+		total       = 30
+	)
+
+	topic := newTopic(t)
+
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string]int)
+		count int32
+	)
+	done := make(chan struct{})
+
+	for i := 0; i < subscribers; i++ {
+		err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+			mu.Lock()
+			seen[string(env.Payload)]++
+			mu.Unlock()
+			if atomic.AddInt32(&count, 1) == total {
+				close(done)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < total; i++ {
+		require.NoError(t, bus.Publish(ctx, topic, fmt.Sprintf("msg-%d", i)))
+	}
+
+	wait(t, done, "messages")
+	time.Sleep(settle)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, seen, total)
+	for msg, n := range seen {
+		assert.Equal(t, 1, n, "message %s should be handled by exactly one subscriber", msg)
+	}
+}
+
+// testRedeliveryOnError checks that a message is redelivered until its handler succeeds
+func testRedeliveryOnError(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	var (
+		mu  sync.Mutex
+		ids []string
+	)
+	done := make(chan struct{})
+
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, env.ID)
+		if len(ids) < 3 {
+			return errors.New("transient failure")
+		}
+		if len(ids) == 3 {
+			close(done)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, topic, "payload"))
+
+	wait(t, done, "redelivery")
+	time.Sleep(settle)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, ids, 3, "message should not be delivered again once handled")
+	assert.Equal(t, ids[0], ids[1], "redelivery should carry the same envelope")
+	assert.Equal(t, ids[0], ids[2], "redelivery should carry the same envelope")
+}
+
+// testOrdering checks that a single subscriber receives messages in publish order
+func testOrdering(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const total = 50
+
+	topic := newTopic(t)
+
+	received := make(chan string, total)
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		var msg string
+		if err := env.Decode(&msg); err != nil {
+			return err
+		}
+		received <- msg
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		require.NoError(t, bus.Publish(ctx, topic, fmt.Sprintf("msg-%d", i)))
+	}
+
+	for i := 0; i < total; i++ {
+		select {
+		case msg := <-received:
+			require.Equal(t, fmt.Sprintf("msg-%d", i), msg, "messages should be delivered in publish order")
+		case <-time.After(timeout):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+}
+
+// testPriority checks that queued messages are delivered highest priority first,
+// and in publish order within a priority
+func testPriority(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	// the messages are all queued before anyone subscribes
+	require.NoError(t, bus.Publish(ctx, topic, "low-1"))
+	require.NoError(t, bus.Publish(ctx, topic, "low-2"))
+	require.NoError(t, bus.Publish(ctx, topic, "mid", eventbus.WithPriority(1)))
+	require.NoError(t, bus.Publish(ctx, topic, "high", eventbus.WithPriority(eventbus.MaxPriority)))
+
+	want := []string{"high", "mid", "low-1", "low-2"}
+
+	received := make(chan string, len(want))
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		var msg string
+		if err := env.Decode(&msg); err != nil {
+			return err
+		}
+		received <- msg
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i, msg := range want {
+		select {
+		case got := <-received:
+			require.Equal(t, msg, got, "messages should be delivered by priority")
+		case <-time.After(timeout):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+}
+
+// testDelayedDelivery checks that a delayed message isn't delivered before it is
+// due and doesn't hold back the messages published after it
+func testDelayedDelivery(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const delay = time.Second
+
+	topic := newTopic(t)
+
+	type receipt struct {
+		msg string
+		at  time.Time
+	}
+	received := make(chan receipt, 2)
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		var msg string
+		if err := env.Decode(&msg); err != nil {
+			return err
+		}
+		received <- receipt{msg: msg, at: time.Now()}
+		return nil
+	})
+	require.NoError(t, err)
+
+	publishedAt := time.Now()
+	require.NoError(t, bus.PublishAfter(ctx, topic, "delayed", delay))
+	require.NoError(t, bus.Publish(ctx, topic, "immediate"))
+
+	var got []receipt
+	for len(got) < 2 {
+		select {
+		case r := <-received:
+			got = append(got, r)
+		case <-time.After(timeout):
+			t.Fatalf("timed out waiting for messages, received %d", len(got))
+		}
+	}
+
+	assert.Equal(t, "immediate", got[0].msg, "a delayed message should not block later messages")
+	assert.Equal(t, "delayed", got[1].msg)
+	assert.GreaterOrEqual(t, got[1].at.Sub(publishedAt), delay, "delayed message delivered early")
+}
+
+// testPublishAtPast checks that a message scheduled in the past is delivered right away
+func testPublishAtPast(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	received := make(chan struct{}, 1)
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		received <- struct{}{}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.PublishAt(ctx, topic, "payload", time.Now().Add(-time.Minute)))
+
+	wait(t, received, "message")
+}
+
+// testShutdownDraining checks that Close waits for in-flight handlers and that
+// the bus rejects messages afterwards
+func testShutdownDraining(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	started := make(chan struct{})
+	var finished int32
+
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		close(started)
+		time.Sleep(settle)
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, topic, "payload"))
+
+	wait(t, started, "handler to start")
+
+	require.NoError(t, bus.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished), "close should wait for in-flight handlers")
+
+	assert.Error(t, bus.Publish(ctx, topic, "after close"), "publish should fail once the bus is closed")
+}
+
+// testPublishContextCancelled checks that publishing with a done context fails
+// without delivering the message
+func testPublishContextCancelled(t *testing.T, bus eventbus.EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := newTopic(t)
+
+	var count int32
+	err := bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	require.NoError(t, err)
+
+	cancelled, cancelPublish := context.WithCancel(context.Background())
+	cancelPublish()
+
+	assert.ErrorIs(t, bus.Publish(cancelled, topic, "payload"), context.Canceled)
+
+	time.Sleep(settle)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+}
+
+// testSubscribeContextCancelled checks that a subscriber stops receiving messages
+// once its context is done, leaving them to the remaining subscribers
+func testSubscribeContextCancelled(t *testing.T, bus eventbus.EventBus) {
+	const total = 5
+
+	topic := newTopic(t)
+
+	var stopped int32
+	stoppedCtx, stop := context.WithCancel(context.Background())
+	err := bus.Subscribe(stoppedCtx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		atomic.AddInt32(&stopped, 1)
+		return nil
+	})
+	require.NoError(t, err)
+
+	stop()
+	time.Sleep(settle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var active int32
+	done := make(chan struct{})
+	err = bus.Subscribe(ctx, topic, func(ctx context.Context, env eventbus.Envelope) error {
+		if atomic.AddInt32(&active, 1) == total {
+			close(done)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < total; i++ {
+		require.NoError(t, bus.Publish(ctx, topic, fmt.Sprintf("msg-%d", i)))
+	}
+
+	wait(t, done, "messages")
+	time.Sleep(settle)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&stopped), "cancelled subscriber should not receive messages")
+	assert.Equal(t, int32(total), atomic.LoadInt32(&active))
+}
+
+// newTopic returns a topic unique to the test, so that durable brokers don't
+// carry messages over from earlier runs
+func newTopic(t *testing.T) string {
+	name := strings.ToLower(t.Name()[strings.LastIndex(t.Name(), "/")+1:])
+	return fmt.Sprintf("bustest_%s_%d", name, time.Now().UnixNano())
+}
+
+func wait(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
@@ -0,0 +1,147 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultSchemaVersion is used for messages published without an explicit schema version
+const DefaultSchemaVersion = 1
+
+// MaxPriority is the highest message priority. Subscribers handle the queued
+// messages of a topic with the highest priority first, and messages of the same
+// priority in publish order. Messages published without a priority have the
+// lowest one, 0.
+const MaxPriority = 3
+
+type (
+	// Envelope wraps every message travelling through an event bus with the metadata
+	// needed to identify, trace and version it independently of its payload.
+	Envelope struct {
+		ID            string            `json:"id"`
+		Topic         string            `json:"topic"`
+		SchemaVersion int               `json:"schema_version"`
+		ProducedAt    time.Time         `json:"produced_at"`
+		CorrelationID string            `json:"correlation_id,omitempty"`
+		Priority      int               `json:"priority,omitempty"`
+		Headers       map[string]string `json:"headers,omitempty"`
+		Payload       json.RawMessage   `json:"payload"`
+	}
+
+	// Handler processes a single envelope delivered by an event bus
+	Handler func(ctx context.Context, env Envelope) error
+
+	// PublishOption customises the envelope built for a published message
+	PublishOption func(*Envelope)
+)
+
+type envelopeKey struct{}
+
+// WithCorrelationID ties the message to the task or request that originated it
+func WithCorrelationID(id string) PublishOption {
+	return func(e *Envelope) {
+		e.CorrelationID = id
+	}
+}
+
+// WithSchemaVersion sets the version of the payload schema
+func WithSchemaVersion(version int) PublishOption {
+	return func(e *Envelope) {
+		e.SchemaVersion = version
+	}
+}
+
+// WithPriority sets the priority of the message, from 0 to MaxPriority. Values
+// out of range are clamped.
+func WithPriority(priority int) PublishOption {
+	return func(e *Envelope) {
+		e.Priority = min(max(priority, 0), MaxPriority)
+	}
+}
+
+// WithHeader sets an arbitrary header, e.g. trace context
+func WithHeader(key, value string) PublishOption {
+	return func(e *Envelope) {
+		if e.Headers == nil {
+			e.Headers = make(map[string]string)
+		}
+		e.Headers[key] = value
+	}
+}
+
+// NewEnvelope wraps a message for the given topic. When ctx carries the envelope
+// currently being handled, its correlation ID, priority and headers are inherited
+// so that follow-up messages stay linked to, and as urgent as, the message that
+// caused them.
+func NewEnvelope(ctx context.Context, topic string, message interface{}, opts ...PublishOption) (Envelope, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal message payload: %w", err)
+	}
+
+	env := Envelope{
+		ID:            uuid.NewString(),
+		Topic:         topic,
+		SchemaVersion: DefaultSchemaVersion,
+		ProducedAt:    time.Now().UTC(),
+		Payload:       payload,
+	}
+
+	if parent, ok := EnvelopeFromContext(ctx); ok {
+		env.CorrelationID = parent.CorrelationID
+		env.Priority = parent.Priority
+		for k, v := range parent.Headers {
+			WithHeader(k, v)(&env)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(&env)
+	}
+
+	return env, nil
+}
+
+// Decode unmarshals the envelope payload into v
+func (e Envelope) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode %s payload: %w", e.Topic, err)
+	}
+	return nil
+}
+
+// Header returns the value of a header, or an empty string if it isn't set
+func (e Envelope) Header(key string) string {
+	return e.Headers[key]
+}
+
+// ContextWithEnvelope returns a copy of ctx carrying the envelope being handled
+func ContextWithEnvelope(ctx context.Context, env Envelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, env)
+}
+
+// EnvelopeFromContext returns the envelope being handled, if any
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return env, ok
+}
+
+func encodeEnvelope(env Envelope) ([]byte, error) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	return body, nil
+}
+
+func decodeEnvelope(body []byte) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return Envelope{}, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+	return env, nil
+}
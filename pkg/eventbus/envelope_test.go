@@ -0,0 +1,73 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	env, err := NewEnvelope(context.Background(), "topic", map[string]int{"count": 2},
+		WithCorrelationID("task-1"),
+		WithSchemaVersion(3),
+		WithHeader("traceparent", "00-abc-def-01"),
+	)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, env.ID)
+	assert.Equal(t, "topic", env.Topic)
+	assert.Equal(t, 3, env.SchemaVersion)
+	assert.Equal(t, "task-1", env.CorrelationID)
+	assert.Equal(t, "00-abc-def-01", env.Header("traceparent"))
+	assert.False(t, env.ProducedAt.IsZero())
+
+	var payload map[string]int
+	require.NoError(t, env.Decode(&payload))
+	assert.Equal(t, 2, payload["count"])
+}
+
+func TestNewEnvelope_InheritsFromContext(t *testing.T) {
+	parent, err := NewEnvelope(context.Background(), "parent", "payload",
+		WithCorrelationID("task-1"),
+		WithHeader("traceparent", "00-abc-def-01"),
+		WithPriority(2),
+	)
+	require.NoError(t, err)
+
+	ctx := ContextWithEnvelope(context.Background(), parent)
+
+	child, err := NewEnvelope(ctx, "child", "payload", WithHeader("source", "fetcher"))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, parent.ID, child.ID)
+	assert.Equal(t, "task-1", child.CorrelationID)
+	assert.Equal(t, 2, child.Priority)
+	assert.Equal(t, "00-abc-def-01", child.Header("traceparent"))
+	assert.Equal(t, "fetcher", child.Header("source"))
+	assert.Empty(t, parent.Header("source"), "child headers must not leak into the parent")
+}
+
+func TestEnvelopeCodec(t *testing.T) {
+	env, err := NewEnvelope(context.Background(), "topic", "payload", WithCorrelationID("task-1"))
+	require.NoError(t, err)
+
+	body, err := encodeEnvelope(env)
+	require.NoError(t, err)
+
+	decoded, err := decodeEnvelope(body)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, decoded.ID)
+	assert.Equal(t, env.CorrelationID, decoded.CorrelationID)
+	assert.True(t, env.ProducedAt.Equal(decoded.ProducedAt))
+	assert.JSONEq(t, string(env.Payload), string(decoded.Payload))
+}
+
+func TestWithPriority(t *testing.T) {
+	for priority, want := range map[int]int{-1: 0, 0: 0, 2: 2, MaxPriority + 1: MaxPriority} {
+		env, err := NewEnvelope(context.Background(), "topic", "payload", WithPriority(priority))
+		require.NoError(t, err)
+		assert.Equal(t, want, env.Priority, "priority %d", priority)
+	}
+}
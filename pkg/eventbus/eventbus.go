@@ -0,0 +1,18 @@
+package eventbus
+
+import (
+	"context"
+	"time"
+)
+
+// EventBus is the publish/subscribe contract implemented by every bus in this package
+type EventBus interface {
+	Publish(ctx context.Context, topic string, message interface{}, opts ...PublishOption) error
+	// PublishAt publishes a message that isn't delivered before the given time.
+	// A time in the past delivers the message right away.
+	PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...PublishOption) error
+	// PublishAfter publishes a message that isn't delivered until delay has elapsed
+	PublishAfter(ctx context.Context, topic string, message interface{}, delay time.Duration, opts ...PublishOption) error
+	Subscribe(ctx context.Context, topic string, handler Handler) error
+	Close() error
+}
@@ -0,0 +1,638 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+const (
+	// deliverAtHeader holds the time a delayed message becomes due, in RFC 3339 format
+	deliverAtHeader = "Git-Monitor-Deliver-At"
+	// fetchRetryDelay is how long a subscriber waits after failing to fetch a message
+	fetchRetryDelay = time.Second
+)
+
+type (
+	JetStreamConfig struct {
+		// ConsumerPrefix is prepended to the durable consumer names of every topic.
+		ConsumerPrefix string
+		// MaxDeliver is the maximum number of times a message is delivered before it is dropped.
+		MaxDeliver int
+		// BackOff holds the redelivery delays applied after each failed delivery.
+		BackOff []time.Duration
+		// MaxAckPending caps the number of unacknowledged messages per consumer.
+		// Messages published for later are held back with a delayed nak and stay
+		// unacknowledged until they are due, so a cap has to leave room for all of
+		// them or they stall the consumer. -1, the default, doesn't cap.
+		MaxAckPending int
+		// AckWait is how long the server waits for a message to be acknowledged
+		// before redelivering it. It is extended while the handler is running.
+		AckWait time.Duration
+		// PullExpiry is how long the pull requests of an idle subscriber wait for
+		// a message before they are renewed. It must be at least a second.
+		PullExpiry time.Duration
+	}
+
+	// JetStreamEventBus backs every topic with a work queue stream. Messages are
+	// published on one subject per priority, each read by its own durable pull
+	// consumer, and subscribers pull from the highest priority consumer holding a
+	// message, so that every message is handled once and by priority.
+	JetStreamEventBus struct {
+		conn *nats.Conn
+		js   jetstream.JetStream
+		log  *zap.Logger
+		cfg  JetStreamConfig
+
+		closed    chan struct{}
+		stopping  chan struct{}
+		closeOnce sync.Once
+		wg        sync.WaitGroup
+
+		mu        sync.Mutex
+		consumers map[string][]jetstream.Consumer // topic -> consumers, highest priority first
+
+		streamsMu sync.Mutex
+		streams   map[string]bool // topics whose stream is known to be set up
+	}
+)
+
+func NewJetStreamEventBus(ctx context.Context, url string, log *zap.Logger, opts ...func(*JetStreamConfig)) (*JetStreamEventBus, error) {
+	cfg := JetStreamConfig{
+		ConsumerPrefix: "git-monitor",
+		MaxDeliver:     5,
+		BackOff:        []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, time.Minute},
+		MaxAckPending:  -1,
+		AckWait:        30 * time.Second,
+		PullExpiry:     30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.MaxDeliver <= len(cfg.BackOff) {
+		return nil, fmt.Errorf("max deliver (%d) must be greater than the number of backoff steps (%d)", cfg.MaxDeliver, len(cfg.BackOff))
+	}
+	if cfg.AckWait <= 0 {
+		return nil, errors.New("ack wait must be positive")
+	}
+	if cfg.PullExpiry < time.Second {
+		return nil, errors.New("pull expiry must be at least a second")
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		closed := make(chan struct{})
+		conn, err := nats.Connect(url,
+			nats.Name(cfg.ConsumerPrefix),
+			nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+		)
+		if err != nil {
+			return nil, err
+		}
+		js, err := jetstream.New(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &JetStreamEventBus{
+			conn:      conn,
+			js:        js,
+			log:       log,
+			cfg:       cfg,
+			closed:    closed,
+			stopping:  make(chan struct{}),
+			consumers: make(map[string][]jetstream.Consumer),
+			streams:   make(map[string]bool),
+		}, nil
+	}
+}
+
+// Publish wraps the message in an envelope, publishes it to a specific topic and
+// waits for the stream to acknowledge it. The envelope ID doubles as the JetStream
+// message ID, so retried publishes are de-duplicated by the server.
+func (bus *JetStreamEventBus) Publish(ctx context.Context, topic string, message interface{}, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Time{}, opts...)
+}
+
+// PublishAt publishes the message like Publish, marking it with the time it becomes
+// due when that is in the future. A message delivered early is handed back to the
+// server with a delay covering the remaining time, without calling the handler.
+func (bus *JetStreamEventBus) PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...PublishOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := bus.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+
+	env, err := NewEnvelope(ctx, topic, message, opts...)
+	if err != nil {
+		return err
+	}
+	body, err := encodeEnvelope(env)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(prioritySubject(topic, env.Priority))
+	msg.Data = body
+	if at.After(time.Now()) {
+		msg.Header.Set(deliverAtHeader, at.UTC().Format(time.RFC3339Nano))
+	}
+
+	_, err = bus.js.PublishMsg(ctx, msg, jetstream.WithMsgID(env.ID))
+	if errors.Is(err, jetstream.ErrNoStreamResponse) {
+		// the stream was removed since it was set up, set it up again
+		bus.forgetStream(topic)
+		if err := bus.ensureStream(ctx, topic); err != nil {
+			return err
+		}
+		_, err = bus.js.PublishMsg(ctx, msg, jetstream.WithMsgID(env.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish to stream: %w", err)
+	}
+
+	return nil
+}
+
+// PublishAfter publishes a message that is delivered once delay has elapsed
+func (bus *JetStreamEventBus) PublishAfter(ctx context.Context, topic string, message interface{}, delay time.Duration, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Now().Add(delay), opts...)
+}
+
+// Subscribe starts pulling messages from the durable consumers of the topic,
+// which are shared by all subscribers, so that every message on the topic is
+// handled by exactly one of them. Failed messages are redelivered following the
+// configured backoff until MaxDeliver is reached. The subscriber stops when ctx
+// is done or the bus is closed.
+func (bus *JetStreamEventBus) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	if handler == nil {
+		return errors.New("handler function cannot be nil")
+	}
+
+	select {
+	case <-bus.stopping:
+		return ErrBusClosed
+	default:
+	}
+
+	consumers, err := bus.ensureConsumers(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	bus.wg.Add(1)
+	go func() {
+		defer bus.wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-bus.stopping:
+				return
+			default:
+			}
+
+			// a backlog is pulled highest priority first, and an idle subscriber
+			// waits on every consumer at once for the next message
+			var msgs []jetstream.Msg
+			msg, err := bus.next(consumers)
+			if msg != nil {
+				msgs = append(msgs, msg)
+			} else if err == nil {
+				msgs, err = bus.wait(ctx, consumers)
+			}
+			if err != nil {
+				bus.log.Error("failed to fetch message", zap.String("topic", topic), zap.Error(err))
+			}
+			if len(msgs) > 0 {
+				if !bus.handleMessages(ctx, topic, msgs, handler) {
+					return
+				}
+				continue
+			}
+			if err == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-bus.stopping:
+				return
+			case <-time.After(fetchRetryDelay):
+			}
+		}
+	}()
+
+	return nil
+}
+
+// next returns a message from the highest priority consumer holding one, or nil
+// when none of them does
+func (bus *JetStreamEventBus) next(consumers []jetstream.Consumer) (jetstream.Msg, error) {
+	for _, consumer := range consumers {
+		batch, err := consumer.FetchNoWait(1)
+		if err != nil {
+			return nil, err
+		}
+		for msg := range batch.Messages() {
+			return msg, nil
+		}
+		if err := batch.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// wait keeps a pull request open on every consumer until one of them delivers a
+// message, ctx is done or the bus is closed, so that messages published or
+// redelivered meanwhile are delivered straight away. The pull requests are then
+// drained, and the messages delivered before they were are returned as well,
+// highest priority first, rather than handed back at the cost of a delivery.
+func (bus *JetStreamEventBus) wait(ctx context.Context, consumers []jetstream.Consumer) ([]jetstream.Msg, error) {
+	type delivery struct {
+		priority int // index of the consumer, 0 being the highest priority
+		msg      jetstream.Msg
+		err      error
+	}
+
+	iters := make([]jetstream.MessagesContext, 0, len(consumers))
+	for _, consumer := range consumers {
+		iter, err := consumer.Messages(jetstream.PullMaxMessages(1), jetstream.PullExpiry(bus.cfg.PullExpiry))
+		if err != nil {
+			for _, iter := range iters {
+				iter.Stop()
+			}
+			return nil, err
+		}
+		iters = append(iters, iter)
+	}
+
+	deliveries := make(chan delivery)
+	var wg sync.WaitGroup
+	for priority, iter := range iters {
+		wg.Add(1)
+		go func(priority int, iter jetstream.MessagesContext) {
+			defer wg.Done()
+			for {
+				msg, err := iter.Next()
+				if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+					return
+				}
+				deliveries <- delivery{priority: priority, msg: msg, err: err}
+				if err != nil {
+					iter.Stop()
+					return
+				}
+			}
+		}(priority, iter)
+	}
+	go func() {
+		wg.Wait()
+		close(deliveries)
+	}()
+
+	var received []delivery
+	select {
+	case d := <-deliveries:
+		received = append(received, d)
+	case <-ctx.Done():
+	case <-bus.stopping:
+	}
+	for _, iter := range iters {
+		iter.Drain()
+	}
+	for d := range deliveries {
+		received = append(received, d)
+	}
+
+	var (
+		msgs []jetstream.Msg
+		err  error
+	)
+	slices.SortStableFunc(received, func(a, b delivery) int { return a.priority - b.priority })
+	for _, d := range received {
+		if d.err != nil {
+			err = d.err
+			continue
+		}
+		msgs = append(msgs, d.msg)
+	}
+	if len(msgs) > 0 {
+		return msgs, nil
+	}
+	return nil, err
+}
+
+// handleMessages handles messages in turn, keeping the ones waiting their turn in
+// progress. It hands the remaining messages back and returns false when ctx is
+// done before they are handled.
+func (bus *JetStreamEventBus) handleMessages(ctx context.Context, topic string, msgs []jetstream.Msg, handler Handler) bool {
+	log := bus.log.With(zap.String("topic", topic))
+
+	stops := make([]func(), len(msgs))
+	for i := 1; i < len(msgs); i++ {
+		stops[i] = bus.keepInProgress(log, msgs[i])
+	}
+
+	for i, msg := range msgs {
+		if stops[i] != nil {
+			stops[i]()
+		}
+		if ctx.Err() != nil {
+			// the subscription was cancelled while the message was being
+			// fetched, hand it back to the remaining subscribers
+			msg.Nak()
+			continue
+		}
+		bus.handleMessage(ctx, topic, msg, handler)
+	}
+	return ctx.Err() == nil
+}
+
+func (bus *JetStreamEventBus) handleMessage(ctx context.Context, topic string, msg jetstream.Msg, handler Handler) {
+	log := bus.log.With(zap.String("topic", topic))
+
+	env, err := decodeEnvelope(msg.Data())
+	if err != nil {
+		log.Error("error decoding message, dropping message", zap.Error(err))
+		msg.Term()
+		return
+	}
+	log = log.With(zap.String("message_id", env.ID))
+
+	meta, merr := msg.Metadata()
+	if merr != nil {
+		log.Error("failed to read message metadata", zap.Error(merr))
+	}
+
+	deliverAt, delayed := deliverAt(msg.Headers())
+	if delayed && time.Now().Before(deliverAt) {
+		if err := msg.NakWithDelay(time.Until(deliverAt)); err != nil {
+			log.Error("failed to delay message", zap.Error(err))
+		}
+		return
+	}
+
+	stop := bus.keepInProgress(log, msg)
+	err = handler(ContextWithEnvelope(ctx, env), env)
+	stop()
+	if err == nil {
+		if err := msg.Ack(); err != nil {
+			log.Error("failed to ack message", zap.Error(err))
+		}
+		return
+	}
+
+	if merr != nil {
+		log.Error("error handling message", zap.Error(err))
+		msg.Nak()
+		return
+	}
+
+	delivered := int(meta.NumDelivered)
+	if delayed && deliverAt.After(meta.Timestamp) {
+		// the first delivery was held back until the message was due
+		delivered--
+	}
+	log = log.With(zap.Int("delivery", delivered), zap.Error(err))
+
+	if delivered >= bus.cfg.MaxDeliver {
+		log.Error("error handling message, max deliveries reached, dropping message")
+		msg.Term()
+		return
+	}
+
+	delay := bus.backOff(delivered)
+	log.Warn("error handling message, scheduling redelivery", zap.Duration("delay", delay))
+	if err := msg.NakWithDelay(delay); err != nil {
+		log.Error("failed to nak message", zap.Error(err))
+	}
+}
+
+// keepInProgress tells the server that the message is still being handled every
+// half AckWait, so that a long running handler doesn't get the message
+// redelivered to another subscriber. The returned function stops it.
+func (bus *JetStreamEventBus) keepInProgress(log *zap.Logger, msg jetstream.Msg) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(bus.cfg.AckWait / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					log.Warn("failed to extend message ack deadline", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (bus *JetStreamEventBus) backOff(delivered int) time.Duration {
+	if len(bus.cfg.BackOff) == 0 {
+		return 0
+	}
+	if delivered > len(bus.cfg.BackOff) {
+		delivered = len(bus.cfg.BackOff)
+	}
+	return bus.cfg.BackOff[delivered-1]
+}
+
+// ensureStream creates the work queue stream backing a topic if it doesn't exist
+// yet, and adds the priority subjects to a stream created before they existed.
+// Streams are only looked up once per topic, so that publishing doesn't cost an
+// extra request per message.
+func (bus *JetStreamEventBus) ensureStream(ctx context.Context, topic string) error {
+	bus.streamsMu.Lock()
+	defer bus.streamsMu.Unlock()
+
+	if bus.streams[topic] {
+		return nil
+	}
+	if err := bus.setUpStream(ctx, topic); err != nil {
+		return err
+	}
+	bus.streams[topic] = true
+	return nil
+}
+
+// forgetStream makes the next publish on a topic set up its stream again
+func (bus *JetStreamEventBus) forgetStream(topic string) {
+	bus.streamsMu.Lock()
+	defer bus.streamsMu.Unlock()
+
+	delete(bus.streams, topic)
+}
+
+func (bus *JetStreamEventBus) setUpStream(ctx context.Context, topic string) error {
+	name := streamName(topic)
+	subjects := streamSubjects(topic)
+
+	stream, err := bus.js.Stream(ctx, name)
+	if err == nil {
+		if slices.Equal(stream.CachedInfo().Config.Subjects, subjects) {
+			return nil
+		}
+		cfg := stream.CachedInfo().Config
+		cfg.Subjects = subjects
+		if _, err := bus.js.UpdateStream(ctx, cfg); err != nil {
+			return fmt.Errorf("failed to update stream %s: %w", name, err)
+		}
+		return nil
+	}
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return fmt.Errorf("failed to look up stream %s: %w", name, err)
+	}
+
+	_, err = bus.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:      name,
+		Subjects:  subjects,
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil && !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+		return fmt.Errorf("failed to create stream %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ensureConsumers creates the durable pull consumers of a topic, one per
+// priority, and returns them highest priority first. The single push consumer
+// used before priorities existed is removed, as a work queue stream doesn't
+// allow it alongside them.
+func (bus *JetStreamEventBus) ensureConsumers(ctx context.Context, topic string) ([]jetstream.Consumer, error) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if consumers, ok := bus.consumers[topic]; ok {
+		return consumers, nil
+	}
+
+	if err := bus.ensureStream(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	stream := streamName(topic)
+	legacy := consumerName(bus.cfg.ConsumerPrefix, topic)
+
+	err := bus.js.DeleteConsumer(ctx, stream, legacy)
+	if err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return nil, fmt.Errorf("failed to remove consumer %s: %w", legacy, err)
+	}
+
+	consumers := make([]jetstream.Consumer, 0, MaxPriority+1)
+	for priority := MaxPriority; priority >= 0; priority-- {
+		durable := fmt.Sprintf("%s_p%d", legacy, priority)
+
+		consumer, err := bus.js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+			Durable:       durable,
+			FilterSubject: prioritySubject(topic, priority),
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       bus.cfg.AckWait,
+			// one extra delivery for delayed messages, which are held back once
+			MaxDeliver:    bus.cfg.MaxDeliver + 1,
+			MaxAckPending: bus.cfg.MaxAckPending,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up consumer %s: %w", durable, err)
+		}
+		consumers = append(consumers, consumer)
+	}
+
+	bus.consumers[topic] = consumers
+	return consumers, nil
+}
+
+// Close stops the subscribers, waiting for in-flight handlers, then drains and
+// closes the connection
+func (bus *JetStreamEventBus) Close() error {
+	bus.closeOnce.Do(func() {
+		close(bus.stopping)
+	})
+	bus.wg.Wait()
+
+	if bus.conn == nil || bus.conn.IsClosed() {
+		return nil
+	}
+	if err := bus.conn.Drain(); err != nil {
+		return fmt.Errorf("failed to drain connection: %w", err)
+	}
+	<-bus.closed
+	return nil
+}
+
+// deliverAt returns the time a delayed message becomes due
+func deliverAt(header nats.Header) (time.Time, bool) {
+	value := header.Get(deliverAtHeader)
+	if value == "" {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// prioritySubject returns the subject messages of the given priority are
+// published on. Messages of the default priority keep the topic as subject.
+func prioritySubject(topic string, priority int) string {
+	if priority == 0 {
+		return topic
+	}
+	return fmt.Sprintf("%s.priority.%d", topic, priority)
+}
+
+func streamSubjects(topic string) []string {
+	return []string{topic, topic + ".priority.*"}
+}
+
+func streamName(topic string) string {
+	return strings.ToUpper(sanitizeName(topic))
+}
+
+func consumerName(prefix, topic string) string {
+	return sanitizeName(prefix + "_" + topic)
+}
+
+// sanitizeName replaces characters that are not allowed in stream and consumer names
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '/', '\\':
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,389 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+	"github.com/victor-nach/git-monitor/pkg/eventbus/bustest"
+	"go.uber.org/zap"
+)
+
+// runJetStreamServer starts an embedded, in-process NATS server with JetStream enabled
+func runJetStreamServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("embedded nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	return ns.ClientURL()
+}
+
+func newTestJetStreamBus(t *testing.T, url string) *eventbus.JetStreamEventBus {
+	t.Helper()
+
+	bus, err := eventbus.NewJetStreamEventBus(context.Background(), url, zap.NewNop(), func(cfg *eventbus.JetStreamConfig) {
+		cfg.MaxDeliver = 3
+		cfg.BackOff = []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { bus.Close() })
+
+	return bus
+}
+
+func TestJetStreamEventBus_Conformance(t *testing.T) {
+	url := runJetStreamServer(t)
+
+	bustest.Run(t, func(t *testing.T) eventbus.EventBus {
+		return newTestJetStreamBus(t, url)
+	})
+}
+
+func TestJetStreamEventBus_PublishSubscribe(t *testing.T) {
+	bus := newTestJetStreamBus(t, runJetStreamServer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan eventbus.Envelope, 1)
+	err := bus.Subscribe(ctx, "test_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- env
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = bus.Publish(ctx, "test_topic", map[string]string{"hello": "world"},
+		eventbus.WithCorrelationID("task-1"),
+		eventbus.WithHeader("traceparent", "00-abc-def-01"),
+	)
+	require.NoError(t, err)
+
+	select {
+	case env := <-received:
+		assert.JSONEq(t, `{"hello":"world"}`, string(env.Payload))
+		assert.NotEmpty(t, env.ID)
+		assert.Equal(t, "test_topic", env.Topic)
+		assert.Equal(t, eventbus.DefaultSchemaVersion, env.SchemaVersion)
+		assert.Equal(t, "task-1", env.CorrelationID)
+		assert.Equal(t, "00-abc-def-01", env.Header("traceparent"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestJetStreamEventBus_QueueGroup(t *testing.T) {
+	bus := newTestJetStreamBus(t, runJetStreamServer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const total = 20
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string]int)
+		wg    sync.WaitGroup
+		count int32
+	)
+	wg.Add(total)
+
+	for i := 0; i < 3; i++ {
+		err := bus.Subscribe(ctx, "queue_topic", func(ctx context.Context, env eventbus.Envelope) error {
+			mu.Lock()
+			seen[string(env.Payload)]++
+			mu.Unlock()
+			if atomic.AddInt32(&count, 1) <= total {
+				wg.Done()
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < total; i++ {
+		require.NoError(t, bus.Publish(ctx, "queue_topic", fmt.Sprintf("msg-%d", i)))
+	}
+
+	waitTimeout(t, &wg, 5*time.Second)
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, seen, total)
+	for msg, n := range seen {
+		assert.Equal(t, 1, n, "message %s should be handled by exactly one subscriber", msg)
+	}
+}
+
+func TestJetStreamEventBus_RedeliveryWithBackoff(t *testing.T) {
+	bus := newTestJetStreamBus(t, runJetStreamServer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+	)
+	done := make(chan struct{})
+
+	err := bus.Subscribe(ctx, "retry_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			return errors.New("transient failure")
+		}
+		close(done)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, "retry_topic", "payload"))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for redelivery")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, attempts, 3)
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 50*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 100*time.Millisecond)
+}
+
+func TestJetStreamEventBus_MaxDeliver(t *testing.T) {
+	bus := newTestJetStreamBus(t, runJetStreamServer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var attempts int32
+	err := bus.Subscribe(ctx, "poison_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("permanent failure")
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, "poison_topic", "payload"))
+
+	time.Sleep(time.Second)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestJetStreamEventBus_DurableConsumer(t *testing.T) {
+	url := runJetStreamServer(t)
+
+	// publish while no subscriber is connected
+	publisher := newTestJetStreamBus(t, url)
+	require.NoError(t, publisher.Publish(context.Background(), "durable_topic", "queued"))
+	require.NoError(t, publisher.Close())
+
+	bus := newTestJetStreamBus(t, url)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan eventbus.Envelope, 1)
+	err := bus.Subscribe(ctx, "durable_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- env
+		return nil
+	})
+	require.NoError(t, err)
+
+	select {
+	case env := <-received:
+		assert.JSONEq(t, `"queued"`, string(env.Payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for queued message")
+	}
+}
+
+func TestJetStreamEventBus_UpgradesLegacyConsumer(t *testing.T) {
+	url := runJetStreamServer(t)
+
+	// a stream and push consumer set up before messages had priorities
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:      "LEGACY_TOPIC",
+		Subjects:  []string{"legacy_topic"},
+		Retention: nats.WorkQueuePolicy,
+	})
+	require.NoError(t, err)
+	_, err = js.AddConsumer("LEGACY_TOPIC", &nats.ConsumerConfig{
+		Durable:        "git-monitor_legacy_topic",
+		DeliverSubject: "_deliver.git-monitor_legacy_topic",
+		DeliverGroup:   "git-monitor_legacy_topic",
+		AckPolicy:      nats.AckExplicitPolicy,
+	})
+	require.NoError(t, err)
+	_, err = js.Publish("legacy_topic", []byte(`{"id":"msg-1","topic":"legacy_topic","payload":"queued"}`))
+	require.NoError(t, err)
+
+	bus := newTestJetStreamBus(t, url)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan eventbus.Envelope, 2)
+	err = bus.Subscribe(ctx, "legacy_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- env
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, bus.Publish(ctx, "legacy_topic", "urgent", eventbus.WithPriority(eventbus.MaxPriority)))
+
+	var payloads []string
+	for len(payloads) < 2 {
+		select {
+		case env := <-received:
+			payloads = append(payloads, string(env.Payload))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for messages, received %v", payloads)
+		}
+	}
+	assert.ElementsMatch(t, []string{`"queued"`, `"urgent"`}, payloads)
+}
+
+func TestJetStreamEventBus_CachesStreams(t *testing.T) {
+	url := runJetStreamServer(t)
+
+	// stream lookups are JetStream API requests, watched on their subject
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	var lookups atomic.Int32
+	_, err = nc.Subscribe("$JS.API.STREAM.INFO.CACHED_TOPIC", func(*nats.Msg) { lookups.Add(1) })
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	bus := newTestJetStreamBus(t, url)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, bus.Publish(ctx, "cached_topic", i))
+	}
+	require.NoError(t, nc.Flush())
+	assert.EqualValues(t, 1, lookups.Load())
+
+	// a stream removed behind the bus's back is set up again
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	require.NoError(t, js.DeleteStream("CACHED_TOPIC"))
+	require.NoError(t, bus.Publish(ctx, "cached_topic", "again"))
+
+	info, err := js.StreamInfo("CACHED_TOPIC")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, info.State.Msgs)
+}
+
+func TestJetStreamEventBus_IdleSubscriberDoesntPoll(t *testing.T) {
+	url := runJetStreamServer(t)
+
+	// pull requests are JetStream API requests, watched on their subject
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer nc.Close()
+	var pulls atomic.Int32
+	_, err = nc.Subscribe("$JS.API.CONSUMER.MSG.NEXT.IDLE_TOPIC.>", func(*nats.Msg) { pulls.Add(1) })
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	bus := newTestJetStreamBus(t, url)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan time.Time, 1)
+	err = bus.Subscribe(ctx, "idle_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- time.Now()
+		return nil
+	})
+	require.NoError(t, err)
+
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, nc.Flush())
+	// one pull per priority to find the consumers empty, then one held open per priority
+	assert.LessOrEqual(t, pulls.Load(), int32(2*(eventbus.MaxPriority+1)))
+
+	// the pull requests held open deliver a publish straight away
+	published := time.Now()
+	require.NoError(t, bus.Publish(ctx, "idle_topic", "payload"))
+	select {
+	case at := <-received:
+		assert.Less(t, at.Sub(published), 500*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestJetStreamEventBus_DelayedMessagesDontStallConsumer(t *testing.T) {
+	bus := newTestJetStreamBus(t, runJetStreamServer(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// delayed messages stay unacknowledged until due, more of them than the
+	// previous ack pending cap
+	for i := 0; i < 1100; i++ {
+		require.NoError(t, bus.PublishAfter(ctx, "stall_topic", "later", time.Hour))
+	}
+
+	received := make(chan string, 1)
+	err := bus.Subscribe(ctx, "stall_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- string(env.Payload)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, "stall_topic", "now"))
+	select {
+	case payload := <-received:
+		assert.Equal(t, `"now"`, payload)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func waitTimeout(t *testing.T, wg *sync.WaitGroup, timeout time.Duration) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for messages")
+	}
+}
@@ -2,21 +2,64 @@ package eventbus
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 )
 
-type RabbitMQEventBus struct {
-	conn *amqp.Connection
-	ch   *amqp.Channel
-	log  *zap.Logger
-}
+const (
+	// attemptHeader carries the delivery attempt of a message republished after a failure
+	attemptHeader = "x-delivery-attempt"
+	// delayQueueExpiry is how long an unused delay queue outlives the last message it holds
+	delayQueueExpiry = time.Minute
+)
+
+// ErrIncompatibleQueue is returned when a topic queue already exists with
+// arguments other than the ones the bus declares it with
+var ErrIncompatibleQueue = errors.New("incompatible topic queue")
+
+type (
+	RabbitMQConfig struct {
+		// MaxDeliver is the maximum number of times a message is delivered before it is rejected.
+		MaxDeliver int
+		// Prefetch is the number of unacknowledged messages a subscriber may hold.
+		Prefetch int
+		// BackOff holds the redelivery delays applied after each failed delivery.
+		BackOff []time.Duration
+	}
+
+	RabbitMQEventBus struct {
+		conn *amqp.Connection
+		ch   *amqp.Channel
+		log  *zap.Logger
+		cfg  RabbitMQConfig
+
+		// mu serialises the use of the publishing channel, which is shared with
+		// subscribers republishing failed messages
+		mu     sync.Mutex
+		queues map[string]bool
+
+		done      chan struct{}
+		closeOnce sync.Once
+		wg        sync.WaitGroup
+	}
+)
+
+func NewRabbitMQEventBus(ctx context.Context, uri string, log *zap.Logger, opts ...func(*RabbitMQConfig)) (*RabbitMQEventBus, error) {
+	cfg := RabbitMQConfig{
+		MaxDeliver: 5,
+		Prefetch:   10,
+		BackOff:    []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, time.Minute},
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
-func NewRabbitMQEventBus(ctx context.Context, uri string, log *zap.Logger) (*RabbitMQEventBus, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -31,15 +74,25 @@ func NewRabbitMQEventBus(ctx context.Context, uri string, log *zap.Logger) (*Rab
 			return nil, err
 		}
 		return &RabbitMQEventBus{
-			conn: conn,
-			ch:   ch,
-			log:  log,
+			conn:   conn,
+			ch:     ch,
+			log:    log,
+			cfg:    cfg,
+			queues: make(map[string]bool),
+			done:   make(chan struct{}),
 		}, nil
 	}
 }
 
-// Publish publishes a message to a specific topic
-func (bus *RabbitMQEventBus) Publish(ctx context.Context, topic string, message interface{}) error {
+// Publish wraps the message in an envelope and publishes it to a specific topic
+func (bus *RabbitMQEventBus) Publish(ctx context.Context, topic string, message interface{}, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Time{}, opts...)
+}
+
+// PublishAt wraps the message in an envelope and, when the given time is in the
+// future, publishes it to a delay queue from which it is dead-lettered to the
+// topic queue once due
+func (bus *RabbitMQEventBus) PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...PublishOption) error {
 	if bus.ch == nil {
 		return errors.New("channel is not initialized")
 	}
@@ -47,29 +100,39 @@ func (bus *RabbitMQEventBus) Publish(ctx context.Context, topic string, message
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-bus.done:
+		return ErrBusClosed
 	default:
-		body, err := json.Marshal(message)
+		env, err := NewEnvelope(ctx, topic, message, opts...)
+		if err != nil {
+			return err
+		}
+		body, err := encodeEnvelope(env)
 		if err != nil {
 			return err
 		}
 
-		return bus.ch.Publish(
-			"",    // default exchange
-			topic, // routing key used as queue name
-			false, // mandatory
-			false, // immediate
-			amqp.Publishing{
-				ContentType: "application/json",
-				Body:        body,
-			},
-		)
+		// declare the queue up front so messages published before the first
+		// subscriber are kept rather than discarded by the default exchange
+		if err := bus.ensureQueue(topic); err != nil {
+			return err
+		}
+
+		return bus.publish(env, body, 1, time.Until(at))
 	}
 }
 
-// Subscribe subscribes to messages on a given topic and calls the provided handler
-func (bus *RabbitMQEventBus) Subscribe(ctx context.Context, topic string, handler func(message []byte) error) error {
-	if bus.ch == nil {
-		return errors.New("channel is not initialized")
+// PublishAfter publishes a message that is delivered once delay has elapsed
+func (bus *RabbitMQEventBus) PublishAfter(ctx context.Context, topic string, message interface{}, delay time.Duration, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Now().Add(delay), opts...)
+}
+
+// Subscribe consumes messages on a given topic and calls the provided handler.
+// Subscribers of the same topic compete for messages on the topic queue; a
+// message is acknowledged once its handler returns and redelivered when it fails.
+func (bus *RabbitMQEventBus) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	if bus.conn == nil {
+		return errors.New("connection is not initialized")
 	}
 	if handler == nil {
 		return errors.New("handler function cannot be nil")
@@ -78,44 +141,54 @@ func (bus *RabbitMQEventBus) Subscribe(ctx context.Context, topic string, handle
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-bus.done:
+		return ErrBusClosed
 	default:
-		q, err := bus.ch.QueueDeclare(
-			topic, // topic queue
-			true,  // durable
-			false, // delete when unused
-			false, // exclusive
-			false, // no-wait
-			nil,   // arguments
-		)
+		// every subscription gets its own channel so the prefetch limit applies
+		// per subscriber and unacknowledged messages are requeued when it stops
+		ch, err := bus.conn.Channel()
 		if err != nil {
 			return err
 		}
+		if err := ch.Qos(bus.cfg.Prefetch, 0, false); err != nil {
+			ch.Close()
+			return err
+		}
+		if err := bus.ensureQueue(topic); err != nil {
+			ch.Close()
+			return err
+		}
 
-		msgs, err := bus.ch.Consume(
-			q.Name, // queue
-			"",     // consumer
-			true,   // autoAck
-			false,  // exclusive
-			false,  // no local
-			false,  // no wait
+		msgs, err := ch.Consume(
+			topic, // queue
+			"",    // consumer
+			false, // autoAck
+			false, // exclusive
+			false, // no local
+			false, // no wait
 			nil,
 		)
 		if err != nil {
+			ch.Close()
 			return err
 		}
 
+		bus.wg.Add(1)
 		go func() {
+			defer bus.wg.Done()
+			defer ch.Close()
+
 			for {
 				select {
 				case <-ctx.Done():
 					return
+				case <-bus.done:
+					return
 				case d, ok := <-msgs:
 					if !ok {
 						return
 					}
-					if err := handler(d.Body); err != nil {
-						bus.log.Error("error handling message", zap.Error(err))
-					}
+					bus.handleDelivery(ctx, d, handler)
 				}
 			}
 		}()
@@ -123,22 +196,194 @@ func (bus *RabbitMQEventBus) Subscribe(ctx context.Context, topic string, handle
 	}
 }
 
-// Close closes the RabbitMQ connection and channel
+// Close stops the subscribers, waits for in-flight handlers and closes the
+// RabbitMQ channel and connection
 func (bus *RabbitMQEventBus) Close() error {
 	var err error
-	if bus.ch != nil {
-		if cerr := bus.ch.Close(); cerr != nil {
-			err = fmt.Errorf("failed to close channel: %w", cerr)
+	bus.closeOnce.Do(func() {
+		close(bus.done)
+		bus.wg.Wait()
+
+		if bus.ch != nil {
+			if cerr := bus.ch.Close(); cerr != nil {
+				err = fmt.Errorf("failed to close channel: %w", cerr)
+			}
 		}
-	}
-	if bus.conn != nil {
-		if cerr := bus.conn.Close(); cerr != nil {
-			if err != nil {
-				err = fmt.Errorf("%v, failed to close connection: %w", err, cerr)
-			} else {
-				err = fmt.Errorf("failed to close connection: %w", cerr)
+		if bus.conn != nil {
+			if cerr := bus.conn.Close(); cerr != nil {
+				if err != nil {
+					err = fmt.Errorf("%v, failed to close connection: %w", err, cerr)
+				} else {
+					err = fmt.Errorf("failed to close connection: %w", cerr)
+				}
 			}
 		}
-	}
+	})
 	return err
 }
+
+func (bus *RabbitMQEventBus) handleDelivery(ctx context.Context, d amqp.Delivery, handler Handler) {
+	env, err := decodeEnvelope(d.Body)
+	if err != nil {
+		bus.log.Error("error decoding message, rejecting message", zap.String("message_id", d.MessageId), zap.Error(err))
+		d.Nack(false, false)
+		return
+	}
+
+	attempt := deliveryAttempt(d)
+	log := bus.log.With(
+		zap.String("topic", env.Topic),
+		zap.String("message_id", env.ID),
+		zap.Int("delivery", attempt),
+	)
+
+	err = handler(ContextWithEnvelope(ctx, env), env)
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			log.Error("error acknowledging message", zap.Error(err))
+		}
+		return
+	}
+
+	if attempt >= bus.cfg.MaxDeliver {
+		log.Error("error handling message, max deliveries reached, rejecting message", zap.Error(err))
+		d.Nack(false, false)
+		return
+	}
+
+	delay := bus.backOff(attempt)
+	log.Warn("error handling message, scheduling redelivery", zap.Duration("delay", delay), zap.Error(err))
+
+	// republish with the next attempt number before acknowledging, so the
+	// message is never lost; a crash in between leads to a duplicate instead
+	if perr := bus.publish(env, d.Body, attempt+1, delay); perr != nil {
+		log.Error("error republishing message, requeueing", zap.Error(perr))
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// publish sends the envelope to its topic queue, or to a delay queue when
+// delay is positive
+func (bus *RabbitMQEventBus) publish(env Envelope, body []byte, attempt int, delay time.Duration) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	queue := env.Topic
+	if delay > 0 {
+		var err error
+		if queue, err = bus.declareDelayQueue(env.Topic, delay); err != nil {
+			return err
+		}
+	}
+
+	return bus.ch.Publish(
+		"",    // default exchange
+		queue, // routing key used as queue name
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			Priority:      uint8(env.Priority),
+			MessageId:     env.ID,
+			CorrelationId: env.CorrelationID,
+			Timestamp:     env.ProducedAt,
+			Type:          env.Topic,
+			Headers:       amqp.Table{attemptHeader: int32(attempt)},
+			Body:          body,
+		},
+	)
+}
+
+// declareDelayQueue declares the queue holding messages for a topic for the given
+// delay, rounded up to the second to bound the number of queues. Messages expire
+// after the delay and are dead-lettered to the topic queue. The queue is declared
+// on every use so that it only expires once its last message has moved on.
+func (bus *RabbitMQEventBus) declareDelayQueue(topic string, delay time.Duration) (string, error) {
+	ttl := (delay + time.Second - 1).Truncate(time.Second)
+	name := fmt.Sprintf("%s.delay.%d", topic, ttl.Milliseconds())
+
+	_, err := bus.ch.QueueDeclare(
+		name,  // delay queue
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-message-ttl":             ttl.Milliseconds(),
+			"x-expires":                 (ttl + delayQueueExpiry).Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": topic,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to declare delay queue %s: %w", name, err)
+	}
+
+	return name, nil
+}
+
+func (bus *RabbitMQEventBus) backOff(delivered int) time.Duration {
+	if len(bus.cfg.BackOff) == 0 {
+		return 0
+	}
+	if delivered > len(bus.cfg.BackOff) {
+		delivered = len(bus.cfg.BackOff)
+	}
+	return bus.cfg.BackOff[delivered-1]
+}
+
+// ensureQueue declares the queue of a topic. It is declared on a channel of its
+// own, since the broker closes the channel of a declaration it rejects.
+func (bus *RabbitMQEventBus) ensureQueue(topic string) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.queues[topic] {
+		return nil
+	}
+
+	ch, err := bus.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	_, err = ch.QueueDeclare(
+		topic, // topic queue
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		// topic queues are priority queues, delivering higher priority messages first
+		amqp.Table{"x-max-priority": MaxPriority},
+	)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%w: queue %s was declared without x-max-priority, drain and delete it before upgrading: %v", ErrIncompatibleQueue, topic, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	bus.queues[topic] = true
+	return nil
+}
+
+// deliveryAttempt returns the attempt number of a delivery, counting a broker
+// redelivery of a message that was never acknowledged as a further attempt
+func deliveryAttempt(d amqp.Delivery) int {
+	attempt := 1
+	switch v := d.Headers[attemptHeader].(type) {
+	case int32:
+		attempt = int(v)
+	case int64:
+		attempt = int(v)
+	}
+	if d.Redelivered {
+		attempt++
+	}
+	return attempt
+}
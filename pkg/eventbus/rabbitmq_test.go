@@ -0,0 +1,65 @@
+package eventbus_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+	"github.com/victor-nach/git-monitor/pkg/eventbus/bustest"
+	"go.uber.org/zap"
+)
+
+// TestRabbitMQEventBus_Conformance runs against the broker at TEST_RABBITMQ_URL,
+// e.g. the one started by make run-rmq
+func TestRabbitMQEventBus_Conformance(t *testing.T) {
+	url := os.Getenv("TEST_RABBITMQ_URL")
+	if url == "" {
+		t.Skip("TEST_RABBITMQ_URL not set, skipping RabbitMQ conformance tests")
+	}
+
+	bustest.Run(t, func(t *testing.T) eventbus.EventBus {
+		bus, err := eventbus.NewRabbitMQEventBus(context.Background(), url, zap.NewNop())
+		require.NoError(t, err)
+		return bus
+	})
+}
+
+// TestRabbitMQEventBus_IncompatibleQueue checks that a topic queue declared
+// before priorities existed is reported, and doesn't break the bus for the
+// other topics
+func TestRabbitMQEventBus_IncompatibleQueue(t *testing.T) {
+	url := os.Getenv("TEST_RABBITMQ_URL")
+	if url == "" {
+		t.Skip("TEST_RABBITMQ_URL not set, skipping RabbitMQ tests")
+	}
+
+	conn, err := amqp.Dial(url)
+	require.NoError(t, err)
+	defer conn.Close()
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+	defer ch.Close()
+
+	topic := "incompatible_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err = ch.QueueDeclare(topic, true, false, false, false, nil)
+	require.NoError(t, err)
+	defer ch.QueueDelete(topic, false, false, false)
+
+	bus, err := eventbus.NewRabbitMQEventBus(context.Background(), url, zap.NewNop())
+	require.NoError(t, err)
+	defer bus.Close()
+
+	err = bus.Subscribe(context.Background(), topic, func(ctx context.Context, env eventbus.Envelope) error { return nil })
+	require.ErrorIs(t, err, eventbus.ErrIncompatibleQueue)
+	require.ErrorIs(t, bus.Publish(context.Background(), topic, "message"), eventbus.ErrIncompatibleQueue)
+
+	other := topic + "_other"
+	require.NoError(t, bus.Publish(context.Background(), other, "message"))
+	_, err = ch.QueueDelete(other, false, false, false)
+	require.NoError(t, err)
+}
@@ -1,80 +1,190 @@
 package eventbus
 
 import (
+	"container/heap"
 	"context"
-	"encoding/json"
 	"errors"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
-type InMemoryEventBus struct {
-	subscribers sync.Map 
-	log         *zap.Logger
-	bufferSize  int 
-}
+// ErrBusClosed is returned when publishing to a bus that has been closed
+var ErrBusClosed = errors.New("event bus is closed")
+
+type (
+	InMemoryConfig struct {
+		// MaxDeliver is the maximum number of times a message is delivered before it is dropped.
+		MaxDeliver int
+		// BackOff holds the redelivery delays applied after each failed delivery.
+		BackOff []time.Duration
+	}
+
+	// InMemoryEventBus keeps one bounded priority queue per topic. All subscribers
+	// of a topic consume from the same queue, so every message is handled once,
+	// highest priority first. Delayed messages and redeliveries wait in a due-time
+	// index until they are moved to their queue.
+	InMemoryEventBus struct {
+		log        *zap.Logger
+		bufferSize int
+		cfg        InMemoryConfig
+
+		mu     sync.Mutex
+		queues map[string]*priorityQueue
+
+		dueMu sync.Mutex
+		due   dueIndex
+		wake  chan struct{}
+
+		done      chan struct{}
+		closeOnce sync.Once
+		wg        sync.WaitGroup
+	}
+
+	delivery struct {
+		env     Envelope
+		attempt int
+	}
+
+	// scheduled is a delivery waiting in the due-time index
+	scheduled struct {
+		queue *priorityQueue
+		d     delivery
+		at    time.Time
+	}
+
+	// dueIndex is a min-heap of scheduled deliveries ordered by due time
+	dueIndex []scheduled
+
+	// priorityQueue is the queue of a topic. It holds up to the buffer size of
+	// the bus, and hands out deliveries by priority, then in the order they were
+	// queued.
+	priorityQueue struct {
+		// slots holds a token for every queued delivery, bounding the queue
+		slots chan struct{}
+		// ready holds a token for every delivery waiting to be popped
+		ready chan struct{}
+
+		mu    sync.Mutex
+		items deliveryHeap
+		seq   uint64
+	}
+
+	queued struct {
+		d   delivery
+		seq uint64
+	}
 
-func NewInMemoryEventBus(log *zap.Logger, bufferSize int) *InMemoryEventBus {
-	return &InMemoryEventBus{
-		subscribers: sync.Map{},
-		log:         log,
-		bufferSize:  bufferSize,
+	// deliveryHeap is a max-heap of queued deliveries ordered by priority, then
+	// by queueing order
+	deliveryHeap []queued
+)
+
+func NewInMemoryEventBus(log *zap.Logger, bufferSize int, opts ...func(*InMemoryConfig)) *InMemoryEventBus {
+	cfg := InMemoryConfig{
+		MaxDeliver: 5,
+		BackOff:    []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, time.Minute},
 	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	bus := &InMemoryEventBus{
+		log:        log,
+		bufferSize: bufferSize,
+		cfg:        cfg,
+		queues:     make(map[string]*priorityQueue),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+
+	go bus.runScheduler()
+
+	return bus
+}
+
+// Publish wraps the message in an envelope and queues it on a specific topic.
+// It blocks while the topic queue is full, until ctx is done.
+func (bus *InMemoryEventBus) Publish(ctx context.Context, topic string, message interface{}, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Time{}, opts...)
 }
 
-// Publish publishes a message to a specific topic
-func (bus *InMemoryEventBus) Publish(ctx context.Context, topic string, message interface{}) error {
+// PublishAt wraps the message in an envelope and keeps it in the due-time index
+// until the given time, after which it is queued on the topic.
+func (bus *InMemoryEventBus) PublishAt(ctx context.Context, topic string, message interface{}, at time.Time, opts ...PublishOption) error {
 	log := bus.log.With(zap.String("topic", topic))
 	log.Info("publishing event..", zap.Any("topic", topic))
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	env, err := NewEnvelope(ctx, topic, message, opts...)
+	if err != nil {
+		return err
+	}
+
 	select {
-	case <-ctx.Done():
-		return ctx.Err()
+	case <-bus.done:
+		return ErrBusClosed
 	default:
-		body, err := json.Marshal(message)
-		if err != nil {
-			return err
-		}
+	}
 
-		// Load the subscribers for the topic
-		if chs, ok := bus.subscribers.Load(topic); ok {
-			for _, ch := range chs.([]chan []byte) {
-				select {
-				case ch <- body:
-				default:
-					bus.log.Warn("subscriber channel is full, dropping message", zap.String("topic", topic))
-				}
-			}
-		}
+	d := delivery{env: env, attempt: 1}
 
+	if at.After(time.Now()) {
+		log.Info("scheduling event for delayed delivery", zap.String("message_id", env.ID), zap.Time("deliver_at", at))
+		bus.schedule(bus.queue(topic), d, at)
 		return nil
 	}
+
+	return bus.queue(topic).put(ctx, bus.done, d)
 }
 
-// Subscribe subscribes to messages on a given topic and calls the provided handler
-func (bus *InMemoryEventBus) Subscribe(ctx context.Context, topic string, handler func(message []byte) error) error {
+// PublishAfter publishes a message that is delivered once delay has elapsed
+func (bus *InMemoryEventBus) PublishAfter(ctx context.Context, topic string, message interface{}, delay time.Duration, opts ...PublishOption) error {
+	return bus.PublishAt(ctx, topic, message, time.Now().Add(delay), opts...)
+}
+
+// Subscribe starts a consumer on the topic queue and calls the provided handler
+// for each message. The consumer stops when ctx is done or the bus is closed.
+func (bus *InMemoryEventBus) Subscribe(ctx context.Context, topic string, handler Handler) error {
 	if handler == nil {
 		return errors.New("handler function cannot be nil")
 	}
 
-	ch := make(chan []byte, bus.bufferSize)
+	select {
+	case <-bus.done:
+		return ErrBusClosed
+	default:
+	}
 
-	chs, _ := bus.subscribers.LoadOrStore(topic, []chan []byte{})
-	updatedChs := append(chs.([]chan []byte), ch)
-	bus.subscribers.Store(topic, updatedChs)
+	queue := bus.queue(topic)
 
+	bus.wg.Add(1)
 	go func() {
+		defer bus.wg.Done()
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg, ok := <-ch:
-				if !ok {
+
+			case <-bus.done:
+				bus.drain(ctx, queue, handler)
+				return
+
+			case <-queue.ready:
+				d := queue.pop()
+				if ctx.Err() != nil {
+					// the subscription was cancelled while the message was in
+					// flight, hand it back to the remaining subscribers
+					bus.schedule(queue, d, time.Now())
 					return
 				}
-				if err := handler(msg); err != nil {
-					bus.log.Error("error handling message", zap.Error(err))
-				}
+				bus.handle(ctx, queue, d, handler)
 			}
 		}
 	}()
@@ -82,14 +192,263 @@ func (bus *InMemoryEventBus) Subscribe(ctx context.Context, topic string, handle
 	return nil
 }
 
+// Close stops accepting messages, lets subscribers handle what is already queued
+// and waits for in-flight handlers to return.
 func (bus *InMemoryEventBus) Close() error {
-	bus.subscribers.Range(func(topic, chs interface{}) bool {
-		for _, ch := range chs.([]chan []byte) {
-			close(ch)
-		}
-		bus.subscribers.Delete(topic)
-		return true
+	bus.closeOnce.Do(func() {
+		close(bus.done)
 	})
+	bus.wg.Wait()
+
+	return nil
+}
+
+func (bus *InMemoryEventBus) queue(topic string) *priorityQueue {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	queue, ok := bus.queues[topic]
+	if !ok {
+		queue = newPriorityQueue(bus.bufferSize)
+		bus.queues[topic] = queue
+	}
+	return queue
+}
+
+func (bus *InMemoryEventBus) handle(ctx context.Context, queue *priorityQueue, d delivery, handler Handler) {
+	log := bus.log.With(
+		zap.String("topic", d.env.Topic),
+		zap.String("message_id", d.env.ID),
+		zap.Int("delivery", d.attempt),
+	)
+
+	err := handler(ContextWithEnvelope(ctx, d.env), d.env)
+	if err == nil {
+		return
+	}
+
+	if d.attempt >= bus.cfg.MaxDeliver {
+		log.Error("error handling message, max deliveries reached, dropping message", zap.Error(err))
+		return
+	}
+
+	delay := bus.backOff(d.attempt)
+	log.Warn("error handling message, scheduling redelivery", zap.Duration("delay", delay), zap.Error(err))
+
+	d.attempt++
+	bus.schedule(queue, d, time.Now().Add(delay))
+}
+
+// schedule adds a delivery to the due-time index and wakes the scheduler up in
+// case it is now the earliest one
+func (bus *InMemoryEventBus) schedule(queue *priorityQueue, d delivery, at time.Time) {
+	bus.dueMu.Lock()
+	heap.Push(&bus.due, scheduled{queue: queue, d: d, at: at})
+	bus.dueMu.Unlock()
+
+	select {
+	case bus.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler moves deliveries from the due-time index to their queues once
+// they are due, sleeping until the earliest one in between
+func (bus *InMemoryEventBus) runScheduler() {
+	for {
+		ready, next := bus.popDue(time.Now())
+
+		for _, s := range ready {
+			bus.deliver(s)
+		}
+
+		var (
+			timer *time.Timer
+			due   <-chan time.Time
+		)
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+
+		select {
+		case <-due:
+		case <-bus.wake:
+		case <-bus.done:
+			bus.dropScheduled()
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// deliver moves a due delivery to its queue. When the queue is full, the delivery
+// waits for room in a goroutine of its own, so that a full topic doesn't hold
+// back the deliveries of the other topics.
+func (bus *InMemoryEventBus) deliver(s scheduled) {
+	if s.queue.tryPut(s.d) {
+		return
+	}
+
+	go func() {
+		if err := s.queue.put(context.Background(), bus.done, s.d); err != nil {
+			bus.log.Warn("event bus closed, dropping scheduled message",
+				zap.String("topic", s.d.env.Topic),
+				zap.String("message_id", s.d.env.ID),
+			)
+		}
+	}()
+}
+
+// popDue removes the deliveries due at now from the index and returns them,
+// along with the due time of the next one, zero if the index is empty
+func (bus *InMemoryEventBus) popDue(now time.Time) ([]scheduled, time.Time) {
+	bus.dueMu.Lock()
+	defer bus.dueMu.Unlock()
+
+	var ready []scheduled
+	for len(bus.due) > 0 && !bus.due[0].at.After(now) {
+		ready = append(ready, heap.Pop(&bus.due).(scheduled))
+	}
+
+	if len(bus.due) == 0 {
+		return ready, time.Time{}
+	}
+	return ready, bus.due[0].at
+}
+
+func (bus *InMemoryEventBus) dropScheduled() {
+	bus.dueMu.Lock()
+	defer bus.dueMu.Unlock()
 
+	if dropped := len(bus.due); dropped > 0 {
+		bus.log.Warn("event bus closed, dropping scheduled messages", zap.Int("count", dropped))
+	}
+}
+
+// drain handles the messages left on the queue when the bus is closed
+func (bus *InMemoryEventBus) drain(ctx context.Context, queue *priorityQueue, handler Handler) {
+	for {
+		select {
+		case <-queue.ready:
+			d := queue.pop()
+			err := handler(ContextWithEnvelope(ctx, d.env), d.env)
+			if err != nil {
+				bus.log.Error("error handling message while draining, dropping message",
+					zap.String("topic", d.env.Topic),
+					zap.String("message_id", d.env.ID),
+					zap.Error(err),
+				)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (bus *InMemoryEventBus) backOff(delivered int) time.Duration {
+	if len(bus.cfg.BackOff) == 0 {
+		return 0
+	}
+	if delivered > len(bus.cfg.BackOff) {
+		delivered = len(bus.cfg.BackOff)
+	}
+	return bus.cfg.BackOff[delivered-1]
+}
+
+func (idx dueIndex) Len() int           { return len(idx) }
+func (idx dueIndex) Less(i, j int) bool { return idx[i].at.Before(idx[j].at) }
+func (idx dueIndex) Swap(i, j int)      { idx[i], idx[j] = idx[j], idx[i] }
+
+func (idx *dueIndex) Push(x any) {
+	*idx = append(*idx, x.(scheduled))
+}
+
+func (idx *dueIndex) Pop() any {
+	old := *idx
+	n := len(old)
+	item := old[n-1]
+	*idx = old[:n-1]
+	return item
+}
+
+func newPriorityQueue(size int) *priorityQueue {
+	size = max(size, 1)
+	return &priorityQueue{
+		slots: make(chan struct{}, size),
+		ready: make(chan struct{}, size),
+	}
+}
+
+// put queues a delivery, blocking while the queue is full until ctx or done is done
+func (q *priorityQueue) put(ctx context.Context, done <-chan struct{}, d delivery) error {
+	select {
+	case q.slots <- struct{}{}:
+	case <-done:
+		return ErrBusClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.push(d)
 	return nil
 }
+
+// tryPut queues a delivery if the queue has room for it, without blocking
+func (q *priorityQueue) tryPut(d delivery) bool {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	q.push(d)
+	return true
+}
+
+// push adds a delivery to the queue. It must only be called once a slot has been
+// taken for it.
+func (q *priorityQueue) push(d delivery) {
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.items, queued{d: d, seq: q.seq})
+	q.mu.Unlock()
+
+	q.ready <- struct{}{}
+}
+
+// pop removes the delivery with the highest priority from the queue. It must
+// only be called after receiving a token from ready, which guarantees that the
+// queue holds a delivery.
+func (q *priorityQueue) pop() delivery {
+	q.mu.Lock()
+	item := heap.Pop(&q.items).(queued)
+	q.mu.Unlock()
+
+	<-q.slots
+	return item.d
+}
+
+func (h deliveryHeap) Len() int { return len(h) }
+func (h deliveryHeap) Less(i, j int) bool {
+	if h[i].d.env.Priority != h[j].d.env.Priority {
+		return h[i].d.env.Priority > h[j].d.env.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h deliveryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *deliveryHeap) Push(x any) {
+	*h = append(*h, x.(queued))
+}
+
+func (h *deliveryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,63 @@
+package eventbus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/victor-nach/git-monitor/pkg/eventbus"
+	"github.com/victor-nach/git-monitor/pkg/eventbus/bustest"
+	"go.uber.org/zap"
+)
+
+func TestInMemoryEventBus_Conformance(t *testing.T) {
+	bustest.Run(t, func(t *testing.T) eventbus.EventBus {
+		return eventbus.NewInMemoryEventBus(zap.NewNop(), 100, func(cfg *eventbus.InMemoryConfig) {
+			cfg.MaxDeliver = 3
+			cfg.BackOff = []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+		})
+	})
+}
+
+func TestInMemoryEventBus_FullTopicDoesNotBlockDelayedDelivery(t *testing.T) {
+	bus := eventbus.NewInMemoryEventBus(zap.NewNop(), 1)
+	defer bus.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the queue of the first topic is full, and nothing consumes it
+	require.NoError(t, bus.Publish(ctx, "full_topic", "queued"))
+	require.NoError(t, bus.PublishAfter(ctx, "full_topic", "delayed", 10*time.Millisecond))
+
+	received := make(chan string, 1)
+	require.NoError(t, bus.Subscribe(ctx, "other_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		received <- string(env.Payload)
+		return nil
+	}))
+	require.NoError(t, bus.PublishAfter(ctx, "other_topic", "delayed", 50*time.Millisecond))
+
+	select {
+	case payload := <-received:
+		assert.JSONEq(t, `"delayed"`, payload)
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed message held back by a full topic")
+	}
+
+	// the message waiting for room is queued once the full topic is consumed
+	full := make(chan string, 2)
+	require.NoError(t, bus.Subscribe(ctx, "full_topic", func(ctx context.Context, env eventbus.Envelope) error {
+		full <- string(env.Payload)
+		return nil
+	}))
+	for _, want := range []string{`"queued"`, `"delayed"`} {
+		select {
+		case payload := <-full:
+			assert.JSONEq(t, want, payload)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
@@ -73,16 +73,15 @@ func (s *service) GetCommitsStream(ctx context.Context, request models.GetCommit
 	var wg sync.WaitGroup
 	wg.Add(1)
 
+	// the channels are closed once streaming stops, which signals completion on
+	// doneChan. Sends give up when ctx is done, so the stream never blocks on a
+	// consumer that has stopped reading.
 	go func() {
 		defer wg.Done()
-		defer func() {
-			// Signal completion.
-			doneChan <- struct{}{}
-		}()
 
 		untilVal := s.determineUntil(request)
 		sinceVal := s.determineSince(request)
-		s.streamCommits(ctx, log, request.RepoInfo, request.RepoID, sinceVal, untilVal, dataChan, errChan)
+		s.streamCommits(ctx, log, request.RepoInfo, request.RepoID, sinceVal, untilVal, request.Page, dataChan, errChan)
 	}()
 
 	go func() {
@@ -114,8 +113,13 @@ func (s *service) determineSince(request models.GetCommitsStreamRequest) time.Ti
 	return time.Time{}
 }
 
-func (s *service) streamCommits(ctx context.Context, log *zap.Logger, repoInfo models.RepoInfo, repoID string, since, until time.Time, dataChan chan<- []models.Commit, errChan chan<- error) {
+func (s *service) streamCommits(ctx context.Context, log *zap.Logger, repoInfo models.RepoInfo, repoID string, since, until time.Time, startPage int, dataChan chan<- []models.Commit, errChan chan<- error) {
 	currentPage := 1
+	if startPage > 1 {
+		// pages are stable since until is fixed, so a resumed stream skips
+		// the pages already fetched
+		currentPage = startPage
+	}
 
 	for {
 		select {
@@ -132,7 +136,10 @@ func (s *service) streamCommits(ctx context.Context, log *zap.Logger, repoInfo m
 			commitsDTOs, err := s.client.GetCommits(ctx, repoInfo.Owner, repoInfo.Name, since, until, s.batchSize, currentPage)
 			if err != nil {
 				batchErr := errors.NewBatchError(nil, s.batchSize, err)
-				errChan <- batchErr
+				select {
+				case errChan <- batchErr:
+				case <-ctx.Done():
+				}
 				return
 			}
 
@@ -148,7 +155,12 @@ func (s *service) streamCommits(ctx context.Context, log *zap.Logger, repoInfo m
 			)
 
 			domainCommits := mapCommits(repoInfo, repoID, commitsDTOs)
-			dataChan <- domainCommits
+			select {
+			case dataChan <- domainCommits:
+			case <-ctx.Done():
+				log.Info("context done, stopping commit stream", zap.Error(ctx.Err()))
+				return
+			}
 
 			if len(commitsDTOs) < s.batchSize {
 				log.Info("successfully retrieved all commit streams from github")
@@ -143,6 +143,13 @@ func (c *client) doWithRetry(ctx context.Context, url string, result interface{}
 			return nil
 		}
 
+		// no point waiting for a rate limit that resets after the retry delay,
+		// leave it to the caller to try again once it has reset
+		var rateLimitErr errors.RateLimitError
+		if rerrors.As(err, &rateLimitErr) && time.Until(rateLimitErr.ResetAt) > c.retryDelay {
+			return err
+		}
+
 		if rerrors.Is(err, errors.ErrRateLimitExceeded) || rerrors.Is(err, errors.ErrInternalServer) {
 			c.log.Warn("retrying request", zap.String("url", url), zap.Error(err), zap.Int("attempt", i+1))
 			time.Sleep(c.retryDelay)
@@ -179,7 +186,10 @@ func (c *client) do(ctx context.Context, url string, result interface{}) error {
 		return errors.ErrRepositoryNotFound
 	case http.StatusUnauthorized:
 		return errors.ErrUnauthorized
-	case http.StatusForbidden:
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if resetAt, ok := rateLimitReset(resp.Header, time.Now()); ok {
+			return errors.NewRateLimitError(resetAt)
+		}
 		return errors.ErrRateLimitExceeded
 	case http.StatusInternalServerError:
 		return errors.ErrInternalServer
@@ -187,3 +197,22 @@ func (c *client) do(ctx context.Context, url string, result interface{}) error {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 }
+
+// rateLimitReset returns when requests are allowed again after a rate limited
+// response, from the Retry-After header of secondary rate limits or the
+// X-RateLimit-Reset header once the primary rate limit is used up
+func rateLimitReset(header http.Header, now time.Time) (time.Time, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -5,6 +5,7 @@ import (
 	ierrors "errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -183,3 +184,58 @@ func TestGetCommits(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCommits_RateLimitReset(t *testing.T) {
+	resetAt := time.Now().Add(40 * time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name            string
+		responseStatus  int
+		headers         map[string]string
+		expectedResetAt time.Time
+	}{
+		{
+			name:           "Primary rate limit used up",
+			responseStatus: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(resetAt.Unix(), 10),
+			},
+			expectedResetAt: resetAt,
+		},
+		{
+			name:           "Secondary rate limit",
+			responseStatus: http.StatusTooManyRequests,
+			headers: map[string]string{
+				"Retry-After": "2400",
+			},
+			expectedResetAt: resetAt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.responseStatus)
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			client := New("test-token", zap.NewNop(), &Config{BaseURL: &server.URL})
+
+			_, err := client.GetCommits(context.Background(), "octocat", "Hello-World", time.Time{}, time.Now(), 10, 1)
+
+			require.True(t, ierrors.Is(err, errors.ErrRateLimitExceeded))
+
+			var rateLimitErr errors.RateLimitError
+			require.True(t, ierrors.As(err, &rateLimitErr))
+			require.WithinDuration(t, tt.expectedResetAt, rateLimitErr.ResetAt, 2*time.Second)
+			require.Equal(t, 1, calls, "should not retry a rate limit that resets after the retry delay")
+		})
+	}
+}
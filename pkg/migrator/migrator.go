@@ -7,75 +7,87 @@ import (
 	"fmt"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	pgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"go.uber.org/zap"
 )
 
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
 // Migrate applies all up migrations
-func Migrate(ctx context.Context, db *sql.DB, migrationsPath string, log *zap.Logger) error {
-	if db == nil {
-		return errors.New("database instance is nil")
+func Migrate(ctx context.Context, db *sql.DB, driverName, migrationsPath string, log *zap.Logger) error {
+	m, err := newMigrate(db, driverName, migrationsPath)
+	if err != nil {
+		return err
 	}
-	if migrationsPath == "" {
-		return errors.New("migrations path is empty")
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migration failed: %w", err)
 	}
 
-	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	log.Info("migrations applied successfully", zap.String("driver", driverName))
+	return nil
+}
+
+// Reset runs all down migrations and then reapplies all up migrations
+func Reset(ctx context.Context, db *sql.DB, driverName, migrationsPath string, log *zap.Logger) error {
+	m, err := newMigrate(db, driverName, migrationsPath)
 	if err != nil {
-		return fmt.Errorf("could not create migration driver: %w", err)
+		return err
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", migrationsPath),
-		"sqlite3",
-		driver,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+	// Run down migrations
+	if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to run down migrations: %w", err)
 	}
 
+	// Run up migrations
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("migration failed: %w", err)
+		return fmt.Errorf("failed to run up migrations: %w", err)
 	}
 
-	log.Info("migrations applied successfully")
+	log.Info("database reset and migrations reapplied successfully", zap.String("driver", driverName))
 	return nil
 }
 
-// Reset runs all down migrations and then reapplies all up migrations
-func Reset(ctx context.Context, db *sql.DB, migrationsPath string, log *zap.Logger) error {
+// newMigrate returns a migrate instance applying the migrations in the given
+// path to the database, through the migration driver of the backend
+func newMigrate(db *sql.DB, driverName, migrationsPath string) (*migrate.Migrate, error) {
 	if db == nil {
-		return errors.New("database instance is nil")
+		return nil, errors.New("database instance is nil")
 	}
 	if migrationsPath == "" {
-		return errors.New("migrations path is empty")
+		return nil, errors.New("migrations path is empty")
 	}
 
-	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	var (
+		driver database.Driver
+		err    error
+	)
+	switch driverName {
+	case DriverSQLite:
+		driver, err = sqlite3.WithInstance(db, &sqlite3.Config{})
+	case DriverPostgres:
+		driver, err = pgx.WithInstance(db, &pgx.Config{})
+	default:
+		return nil, fmt.Errorf("unsupported migration driver %q", driverName)
+	}
 	if err != nil {
-		return fmt.Errorf("could not create migration driver: %w", err)
+		return nil, fmt.Errorf("could not create migration driver: %w", err)
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
 		fmt.Sprintf("file://%s", migrationsPath),
-		"sqlite3",
+		driverName,
 		driver,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
 	}
-
-	// Run down migrations
-	if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("failed to run down migrations: %w", err)
-	}
-
-	// Run up migrations
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("failed to run up migrations: %w", err)
-	}
-
-	log.Info("database reset and migrations reapplied successfully")
-	return nil
+	return m, nil
 }